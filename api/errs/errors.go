@@ -6,33 +6,222 @@ import (
 )
 
 var (
+	ErrValidationFailed = errors.New("request validation failed")
+	ErrInternal         = errors.New("internal server error")
+
+	ErrUnauthorized  = errors.New("authentication required")
+	ErrForbidden     = errors.New("permission denied")
+	ErrTokenNotFound = errors.New("token not found")
+	ErrUserNotFound  = errors.New("user not found")
+	ErrUserConflict  = errors.New("user already exists")
+	ErrTeamNotFound  = errors.New("team not found")
+	ErrTeamConflict  = errors.New("team already exists")
+	ErrRoleNotFound  = errors.New("role not found")
+	ErrRoleSubject   = errors.New("role subject must be an existing user or team")
+
 	ErrProjectNotFound = errors.New("project not found")
 	ErrProjectConflict = errors.New("project already exists")
+	ErrProjectInUse    = errors.New("project has active jobs")
 
 	ErrVersionNotFound         = errors.New("version not found")
 	ErrVersionConflict         = errors.New("version already exists")
+	ErrVersionIDInvalid        = errors.New("version ID may only contain letters, digits, '.', '_' and '-'")
 	ErrVersionImageTarNotFound = errors.New("image_tar not found")
 	ErrVersionImageTarInvalid  = errors.New("image_tar is invalid")
+	ErrVersionImageInvalid     = errors.New("image reference is invalid")
+	ErrVersionSourceInvalid    = errors.New("source_zip is not a scrapy project")
+	ErrVersionBuildLogNotFound = errors.New("build logs not found")
+	ErrVersionNotReady         = errors.New("version is not ready")
+	ErrVersionBusy             = errors.New("version is still being ingested")
+	ErrVersionInspectFailed    = errors.New("spider inspection failed")
+	ErrVersionInUse            = errors.New("version has active jobs")
+	ErrVersionAliased          = errors.New("version is referenced by an alias")
+	ErrVersionDigestMismatch   = errors.New("image_tar does not match the expected sha256")
+	ErrVersionUnsigned         = errors.New("version must be uploaded with the signature of a trusted key")
+	ErrVersionSignatureInvalid = errors.New("signature does not verify against any trusted key")
+	ErrVersionExportInvalid    = errors.New("image_tar is not a version export")
+	ErrVersionEggInvalid       = errors.New("egg is not a scrapy project egg")
+	ErrVersionFailed           = errors.New("version failed to build or inspect")
+
+	ErrJobNotFound    = errors.New("job not found")
+	ErrJobCreate      = errors.New("job failed to create")
+	ErrJobConflict    = errors.New("job already exists")
+	ErrJobDuplicate   = errors.New("an identical job is already running")
+	ErrJobFilterEmpty = errors.New("job filter must not be empty")
+
+	ErrSpiderNotFound    = errors.New("spider not found")
+	ErrContainerNotFound = errors.New("no container found")
+	ErrImageInUse        = errors.New("image is used by containers")
+	ErrPolicyNotFound    = errors.New("spider policy not found")
+
+	ErrInputNotFound  = errors.New("input file not found")
+	ErrInputInvalid   = errors.New("input file is invalid")
+	ErrInputDuplicate = errors.New("input file names must be unique per job")
+	ErrInputInUse     = errors.New("input file is used by jobs")
+
+	ErrRegistryNotFound = errors.New("registry credential not found")
+
+	ErrKeyNotFound = errors.New("trusted key not found")
+	ErrKeyInvalid  = errors.New("public key must be a PEM encoded RSA, ECDSA or Ed25519 key")
 
-	ErrJobNotFound = errors.New("job not found")
-	ErrJobCreate   = errors.New("job failed to create")
-	ErrJobConflict = errors.New("job already exists")
+	ErrAliasNotFound   = errors.New("alias not found")
+	ErrAliasNoPrevious = errors.New("alias has no previous version")
+	ErrAliasNameTaken  = errors.New("alias name is the ID of a version of the project")
 
-	ErrSpiderNotFound = errors.New("spider not found")
+	ErrEnvInvalid       = errors.New("env var name is invalid")
+	ErrEnvNotFound      = errors.New("env var not found")
+	ErrSecretNotFound   = errors.New("secret not found")
+	ErrSecretsDisabled  = errors.New("secrets store is not configured")
+	ErrSecretUnreadable = errors.New("secret could not be decrypted")
 )
 
 var ErrStatusMap = map[error]int{
+	ErrValidationFailed: http.StatusBadRequest,
+	ErrInternal:         http.StatusInternalServerError,
+
+	ErrUnauthorized:  http.StatusUnauthorized,
+	ErrForbidden:     http.StatusForbidden,
+	ErrTokenNotFound: http.StatusNotFound,
+	ErrUserNotFound:  http.StatusNotFound,
+	ErrUserConflict:  http.StatusConflict,
+	ErrTeamNotFound:  http.StatusNotFound,
+	ErrTeamConflict:  http.StatusConflict,
+	ErrRoleNotFound:  http.StatusNotFound,
+	ErrRoleSubject:   http.StatusBadRequest,
+
 	ErrProjectNotFound: http.StatusNotFound,
 	ErrProjectConflict: http.StatusConflict,
+	ErrProjectInUse:    http.StatusConflict,
 
 	ErrVersionNotFound:         http.StatusNotFound,
 	ErrVersionConflict:         http.StatusConflict,
+	ErrVersionIDInvalid:        http.StatusBadRequest,
 	ErrVersionImageTarNotFound: http.StatusBadRequest,
 	ErrVersionImageTarInvalid:  http.StatusBadRequest,
+	ErrVersionImageInvalid:     http.StatusBadRequest,
+	ErrVersionSourceInvalid:    http.StatusBadRequest,
+	ErrVersionBuildLogNotFound: http.StatusNotFound,
+	ErrVersionNotReady:         http.StatusConflict,
+	ErrVersionBusy:             http.StatusConflict,
+	ErrVersionInspectFailed:    http.StatusUnprocessableEntity,
+	ErrVersionInUse:            http.StatusConflict,
+	ErrVersionAliased:          http.StatusConflict,
+	ErrVersionDigestMismatch:   http.StatusUnprocessableEntity,
+	ErrVersionUnsigned:         http.StatusUnprocessableEntity,
+	ErrVersionSignatureInvalid: http.StatusUnprocessableEntity,
+	ErrVersionExportInvalid:    http.StatusBadRequest,
+	ErrVersionEggInvalid:       http.StatusBadRequest,
+	ErrVersionFailed:           http.StatusUnprocessableEntity,
+
+	ErrJobNotFound:    http.StatusNotFound,
+	ErrJobCreate:      http.StatusInternalServerError,
+	ErrJobConflict:    http.StatusConflict,
+	ErrJobDuplicate:   http.StatusConflict,
+	ErrJobFilterEmpty: http.StatusBadRequest,
+
+	ErrSpiderNotFound:    http.StatusNotFound,
+	ErrContainerNotFound: http.StatusNotFound,
+	ErrImageInUse:        http.StatusConflict,
+	ErrPolicyNotFound:    http.StatusNotFound,
+
+	ErrInputNotFound:  http.StatusNotFound,
+	ErrInputInvalid:   http.StatusBadRequest,
+	ErrInputDuplicate: http.StatusBadRequest,
+	ErrInputInUse:     http.StatusConflict,
+
+	ErrRegistryNotFound: http.StatusNotFound,
+
+	ErrKeyNotFound: http.StatusNotFound,
+	ErrKeyInvalid:  http.StatusBadRequest,
 
-	ErrJobNotFound: http.StatusNotFound,
-	ErrJobCreate:   http.StatusInternalServerError,
-	ErrJobConflict: http.StatusConflict,
+	ErrAliasNotFound:   http.StatusNotFound,
+	ErrAliasNoPrevious: http.StatusConflict,
+	ErrAliasNameTaken:  http.StatusConflict,
+
+	ErrEnvInvalid:       http.StatusBadRequest,
+	ErrEnvNotFound:      http.StatusNotFound,
+	ErrSecretNotFound:   http.StatusNotFound,
+	ErrSecretsDisabled:  http.StatusServiceUnavailable,
+	ErrSecretUnreadable: http.StatusInternalServerError,
+}
+
+// ErrCodeMap gives every known error a stable code clients can match on, the messages may change.
+var ErrCodeMap = map[error]string{
+	ErrValidationFailed: "VALIDATION_FAILED",
+	ErrInternal:         "INTERNAL_ERROR",
+
+	ErrUnauthorized:  "UNAUTHORIZED",
+	ErrForbidden:     "FORBIDDEN",
+	ErrTokenNotFound: "TOKEN_NOT_FOUND",
+	ErrUserNotFound:  "USER_NOT_FOUND",
+	ErrUserConflict:  "USER_CONFLICT",
+	ErrTeamNotFound:  "TEAM_NOT_FOUND",
+	ErrTeamConflict:  "TEAM_CONFLICT",
+	ErrRoleNotFound:  "ROLE_NOT_FOUND",
+	ErrRoleSubject:   "ROLE_SUBJECT_INVALID",
+
+	ErrProjectNotFound: "PROJECT_NOT_FOUND",
+	ErrProjectConflict: "PROJECT_CONFLICT",
+	ErrProjectInUse:    "PROJECT_IN_USE",
+
+	ErrVersionNotFound:         "VERSION_NOT_FOUND",
+	ErrVersionConflict:         "VERSION_CONFLICT",
+	ErrVersionIDInvalid:        "VERSION_ID_INVALID",
+	ErrVersionImageTarNotFound: "VERSION_IMAGE_TAR_NOT_FOUND",
+	ErrVersionImageTarInvalid:  "VERSION_IMAGE_TAR_INVALID",
+	ErrVersionImageInvalid:     "VERSION_IMAGE_INVALID",
+	ErrVersionSourceInvalid:    "VERSION_SOURCE_INVALID",
+	ErrVersionBuildLogNotFound: "VERSION_BUILD_LOG_NOT_FOUND",
+	ErrVersionNotReady:         "VERSION_NOT_READY",
+	ErrVersionBusy:             "VERSION_BUSY",
+	ErrVersionInspectFailed:    "VERSION_INSPECT_FAILED",
+	ErrVersionInUse:            "VERSION_IN_USE",
+	ErrVersionAliased:          "VERSION_ALIASED",
+	ErrVersionDigestMismatch:   "VERSION_DIGEST_MISMATCH",
+	ErrVersionUnsigned:         "VERSION_UNSIGNED",
+	ErrVersionSignatureInvalid: "VERSION_SIGNATURE_INVALID",
+	ErrVersionExportInvalid:    "VERSION_EXPORT_INVALID",
+	ErrVersionEggInvalid:       "VERSION_EGG_INVALID",
+	ErrVersionFailed:           "VERSION_FAILED",
+
+	ErrJobNotFound:    "JOB_NOT_FOUND",
+	ErrJobCreate:      "JOB_CREATE_FAILED",
+	ErrJobConflict:    "JOB_CONFLICT",
+	ErrJobDuplicate:   "JOB_DUPLICATE",
+	ErrJobFilterEmpty: "JOB_FILTER_EMPTY",
+
+	ErrSpiderNotFound:    "SPIDER_NOT_FOUND",
+	ErrContainerNotFound: "CONTAINER_NOT_FOUND",
+	ErrImageInUse:        "IMAGE_IN_USE",
+	ErrPolicyNotFound:    "POLICY_NOT_FOUND",
+
+	ErrInputNotFound:  "INPUT_NOT_FOUND",
+	ErrInputInvalid:   "INPUT_INVALID",
+	ErrInputDuplicate: "INPUT_DUPLICATE",
+	ErrInputInUse:     "INPUT_IN_USE",
+
+	ErrRegistryNotFound: "REGISTRY_NOT_FOUND",
+
+	ErrKeyNotFound: "KEY_NOT_FOUND",
+	ErrKeyInvalid:  "KEY_INVALID",
+
+	ErrAliasNotFound:   "ALIAS_NOT_FOUND",
+	ErrAliasNoPrevious: "ALIAS_NO_PREVIOUS",
+	ErrAliasNameTaken:  "ALIAS_NAME_TAKEN",
+
+	ErrEnvInvalid:       "ENV_INVALID",
+	ErrEnvNotFound:      "ENV_NOT_FOUND",
+	ErrSecretNotFound:   "SECRET_NOT_FOUND",
+	ErrSecretsDisabled:  "SECRETS_DISABLED",
+	ErrSecretUnreadable: "SECRET_UNREADABLE",
+}
 
-	ErrSpiderNotFound: http.StatusNotFound,
+// Known returns the error of the maps that err is, ErrInternal for anything unexpected.
+func Known(err error) error {
+	for candidate := range ErrStatusMap {
+		if errors.Is(err, candidate) {
+			return candidate
+		}
+	}
+	return ErrInternal
 }
@@ -0,0 +1,272 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"scrapyd/api/types"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Document is the part of OpenAPI 3.0 the daemon describes its API with.
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Security   []map[string][]string            `json:"security"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme"`
+}
+
+type Operation struct {
+	OperationID string                 `json:"operationId"`
+	Summary     string                 `json:"summary,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	Security    *[]map[string][]string `json:"security,omitempty"` // empty for public operations
+	Parameters  []Parameter            `json:"parameters,omitempty"`
+	RequestBody *RequestBody           `json:"requestBody,omitempty"`
+	Responses   map[string]Response    `json:"responses"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	rawType       = reflect.TypeOf(json.RawMessage{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+func New(title string, version string) *Document {
+	return &Document{
+		OpenAPI:  "3.0.3",
+		Info:     Info{Title: title, Version: version},
+		Security: []map[string][]string{{"bearerAuth": {}}, {"basicAuth": {}}},
+		Paths:    make(map[string]map[string]*Operation),
+		Components: Components{
+			Schemas: make(map[string]*Schema),
+			SecuritySchemes: map[string]SecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer"},
+				"basicAuth":  {Type: "http", Scheme: "basic"},
+			},
+		},
+	}
+}
+
+// Schema describes the value as it is encoded with the tag, json or form. Named JSON structs
+// become components referenced by their Go name, form structs are inlined.
+func (d *Document) Schema(value any, tag string) *Schema {
+	if value == nil {
+		return &Schema{}
+	}
+	return d.schema(reflect.TypeOf(value), tag)
+}
+
+func (d *Document) schema(t reflect.Type, tag string) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t, nullable = t.Elem(), true
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time", Nullable: nullable}
+	case t == rawType:
+		return &Schema{}
+	case t.Kind() == reflect.Struct && t.Implements(marshalerType):
+		// gorm.DeletedAt and friends marshal to a nullable time
+		return &Schema{Type: "string", Format: "date-time", Nullable: true}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string", Nullable: nullable}
+	case reflect.Bool:
+		return &Schema{Type: "boolean", Nullable: nullable}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Nullable: nullable}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number", Nullable: nullable}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte", Nullable: nullable}
+		}
+		return &Schema{Type: "array", Items: d.schema(t.Elem(), tag), Nullable: true}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schema(t.Elem(), tag), Nullable: true}
+	case reflect.Struct:
+		if tag != "json" || t.Name() == "" {
+			return d.object(t, tag)
+		}
+		// registered before its fields so that recursive types end up referencing themselves
+		if _, ok := d.Components.Schemas[t.Name()]; !ok {
+			d.Components.Schemas[t.Name()] = &Schema{}
+			*d.Components.Schemas[t.Name()] = *d.object(t, tag)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	}
+	return &Schema{}
+}
+
+// Fields lists the encoded fields of the struct with their schema, embedded structs are flattened.
+func (d *Document) Fields(t reflect.Type, tag string) ([]string, map[string]*Schema, []string) {
+	var names, required []string
+	properties := make(map[string]*Schema)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded, embeddedProps, embeddedRequired := d.Fields(field.Type, tag)
+			names = append(names, embedded...)
+			required = append(required, embeddedRequired...)
+			for key, schema := range embeddedProps {
+				properties[key] = schema
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := d.schema(field.Type, tag)
+		if constrain(schema, field.Tag.Get("binding")) {
+			required = append(required, name)
+		}
+		names = append(names, name)
+		properties[name] = schema
+	}
+	return names, properties, required
+}
+
+func (d *Document) object(t reflect.Type, tag string) *Schema {
+	_, properties, required := d.Fields(t, tag)
+	return &Schema{Type: "object", Properties: properties, Required: required}
+}
+
+// constrain applies the binding rules of a field to its schema and tells whether it is required,
+// rules after dive apply to the items.
+func constrain(schema *Schema, rules string) bool {
+	required := false
+	omitempty := false
+	target := schema
+	for _, rule := range strings.Split(rules, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = target == schema
+		case "omitempty":
+			omitempty = target == schema
+		case "dive":
+			if target.Items != nil {
+				target = target.Items
+			} else if target.AdditionalProperties != nil {
+				target = target.AdditionalProperties
+			}
+		case "oneof":
+			target.Enum = strings.Fields(param)
+			if omitempty && target == schema && target.Type == "string" {
+				// the zero value skips the validation, clients send it for the default
+				target.Enum = append([]string{""}, target.Enum...)
+			}
+		case "id":
+			target.Pattern = types.IDPattern
+		case "min", "gte":
+			bound(target, param, true)
+		case "max", "lte":
+			bound(target, param, false)
+		}
+	}
+	return required
+}
+
+func bound(schema *Schema, param string, lower bool) {
+	value, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+	count := int(value)
+	switch {
+	case schema.Type == "string" && lower:
+		schema.MinLength = &count
+	case schema.Type == "string":
+		schema.MaxLength = &count
+	case schema.Type == "array" && lower:
+		schema.MinItems = &count
+	case schema.Type == "array":
+		schema.MaxItems = &count
+	case schema.Type == "object":
+		// counts of map entries aren't described
+	case lower:
+		schema.Minimum = &value
+	default:
+		schema.Maximum = &value
+	}
+}
+
+// Resolve follows the reference of the schema to its component.
+func (d *Document) Resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = d.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	return schema
+}
@@ -0,0 +1,181 @@
+package openapi
+
+import (
+	"encoding/json"
+	"maps"
+	"regexp"
+	"scrapyd/api/errs"
+	"scrapyd/api/types"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ValidationError lists every way the request departs from the document.
+type ValidationError struct {
+	Details []types.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	return errs.ErrValidationFailed.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return errs.ErrValidationFailed
+}
+
+func failed(path string, rule string, message string) []types.FieldError {
+	return []types.FieldError{{Field: path, Rule: rule, Message: message}}
+}
+
+func join(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func label(path string) string {
+	if path == "" {
+		return "body"
+	}
+	return path
+}
+
+// Validate checks the JSON value, decoded with UseNumber, against the schema. The path
+// names the value in the details the way binding errors do, like jobs[0].spider.
+func (d *Document) Validate(schema *Schema, value any, path string) []types.FieldError {
+	schema = d.Resolve(schema)
+	if schema == nil || schema.Type == "" {
+		return nil
+	}
+	if value == nil {
+		if schema.Nullable {
+			return nil
+		}
+		return failed(path, "type", label(path)+" must not be null")
+	}
+
+	switch schema.Type {
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return failed(path, "type", label(path)+" must be a string")
+		}
+		return d.checkString(schema, text, path)
+	case "integer", "number":
+		number, ok := value.(json.Number)
+		if !ok {
+			return failed(path, "type", label(path)+" must be a number")
+		}
+		return d.checkNumber(schema, string(number), path)
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return failed(path, "type", label(path)+" must be a boolean")
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return failed(path, "type", label(path)+" must be an array")
+		}
+		if schema.MinItems != nil && len(items) < *schema.MinItems {
+			return failed(path, "min", label(path)+" must have at least "+strconv.Itoa(*schema.MinItems)+" items")
+		}
+		if schema.MaxItems != nil && len(items) > *schema.MaxItems {
+			return failed(path, "max", label(path)+" must have at most "+strconv.Itoa(*schema.MaxItems)+" items")
+		}
+		var details []types.FieldError
+		for i, item := range items {
+			details = append(details, d.Validate(schema.Items, item, path+"["+strconv.Itoa(i)+"]")...)
+		}
+		return details
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return failed(path, "type", label(path)+" must be an object")
+		}
+		var details []types.FieldError
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				details = append(details, failed(join(path, name), "required", join(path, name)+" is required")...)
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(object)) {
+			property, ok := schema.Properties[name]
+			if !ok {
+				property = schema.AdditionalProperties
+			}
+			if property != nil {
+				details = append(details, d.Validate(property, object[name], join(path, name))...)
+			}
+		}
+		return details
+	}
+	return nil
+}
+
+// ValidateString checks a query or form value against the schema, they all arrive as strings.
+func (d *Document) ValidateString(schema *Schema, value string, path string) []types.FieldError {
+	schema = d.Resolve(schema)
+	if schema == nil {
+		return nil
+	}
+
+	switch schema.Type {
+	case "string":
+		return d.checkString(schema, value, path)
+	case "integer", "number":
+		return d.checkNumber(schema, value, path)
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return failed(path, "type", path+" must be true or false")
+		}
+	case "array":
+		return d.ValidateString(schema.Items, value, path)
+	}
+	return nil
+}
+
+func (d *Document) checkString(schema *Schema, value string, path string) []types.FieldError {
+	if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, value) {
+		return failed(path, "oneof", label(path)+" must be one of "+strings.Join(schema.Enum, " "))
+	}
+	if schema.MinLength != nil && utf8.RuneCountInString(value) < *schema.MinLength {
+		return failed(path, "min", label(path)+" must be at least "+strconv.Itoa(*schema.MinLength)+" characters")
+	}
+	if schema.MaxLength != nil && utf8.RuneCountInString(value) > *schema.MaxLength {
+		return failed(path, "max", label(path)+" must be at most "+strconv.Itoa(*schema.MaxLength)+" characters")
+	}
+	if schema.Pattern != "" {
+		if matched, _ := regexp.MatchString(schema.Pattern, value); !matched {
+			return failed(path, "pattern", label(path)+" must match "+schema.Pattern)
+		}
+	}
+	if schema.Format == "date-time" {
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return failed(path, "format", label(path)+" must be an RFC 3339 date-time")
+		}
+	}
+	return nil
+}
+
+func (d *Document) checkNumber(schema *Schema, value string, path string) []types.FieldError {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return failed(path, "type", label(path)+" must be a number")
+	}
+	if schema.Type == "integer" {
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return failed(path, "type", label(path)+" must be an integer")
+		}
+	}
+	if schema.Minimum != nil && number < *schema.Minimum {
+		return failed(path, "min", label(path)+" must be at least "+strconv.FormatFloat(*schema.Minimum, 'f', -1, 64))
+	}
+	if schema.Maximum != nil && number > *schema.Maximum {
+		return failed(path, "max", label(path)+" must be at most "+strconv.FormatFloat(*schema.Maximum, 'f', -1, 64))
+	}
+	return nil
+}
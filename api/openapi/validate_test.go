@@ -0,0 +1,64 @@
+package openapi
+
+import (
+	"scrapyd/api/types"
+	"testing"
+)
+
+func TestValidateIDPattern(t *testing.T) {
+	doc := New("test", "1")
+	schema := doc.Schema(types.ProjectRequest{}, "json")
+	id := doc.Resolve(schema).Properties["id"]
+	if id == nil || id.Pattern != types.IDPattern {
+		t.Fatalf("id schema %+v", id)
+	}
+
+	if details := doc.ValidateString(id, "shop.v2", "id"); len(details) != 0 {
+		t.Fatalf("valid ID rejected: %v", details)
+	}
+	for _, value := range []string{"a/b", "../etc", ""} {
+		if details := doc.ValidateString(id, value, "id"); len(details) == 0 {
+			t.Errorf("%q accepted", value)
+		}
+	}
+}
+
+func TestValidateOptionalEnum(t *testing.T) {
+	doc := New("test", "1")
+	tests := []struct {
+		name     string
+		schema   *Schema
+		field    string
+		accepted []string
+		rejected []string
+	}{
+		// omitempty skips oneof for the zero value, clients leave it empty for the default
+		{name: "optional", schema: doc.Schema(types.JobRequest{}, "json"), field: "uniqueness", accepted: []string{"", "allow", "queue"}, rejected: []string{"sometimes"}},
+		{name: "optional form", schema: doc.Schema(types.AuditFilter{}, "form"), field: "outcome", accepted: []string{"", "denied"}, rejected: []string{"maybe"}},
+		{name: "required", schema: doc.Schema(types.SpiderPolicyRequest{}, "json"), field: "uniqueness", accepted: []string{"reject"}, rejected: []string{"", "sometimes"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			property := doc.Resolve(tt.schema).Properties[tt.field]
+			if property == nil {
+				t.Fatalf("no %s property", tt.field)
+			}
+			for _, value := range tt.accepted {
+				if details := doc.Validate(property, value, tt.field); len(details) != 0 {
+					t.Errorf("%q rejected: %v", value, details)
+				}
+			}
+			for _, value := range tt.rejected {
+				if details := doc.Validate(property, value, tt.field); len(details) == 0 || details[0].Rule != "oneof" {
+					t.Errorf("%q: details %v", value, details)
+				}
+			}
+		})
+	}
+
+	// the empty value is only added to the field itself, not to the items of a list
+	scopes := doc.Resolve(doc.Schema(types.TokenRequest{}, "json")).Properties["scopes"]
+	if details := doc.Validate(scopes, []any{""}, "scopes"); len(details) == 0 {
+		t.Error("empty scope accepted")
+	}
+}
@@ -1,18 +1,184 @@
 package types
 
+import "time"
+
 type ProjectRequest struct {
-	ID string `json:"id" binding:"required"`
+	ID string `json:"id" binding:"required,id"`
 }
 
 type VersionRequest struct {
-	ID        string `form:"id" json:"id" binding:"required"`
-	ProjectID string `form:"project_id" json:"project_id" binding:"required"`
+	ID        string `form:"id" json:"id" binding:"required,id"`
+	ProjectID string `form:"project_id" json:"project_id" binding:"required,id"`
+	Image     string `form:"image" json:"image"`   // registry reference, pulled instead of uploading image_tar
+	SHA256    string `form:"sha256" json:"sha256"` // expected digest of image_tar
+	Import    bool   `form:"import" json:"import"` // image_tar is a version export, its provenance is kept
+}
+
+type VersionCompareRequest struct {
+	From string `form:"from" binding:"required"`
+	To   string `form:"to" binding:"required"`
+}
+
+type ProjectDeleteRequest struct {
+	Force bool `form:"force"` // cancels the active jobs of the project
+}
+
+type VersionDeleteRequest struct {
+	Force bool `form:"force"` // cancels the active jobs of the version
+}
+
+type VersionExportRequest struct {
+	Gzip bool `form:"gzip"`
 }
 
 type JobRequest struct {
-	ID        string `json:"id"`
-	ProjectID string `json:"project_id" binding:"required"`
+	ID           string            `form:"id" json:"id"`
+	ProjectID    string            `form:"project_id" json:"project_id" binding:"required"`
+	VersionID    string            `form:"version_id" json:"version_id" binding:"required"` // version ID or alias
+	Spider       string            `form:"spider" json:"spider" binding:"required"`
+	Setting      string            `form:"setting" json:"setting"` // scrapy settings, one KEY=VALUE per line
+	Args         map[string]string `form:"-" json:"args"`
+	Uniqueness   string            `form:"uniqueness" json:"uniqueness" binding:"omitempty,oneof=allow reject queue"`
+	UniqueByArgs bool              `form:"unique_by_args" json:"unique_by_args"`
+	Inputs       []string          `form:"inputs" json:"inputs"` // IDs of previously uploaded input files
+	Env          map[string]string `form:"-" json:"env"`
+	Secrets      []string          `form:"secrets" json:"secrets"` // names of project secrets to inject
+}
+
+type JobUpdateRequest struct {
+	ID     string `json:"id" binding:"required"`
+	Status string `json:"status" binding:"required,oneof=cancel restart delete"` // action to apply
+}
+
+type JobLogRequest struct {
+	Follow bool `form:"follow,default=true"` // keeps streaming until the job ends
+}
+
+type InputRequest struct {
+	ProjectID string `form:"project_id" json:"project_id" binding:"required"`
+}
+
+type EnvVarRequest struct {
+	Value string `json:"value"`
+}
+
+type SecretRequest struct {
+	Value string `json:"value" binding:"required"`
+}
+
+type SpiderPolicyRequest struct {
+	Uniqueness   string `json:"uniqueness" binding:"required,oneof=allow reject queue"`
+	UniqueByArgs bool   `json:"unique_by_args"`
+}
+
+type JobBatchRequest struct {
+	Jobs []JobRequest `json:"jobs" binding:"required,min=1,dive"`
+}
+
+type JobFilter struct {
+	ProjectID     string   `json:"project_id"`
+	VersionID     string   `json:"version_id"`
+	Spider        string   `json:"spider"`
+	Status        []string `json:"status"`
+	OlderThanDays int      `json:"older_than_days" binding:"min=0"`
+}
+
+type JobBulkRequest struct {
+	Action string    `json:"action" binding:"required,oneof=cancel restart delete"`
+	Filter JobFilter `json:"filter"`
+}
+
+type RegistryRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type AliasRequest struct {
 	VersionID string `json:"version_id" binding:"required"`
-	Spider    string `json:"spider" binding:"required"`
-	Setting   string `json:"setting"`
+}
+
+type RetentionRequest struct {
+	RetainLast       int `json:"retain_last" binding:"min=0"`
+	RetainUnusedDays int `json:"retain_unused_days" binding:"min=0"`
+}
+
+type BuildRequest struct {
+	BaseImage string `json:"base_image"` // empty falls back to the daemon default
+}
+
+type TrustedKeyRequest struct {
+	PublicKey string `json:"public_key" binding:"required"`
+}
+
+// classic scrapyd API parameters, form encoded like the original
+
+type ScrapydProjectRequest struct {
+	Project string `form:"project" binding:"required"`
+}
+
+type ScrapydVersionRequest struct {
+	Project string `form:"project" binding:"required"`
+	Version string `form:"version" binding:"required"`
+}
+
+type ScrapydAddVersionRequest struct {
+	Project string `form:"project" binding:"required,id"`
+	Version string `form:"version" binding:"required,id"`
+}
+
+type ScrapydSpidersRequest struct {
+	Project string `form:"project" binding:"required"`
+	Version string `form:"_version"`
+}
+
+type ScrapydJobsRequest struct {
+	Project string `form:"project"`
+}
+
+type ScrapydScheduleRequest struct {
+	Project string   `form:"project" binding:"required"`
+	Spider  string   `form:"spider" binding:"required"`
+	JobID   string   `form:"jobid"`
+	Version string   `form:"_version"`
+	Setting []string `form:"setting"` // KEY=VALUE, may repeat
+}
+
+type ScrapydCancelRequest struct {
+	Project string `form:"project" binding:"required"`
+	Job     string `form:"job" binding:"required"`
+}
+
+type TokenRequest struct {
+	Name       string   `json:"name" binding:"required"`
+	Scopes     []string `json:"scopes" binding:"required,min=1,dive,oneof=read schedule deploy admin"`
+	ProjectIDs []string `json:"project_ids"` // empty for all projects
+	UserID     string   `json:"user_id"`     // admins may issue tokens for other users
+}
+
+type UserRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+	Admin    bool   `json:"admin"`
+}
+
+type TeamRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type RoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=viewer operator deployer owner"`
+}
+
+type AuditFilter struct {
+	Actor      string    `form:"actor"`
+	ProjectID  string    `form:"project_id"`
+	Action     string    `form:"action"`
+	TargetType string    `form:"target_type"`
+	TargetID   string    `form:"target_id"`
+	Outcome    string    `form:"outcome" binding:"omitempty,oneof=success denied error"`
+	RequestID  string    `form:"request_id"`
+	Since      time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until      time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit      int       `form:"limit" binding:"min=0,max=1000"`
+	BeforeID   uint      `form:"before_id"` // pages backwards from that entry
 }
@@ -1,7 +1,75 @@
 package types
 
+import (
+	"scrapyd/models"
+	"time"
+)
+
 type Response struct {
-	Status  string      `json:"status"`
-	Data    interface{} `json:"data,omitempty"`
-	Message string      `json:"message,omitempty"`
+	Status    string       `json:"status"`
+	Data      interface{}  `json:"data,omitempty"`
+	Message   string       `json:"message,omitempty"`
+	Code      string       `json:"code,omitempty"`       // stable error code, see errs.ErrCodeMap
+	Details   []FieldError `json:"details,omitempty"`    // what failed validation
+	RequestID string       `json:"request_id,omitempty"` // to look the error up in the logs
+}
+
+// FieldError is one failed check of a request field, the field is named as in the request.
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// JobResult reports the outcome for one job of a batch or bulk operation
+type JobResult struct {
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Code    string `json:"code,omitempty"` // error code, as in error responses
+	Message string `json:"message,omitempty"`
+}
+
+// TokenCreated carries the token secret, shown only this once, along with the stored token.
+type TokenCreated struct {
+	Token  string       `json:"token"`
+	Detail models.Token `json:"detail"`
+}
+
+type RetentionCandidate struct {
+	VersionID  string    `json:"version_id"`
+	Image      string    `json:"image"`
+	Reason     string    `json:"reason"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Size       int64     `json:"size"`  // size of the image
+	Freed      int64     `json:"freed"` // disk actually freed, images still shared free nothing
+}
+
+type RetentionReport struct {
+	ProjectID        string               `json:"project_id"`
+	RetainLast       int                  `json:"retain_last"`
+	RetainUnusedDays int                  `json:"retain_unused_days"`
+	Candidates       []RetentionCandidate `json:"candidates"`
+	FreedBytes       int64                `json:"freed_bytes"`
+}
+
+type Change struct {
+	Name string `json:"name"`
+	From any    `json:"from"`
+	To   any    `json:"to"`
+}
+
+type SetDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+type VersionDiff struct {
+	From           string              `json:"from"`
+	To             string              `json:"to"`
+	ScrapyVersion  *Change             `json:"scrapy_version,omitempty"`
+	PythonVersion  *Change             `json:"python_version,omitempty"`
+	Spiders        SetDiff             `json:"spiders"`
+	Settings       []Change            `json:"settings"`
+	SpiderSettings map[string][]Change `json:"spider_settings"` // custom_settings and allowed_domains changes of spiders in both versions
+	Dependencies   []Change            `json:"dependencies"`    // added packages have no from, removed ones no to
 }
@@ -0,0 +1,24 @@
+package types
+
+import (
+	"github.com/go-playground/validator/v10"
+	"regexp"
+	"strings"
+)
+
+// IDPattern is what project and version IDs are made of, they end up in file names and image tags.
+const IDPattern = `^[A-Za-z0-9._-]+$`
+
+var idPattern = regexp.MustCompile(IDPattern)
+
+// ValidID tells whether the ID is safe to use as a file name.
+func ValidID(id string) bool {
+	return idPattern.MatchString(id) && !strings.Contains(id, "..")
+}
+
+// RegisterValidations adds the binding rules of the request types to the validator: id.
+func RegisterValidations(validate *validator.Validate) {
+	validate.RegisterValidation("id", func(fl validator.FieldLevel) bool {
+		return ValidID(fl.Field().String())
+	})
+}
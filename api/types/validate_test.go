@@ -0,0 +1,25 @@
+package types
+
+import "testing"
+
+func TestValidID(t *testing.T) {
+	tests := map[string]bool{
+		"v1":             true,
+		"shop_spiders":   true,
+		"1.2.3-rc.1":     true,
+		".hidden":        true,
+		"":               false,
+		"..":             false,
+		"../../etc/cron": false,
+		"a..b":           false,
+		"a/b":            false,
+		`a\b`:            false,
+		"v 1":            false,
+		"v1\n":           false,
+	}
+	for id, want := range tests {
+		if got := ValidID(id); got != want {
+			t.Errorf("ValidID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"scrapyd/api/types"
+	"scrapyd/models"
+	"strconv"
+	"time"
+)
+
+// CreateToken returns the token secret, it can't be retrieved later.
+func (c *Client) CreateToken(ctx context.Context, request types.TokenRequest) (*types.TokenCreated, error) {
+	var created types.TokenCreated
+	if err := c.do(ctx, http.MethodPost, "/tokens", nil, request, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (c *Client) ListTokens(ctx context.Context) ([]models.Token, error) {
+	var tokens []models.Token
+	err := c.do(ctx, http.MethodGet, "/tokens", nil, nil, &tokens)
+	return tokens, err
+}
+
+func (c *Client) RevokeToken(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, path("tokens", id), nil, nil, nil)
+}
+
+func (c *Client) CreateUser(ctx context.Context, request types.UserRequest) (*models.User, error) {
+	var user models.User
+	if err := c.do(ctx, http.MethodPost, "/users", nil, request, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (c *Client) ListUsers(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	err := c.do(ctx, http.MethodGet, "/users", nil, nil, &users)
+	return users, err
+}
+
+func (c *Client) DeleteUser(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, path("users", id), nil, nil, nil)
+}
+
+func (c *Client) CreateTeam(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodPost, "/teams", nil, types.TeamRequest{Name: name}, nil)
+}
+
+func (c *Client) ListTeams(ctx context.Context) ([]models.Team, error) {
+	var teams []models.Team
+	err := c.do(ctx, http.MethodGet, "/teams", nil, nil, &teams)
+	return teams, err
+}
+
+func (c *Client) DeleteTeam(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, path("teams", name), nil, nil, nil)
+}
+
+func (c *Client) AddTeamMember(ctx context.Context, team string, userID string) error {
+	return c.do(ctx, http.MethodPut, path("teams", team, "members", userID), nil, nil, nil)
+}
+
+func (c *Client) RemoveTeamMember(ctx context.Context, team string, userID string) error {
+	return c.do(ctx, http.MethodDelete, path("teams", team, "members", userID), nil, nil, nil)
+}
+
+func auditQuery(filter *types.AuditFilter) url.Values {
+	query := url.Values{}
+	set := func(key string, value string) {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	set("actor", filter.Actor)
+	set("project_id", filter.ProjectID)
+	set("action", filter.Action)
+	set("target_type", filter.TargetType)
+	set("target_id", filter.TargetID)
+	set("outcome", filter.Outcome)
+	set("request_id", filter.RequestID)
+	if !filter.Since.IsZero() {
+		set("since", filter.Since.Format(time.RFC3339))
+	}
+	if !filter.Until.IsZero() {
+		set("until", filter.Until.Format(time.RFC3339))
+	}
+	if filter.Limit > 0 {
+		set("limit", strconv.Itoa(filter.Limit))
+	}
+	if filter.BeforeID > 0 {
+		set("before_id", strconv.FormatUint(uint64(filter.BeforeID), 10))
+	}
+	return query
+}
+
+// ListAudit pages backwards through the audit log, pass the last ID as BeforeID for the next page.
+func (c *Client) ListAudit(ctx context.Context, filter types.AuditFilter) ([]models.AuditEntry, error) {
+	var entries []models.AuditEntry
+	err := c.do(ctx, http.MethodGet, "/audit", auditQuery(&filter), nil, &entries)
+	return entries, err
+}
+
+// ExportAudit streams the matching entries as JSON lines, oldest first.
+func (c *Client) ExportAudit(ctx context.Context, filter types.AuditFilter) (io.ReadCloser, error) {
+	return c.stream(ctx, "/audit/export", auditQuery(&filter))
+}
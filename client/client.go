@@ -0,0 +1,144 @@
+// Package client talks to the scrapyd REST API. Methods return the models the daemon answers
+// with, failures come back as *Error which unwraps to the matching api/errs sentinel:
+//
+//	c := client.New("http://localhost:8081", os.Getenv("SCRAPYD_TOKEN"))
+//	job, err := c.CreateJob(ctx, &types.JobRequest{ProjectID: "shop", VersionID: "prod", Spider: "items"})
+//	if errors.Is(err, errs.ErrVersionNotReady) {
+//		...
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type Client struct {
+	BaseURL string
+	Token   string // sent as bearer token
+
+	// Username and Password log in with HTTP Basic auth instead of a token
+	Username string
+	Password string
+
+	HTTPClient *http.Client
+}
+
+func New(baseURL string, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Token:      token,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// path joins the escaped segments
+func path(segments ...string) string {
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+func (c *Client) request(ctx context.Context, method string, path string, query url.Values, contentType string, body io.Reader) (*http.Request, error) {
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	} else if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	return req, nil
+}
+
+// send runs the request, answers other than 2xx are turned into *Error.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// do sends the body as JSON and decodes the data of the response envelope into out.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body any, out any) error {
+	var reader io.Reader
+	contentType := ""
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	req, err := c.request(ctx, method, path, query, contentType, reader)
+	if err != nil {
+		return err
+	}
+	return c.decode(req, out)
+}
+
+func (c *Client) decode(req *http.Request, out any) error {
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return err
+	}
+	if len(envelope.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
+
+// stream hands the response body over as is, the caller closes it.
+func (c *Client) stream(ctx context.Context, path string, query url.Values) (io.ReadCloser, error) {
+	req, err := c.request(ctx, http.MethodGet, path, query, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (c *Client) DaemonStatus(ctx context.Context) (map[string]any, error) {
+	var status map[string]any
+	err := c.do(ctx, http.MethodGet, "/daemonstatus", nil, nil, &status)
+	return status, err
+}
@@ -0,0 +1,223 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"scrapyd/api/errs"
+	"scrapyd/api/types"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// daemon serves the handler and returns a client of it holding the token tok.
+func daemon(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return New(server.URL+"/", "tok")
+}
+
+func reply(w http.ResponseWriter, status int, response types.Response) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+func TestCreateJobRequest(t *testing.T) {
+	c := daemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/jobs" {
+			t.Errorf("%s %s", r.Method, r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer tok" {
+			t.Errorf("authorization %q", auth)
+		}
+		if contentType := r.Header.Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("content type %q", contentType)
+		}
+		var request types.JobRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+		}
+		if request.ProjectID != "shop" || request.Spider != "items" || request.Args["page"] != "2" {
+			t.Errorf("request %+v", request)
+		}
+		reply(w, http.StatusCreated, types.Response{Status: "success", Data: map[string]any{"id": "j1", "status": "pending", "spider": request.Spider}})
+	})
+
+	job, err := c.CreateJob(context.Background(), &types.JobRequest{ProjectID: "shop", VersionID: "prod", Spider: "items", Args: map[string]string{"page": "2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID != "j1" || job.Status != "pending" || job.Spider != "items" {
+		t.Fatalf("job %+v", job)
+	}
+}
+
+func TestRequestPathAndAuth(t *testing.T) {
+	c := daemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/jobs/a%20b%2Fc/logs" || r.URL.Query().Get("follow") != "false" {
+			t.Errorf("path %s query %s", r.URL.EscapedPath(), r.URL.RawQuery)
+		}
+		if username, password, ok := r.BasicAuth(); !ok || username != "ann" || password != "secret" {
+			t.Errorf("basic auth %q %q", username, password)
+		}
+		io.WriteString(w, "log line\n")
+	})
+	c.Username, c.Password = "ann", "secret"
+
+	logs, err := c.JobLogs(context.Background(), "a b/c", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logs.Close()
+	if content, _ := io.ReadAll(logs); string(content) != "log line\n" {
+		t.Fatalf("logs %q", content)
+	}
+}
+
+func TestUploadVersionMultipart(t *testing.T) {
+	c := daemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Error(err)
+			return
+		}
+		if r.FormValue("id") != "v2" || r.FormValue("project_id") != "shop" || r.FormValue("sha256") != "abc" || r.FormValue("import") != "true" {
+			t.Errorf("fields %v", r.MultipartForm.Value)
+		}
+		for name, want := range map[string]string{"image_tar": "tar bytes", "signature": "sig"} {
+			file, _, err := r.FormFile(name)
+			if err != nil {
+				t.Errorf("%s: %v", name, err)
+				continue
+			}
+			if content, _ := io.ReadAll(file); string(content) != want {
+				t.Errorf("%s %q", name, content)
+			}
+		}
+		reply(w, http.StatusAccepted, types.Response{Status: "success", Data: map[string]any{"id": "v2", "status": "loading"}})
+	})
+
+	version, err := c.UploadVersion(context.Background(), &VersionUpload{
+		ID:        "v2",
+		ProjectID: "shop",
+		ImageTar:  strings.NewReader("tar bytes"),
+		SHA256:    "abc",
+		Signature: []byte("sig"),
+		Import:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.ID != "v2" || version.Status != "loading" {
+		t.Fatalf("version %+v", version)
+	}
+}
+
+type failingReader struct{ err error }
+
+func (r failingReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestUploadVersionReaderError(t *testing.T) {
+	c := daemon(t, func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		reply(w, http.StatusAccepted, types.Response{Status: "success"})
+	})
+
+	broken := errors.New("docker save: exit status 1")
+	if _, err := c.UploadVersion(context.Background(), &VersionUpload{ID: "v2", ProjectID: "shop", ImageTar: failingReader{broken}}); !errors.Is(err, broken) {
+		t.Fatalf("err %v, want the reader error", err)
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		sentinel error
+		message  string
+	}{
+		{
+			name:     "error envelope",
+			status:   http.StatusBadRequest,
+			body:     `{"status":"error","code":"VALIDATION_FAILED","message":"request validation failed","request_id":"r1","details":[{"field":"spider","rule":"required","message":"spider is required"}]}`,
+			sentinel: errs.ErrValidationFailed,
+			message:  "request validation failed; spider is required (request r1)",
+		},
+		{
+			name:     "not found",
+			status:   http.StatusNotFound,
+			body:     `{"status":"error","code":"JOB_NOT_FOUND","message":"job not found"}`,
+			sentinel: errs.ErrJobNotFound,
+			message:  "job not found",
+		},
+		{
+			name:     "proxy",
+			status:   http.StatusUnauthorized,
+			body:     "<html>401</html>",
+			sentinel: errs.ErrUnauthorized,
+			message:  "Unauthorized",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := daemon(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			})
+
+			_, err := c.GetJob(context.Background(), "j1")
+			if !errors.Is(err, tt.sentinel) {
+				t.Fatalf("err %v, want %v", err, tt.sentinel)
+			}
+			var apiErr *Error
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+				t.Fatalf("err %#v", err)
+			}
+			if err.Error() != tt.message {
+				t.Fatalf("message %q, want %q", err.Error(), tt.message)
+			}
+		})
+	}
+}
+
+func TestWaitJob(t *testing.T) {
+	var polls atomic.Int32
+	statuses := []string{"pending", "running", "running", "failed"}
+	c := daemon(t, func(w http.ResponseWriter, r *http.Request) {
+		n := int(polls.Add(1)) - 1
+		reply(w, http.StatusOK, types.Response{Status: "success", Data: map[string]any{"id": "j1", "status": statuses[min(n, len(statuses)-1)]}})
+	})
+
+	job, err := c.WaitJob(context.Background(), "j1", time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != "failed" || polls.Load() != int32(len(statuses)) {
+		t.Fatalf("job %s after %d polls", job.Status, polls.Load())
+	}
+}
+
+func TestWaitJobDeadline(t *testing.T) {
+	c := daemon(t, func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusOK, types.Response{Status: "success", Data: map[string]any{"id": "j1", "status": "running"}})
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	// the deadline passes while waiting for the next poll
+	job, err := c.WaitJob(ctx, "j1", time.Hour)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err %v", err)
+	}
+	// the last status seen is still reported
+	if job == nil || job.Status != "running" {
+		t.Fatalf("job %+v", job)
+	}
+}
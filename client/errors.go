@@ -0,0 +1,72 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"scrapyd/api/errs"
+	"scrapyd/api/types"
+)
+
+// errsByCode maps the error codes of the API back to the api/errs sentinels
+var errsByCode = make(map[string]error)
+
+func init() {
+	for err, code := range errs.ErrCodeMap {
+		errsByCode[code] = err
+	}
+}
+
+// Error is an error answered by the daemon. It unwraps to the api/errs sentinel of its code,
+// so errors.Is(err, errs.ErrJobNotFound) works on the client side too.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Details    []types.FieldError
+	RequestID  string
+}
+
+func (e *Error) Error() string {
+	message := e.Message
+	if message == "" {
+		message = http.StatusText(e.StatusCode)
+	}
+	for _, detail := range e.Details {
+		message += "; " + detail.Message
+	}
+	if e.RequestID != "" {
+		return fmt.Sprintf("%s (request %s)", message, e.RequestID)
+	}
+	return message
+}
+
+func (e *Error) Unwrap() error {
+	return errsByCode[e.Code]
+}
+
+func responseError(resp *http.Response) error {
+	apiErr := &Error{StatusCode: resp.StatusCode, RequestID: resp.Header.Get("X-Request-ID")}
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	var response types.Response
+	if json.Unmarshal(data, &response) == nil {
+		apiErr.Code = response.Code
+		apiErr.Message = response.Message
+		apiErr.Details = response.Details
+		if response.RequestID != "" {
+			apiErr.RequestID = response.RequestID
+		}
+	}
+	// responses from before error codes, or from a proxy in between
+	if apiErr.Code == "" {
+		switch resp.StatusCode {
+		case http.StatusUnauthorized:
+			apiErr.Code = errs.ErrCodeMap[errs.ErrUnauthorized]
+		case http.StatusForbidden:
+			apiErr.Code = errs.ErrCodeMap[errs.ErrForbidden]
+		}
+	}
+	return apiErr
+}
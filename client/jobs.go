@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"scrapyd/api/types"
+	"scrapyd/models"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// TerminalStatuses are the job statuses a job never leaves.
+var TerminalStatuses = []string{"finished", "cancelled", "rejected", "failed"}
+
+func (c *Client) CreateJob(ctx context.Context, request *types.JobRequest) (*models.Job, error) {
+	var job models.Job
+	if err := c.do(ctx, http.MethodPost, "/jobs", nil, request, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CreateJobs schedules the jobs one by one, a failing job doesn't stop the others.
+func (c *Client) CreateJobs(ctx context.Context, requests []types.JobRequest) ([]types.JobResult, error) {
+	var results []types.JobResult
+	err := c.do(ctx, http.MethodPost, "/jobs/batch", nil, types.JobBatchRequest{Jobs: requests}, &results)
+	return results, err
+}
+
+func (c *Client) ListJobs(ctx context.Context) ([]models.Job, error) {
+	var jobs []models.Job
+	err := c.do(ctx, http.MethodGet, "/jobs", nil, nil, &jobs)
+	return jobs, err
+}
+
+func (c *Client) GetJob(ctx context.Context, id string) (*models.Job, error) {
+	var job models.Job
+	if err := c.do(ctx, http.MethodGet, path("jobs", id), nil, nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (c *Client) CancelJob(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPatch, "/jobs", nil, types.JobUpdateRequest{ID: id, Status: "cancel"}, nil)
+}
+
+func (c *Client) RestartJob(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPatch, "/jobs", nil, types.JobUpdateRequest{ID: id, Status: "restart"}, nil)
+}
+
+func (c *Client) DeleteJob(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, path("jobs", id), nil, nil, nil)
+}
+
+// BulkUpdateJobs cancels, restarts or deletes every job matching the filter.
+func (c *Client) BulkUpdateJobs(ctx context.Context, action string, filter types.JobFilter) ([]types.JobResult, error) {
+	var results []types.JobResult
+	err := c.do(ctx, http.MethodPost, "/jobs/bulk", nil, types.JobBulkRequest{Action: action, Filter: filter}, &results)
+	return results, err
+}
+
+// JobLogs streams the stdout and stderr of the job, follow keeps streaming while it runs.
+func (c *Client) JobLogs(ctx context.Context, id string, follow bool) (io.ReadCloser, error) {
+	return c.stream(ctx, path("jobs", id, "logs"), url.Values{"follow": {strconv.FormatBool(follow)}})
+}
+
+// WaitJob polls the job until it reaches one of the TerminalStatuses.
+func (c *Client) WaitJob(ctx context.Context, id string, interval time.Duration) (*models.Job, error) {
+	for {
+		job, err := c.GetJob(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(TerminalStatuses, job.Status) {
+			return job, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// UploadInput stores a file jobs of the project can mount by its ID.
+func (c *Client) UploadInput(ctx context.Context, projectID string, name string, content io.Reader) (*models.InputFile, error) {
+	parts := []part{
+		{name: "project_id", value: projectID},
+		{name: "file", filename: name, reader: content},
+	}
+
+	var input models.InputFile
+	if err := c.upload(ctx, "/inputs", parts, &input); err != nil {
+		return nil, err
+	}
+	return &input, nil
+}
+
+func (c *Client) ListInputs(ctx context.Context, projectID string) ([]models.InputFile, error) {
+	var inputs []models.InputFile
+	err := c.do(ctx, http.MethodGet, path("inputs", projectID), nil, nil, &inputs)
+	return inputs, err
+}
+
+func (c *Client) DeleteInput(ctx context.Context, projectID string, id string) error {
+	return c.do(ctx, http.MethodDelete, path("inputs", projectID, id), nil, nil, nil)
+}
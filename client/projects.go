@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"scrapyd/api/types"
+	"scrapyd/models"
+)
+
+func (c *Client) CreateProject(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/projects", nil, types.ProjectRequest{ID: id}, nil)
+}
+
+func (c *Client) ListProjects(ctx context.Context) ([]models.Project, error) {
+	var projects []models.Project
+	err := c.do(ctx, http.MethodGet, "/projects", nil, nil, &projects)
+	return projects, err
+}
+
+// DeleteProject removes the project along with its versions, jobs and settings,
+// force cancels its active jobs first.
+func (c *Client) DeleteProject(ctx context.Context, id string, force bool) error {
+	query := url.Values{}
+	if force {
+		query.Set("force", "true")
+	}
+	return c.do(ctx, http.MethodDelete, path("projects", id), query, nil, nil)
+}
+
+func (c *Client) SetBaseImage(ctx context.Context, projectID string, baseImage string) error {
+	return c.do(ctx, http.MethodPut, path("projects", projectID, "build"), nil, types.BuildRequest{BaseImage: baseImage}, nil)
+}
+
+func (c *Client) RetentionReport(ctx context.Context, projectID string) (*types.RetentionReport, error) {
+	var report types.RetentionReport
+	if err := c.do(ctx, http.MethodGet, path("projects", projectID, "retention"), nil, nil, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (c *Client) SetRetention(ctx context.Context, projectID string, retention types.RetentionRequest) error {
+	return c.do(ctx, http.MethodPut, path("projects", projectID, "retention"), nil, retention, nil)
+}
+
+func (c *Client) ListEnv(ctx context.Context, projectID string) ([]models.EnvVar, error) {
+	var envVars []models.EnvVar
+	err := c.do(ctx, http.MethodGet, path("projects", projectID, "env"), nil, nil, &envVars)
+	return envVars, err
+}
+
+func (c *Client) PutEnv(ctx context.Context, projectID string, name string, value string) error {
+	return c.do(ctx, http.MethodPut, path("projects", projectID, "env", name), nil, types.EnvVarRequest{Value: value}, nil)
+}
+
+func (c *Client) DeleteEnv(ctx context.Context, projectID string, name string) error {
+	return c.do(ctx, http.MethodDelete, path("projects", projectID, "env", name), nil, nil, nil)
+}
+
+// ListSecrets lists the secret names, values are never sent back.
+func (c *Client) ListSecrets(ctx context.Context, projectID string) ([]models.Secret, error) {
+	var secrets []models.Secret
+	err := c.do(ctx, http.MethodGet, path("projects", projectID, "secrets"), nil, nil, &secrets)
+	return secrets, err
+}
+
+func (c *Client) PutSecret(ctx context.Context, projectID string, name string, value string) error {
+	return c.do(ctx, http.MethodPut, path("projects", projectID, "secrets", name), nil, types.SecretRequest{Value: value}, nil)
+}
+
+func (c *Client) DeleteSecret(ctx context.Context, projectID string, name string) error {
+	return c.do(ctx, http.MethodDelete, path("projects", projectID, "secrets", name), nil, nil, nil)
+}
+
+func (c *Client) ListPolicies(ctx context.Context, projectID string) ([]models.SpiderPolicy, error) {
+	var policies []models.SpiderPolicy
+	err := c.do(ctx, http.MethodGet, path("projects", projectID, "policies"), nil, nil, &policies)
+	return policies, err
+}
+
+func (c *Client) PutPolicy(ctx context.Context, projectID string, spider string, policy types.SpiderPolicyRequest) error {
+	return c.do(ctx, http.MethodPut, path("projects", projectID, "policies", spider), nil, policy, nil)
+}
+
+func (c *Client) DeletePolicy(ctx context.Context, projectID string, spider string) error {
+	return c.do(ctx, http.MethodDelete, path("projects", projectID, "policies", spider), nil, nil, nil)
+}
+
+func (c *Client) ListRegistries(ctx context.Context, projectID string) ([]models.RegistryCredential, error) {
+	var credentials []models.RegistryCredential
+	err := c.do(ctx, http.MethodGet, path("projects", projectID, "registries"), nil, nil, &credentials)
+	return credentials, err
+}
+
+func (c *Client) PutRegistry(ctx context.Context, projectID string, registry string, credential types.RegistryRequest) error {
+	return c.do(ctx, http.MethodPut, path("projects", projectID, "registries", registry), nil, credential, nil)
+}
+
+func (c *Client) DeleteRegistry(ctx context.Context, projectID string, registry string) error {
+	return c.do(ctx, http.MethodDelete, path("projects", projectID, "registries", registry), nil, nil, nil)
+}
+
+func (c *Client) ListKeys(ctx context.Context, projectID string) ([]models.TrustedKey, error) {
+	var keys []models.TrustedKey
+	err := c.do(ctx, http.MethodGet, path("projects", projectID, "keys"), nil, nil, &keys)
+	return keys, err
+}
+
+// PutKey trusts the PEM encoded public key to sign the image tars of the project.
+func (c *Client) PutKey(ctx context.Context, projectID string, name string, publicKey string) error {
+	return c.do(ctx, http.MethodPut, path("projects", projectID, "keys", name), nil, types.TrustedKeyRequest{PublicKey: publicKey}, nil)
+}
+
+func (c *Client) DeleteKey(ctx context.Context, projectID string, name string) error {
+	return c.do(ctx, http.MethodDelete, path("projects", projectID, "keys", name), nil, nil, nil)
+}
+
+func (c *Client) ListAliases(ctx context.Context, projectID string) ([]models.Alias, error) {
+	var aliases []models.Alias
+	err := c.do(ctx, http.MethodGet, path("projects", projectID, "aliases"), nil, nil, &aliases)
+	return aliases, err
+}
+
+func (c *Client) PromoteAlias(ctx context.Context, projectID string, name string, versionID string) (*models.Alias, error) {
+	var alias models.Alias
+	if err := c.do(ctx, http.MethodPut, path("projects", projectID, "aliases", name), nil, types.AliasRequest{VersionID: versionID}, &alias); err != nil {
+		return nil, err
+	}
+	return &alias, nil
+}
+
+func (c *Client) RollbackAlias(ctx context.Context, projectID string, name string) (*models.Alias, error) {
+	var alias models.Alias
+	if err := c.do(ctx, http.MethodPost, path("projects", projectID, "aliases", name, "rollback"), nil, nil, &alias); err != nil {
+		return nil, err
+	}
+	return &alias, nil
+}
+
+func (c *Client) DeleteAlias(ctx context.Context, projectID string, name string) error {
+	return c.do(ctx, http.MethodDelete, path("projects", projectID, "aliases", name), nil, nil, nil)
+}
+
+func (c *Client) AliasHistory(ctx context.Context, projectID string, name string) ([]models.AliasChange, error) {
+	var changes []models.AliasChange
+	err := c.do(ctx, http.MethodGet, path("projects", projectID, "aliases", name, "history"), nil, nil, &changes)
+	return changes, err
+}
+
+func (c *Client) ListRoles(ctx context.Context, projectID string) ([]models.ProjectRole, error) {
+	var roles []models.ProjectRole
+	err := c.do(ctx, http.MethodGet, path("projects", projectID, "roles"), nil, nil, &roles)
+	return roles, err
+}
+
+// PutRole gives the user or team, subjectType being user or team, the role on the project.
+func (c *Client) PutRole(ctx context.Context, projectID string, subjectType string, subjectID string, role string) error {
+	return c.do(ctx, http.MethodPut, path("projects", projectID, "roles", subjectType, subjectID), nil, types.RoleRequest{Role: role}, nil)
+}
+
+func (c *Client) DeleteRole(ctx context.Context, projectID string, subjectType string, subjectID string) error {
+	return c.do(ctx, http.MethodDelete, path("projects", projectID, "roles", subjectType, subjectID), nil, nil, nil)
+}
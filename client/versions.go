@@ -0,0 +1,190 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"scrapyd/api/errs"
+	"scrapyd/api/types"
+	"scrapyd/models"
+	"strconv"
+	"time"
+)
+
+// VersionUpload is an image tar, as written by docker save, to deploy as a new version.
+type VersionUpload struct {
+	ID        string
+	ProjectID string
+	ImageTar  io.Reader
+	SHA256    string // expected digest of the tar, checked before it is loaded
+	Signature []byte // signature of the tar digest by a key the project trusts
+	Import    bool   // the tar is a version export, its provenance is kept
+}
+
+type part struct {
+	name     string
+	value    string
+	filename string
+	reader   io.Reader
+}
+
+// upload streams the multipart form so that image tars are never held in memory.
+func (c *Client) upload(ctx context.Context, path string, parts []part, out any) error {
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	writer := multipart.NewWriter(pw)
+
+	go func() {
+		pw.CloseWithError(writeParts(writer, parts))
+	}()
+
+	req, err := c.request(ctx, http.MethodPost, path, nil, writer.FormDataContentType(), pr)
+	if err != nil {
+		return err
+	}
+	return c.decode(req, out)
+}
+
+func writeParts(writer *multipart.Writer, parts []part) error {
+	for _, p := range parts {
+		if p.reader == nil {
+			if err := writer.WriteField(p.name, p.value); err != nil {
+				return err
+			}
+			continue
+		}
+		file, err := writer.CreateFormFile(p.name, p.filename)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(file, p.reader); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// UploadVersion uploads the image tar, the version becomes ready once loaded and inspected.
+func (c *Client) UploadVersion(ctx context.Context, upload *VersionUpload) (*models.Version, error) {
+	parts := []part{
+		{name: "id", value: upload.ID},
+		{name: "project_id", value: upload.ProjectID},
+	}
+	if upload.SHA256 != "" {
+		parts = append(parts, part{name: "sha256", value: upload.SHA256})
+	}
+	if upload.Import {
+		parts = append(parts, part{name: "import", value: "true"})
+	}
+	if upload.Signature != nil {
+		parts = append(parts, part{name: "signature", filename: "signature", reader: bytes.NewReader(upload.Signature)})
+	}
+	parts = append(parts, part{name: "image_tar", filename: upload.ID + ".tar", reader: upload.ImageTar})
+
+	var version models.Version
+	if err := c.upload(ctx, "/versions", parts, &version); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// UploadSource uploads a zipped scrapy project, the daemon builds its image.
+func (c *Client) UploadSource(ctx context.Context, projectID string, id string, sourceZip io.Reader) (*models.Version, error) {
+	parts := []part{
+		{name: "id", value: id},
+		{name: "project_id", value: projectID},
+		{name: "source_zip", filename: id + ".zip", reader: sourceZip},
+	}
+
+	var version models.Version
+	if err := c.upload(ctx, "/versions", parts, &version); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// PullVersion has the daemon pull the image reference from its registry.
+func (c *Client) PullVersion(ctx context.Context, projectID string, id string, image string) (*models.Version, error) {
+	var version models.Version
+	request := types.VersionRequest{ID: id, ProjectID: projectID, Image: image}
+	if err := c.do(ctx, http.MethodPost, "/versions", nil, request, &version); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func (c *Client) ListVersions(ctx context.Context, projectID string) ([]models.Version, error) {
+	var versions []models.Version
+	err := c.do(ctx, http.MethodGet, path("versions", projectID), nil, nil, &versions)
+	return versions, err
+}
+
+func (c *Client) GetVersion(ctx context.Context, projectID string, id string) (*models.Version, error) {
+	versions, err := c.ListVersions(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range versions {
+		if version.ID == id {
+			return &version, nil
+		}
+	}
+	return nil, &Error{StatusCode: http.StatusNotFound, Code: errs.ErrCodeMap[errs.ErrVersionNotFound], Message: errs.ErrVersionNotFound.Error()}
+}
+
+// WaitVersion polls the version until it is ready, a failed version returns errs.ErrVersionFailed.
+func (c *Client) WaitVersion(ctx context.Context, projectID string, id string, interval time.Duration) (*models.Version, error) {
+	for {
+		version, err := c.GetVersion(ctx, projectID, id)
+		if err != nil {
+			return nil, err
+		}
+		switch version.Status {
+		case "ready":
+			return version, nil
+		case "failed":
+			return version, fmt.Errorf("%w: %s", errs.ErrVersionFailed, version.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			return version, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// DeleteVersion removes the version, force cancels its active jobs first.
+func (c *Client) DeleteVersion(ctx context.Context, projectID string, id string, force bool) error {
+	query := url.Values{}
+	if force {
+		query.Set("force", "true")
+	}
+	return c.do(ctx, http.MethodDelete, path("versions", projectID, id), query, nil, nil)
+}
+
+func (c *Client) CompareVersions(ctx context.Context, projectID string, from string, to string) (*types.VersionDiff, error) {
+	var diff types.VersionDiff
+	query := url.Values{"from": {from}, "to": {to}}
+	if err := c.do(ctx, http.MethodGet, path("versions", projectID, "compare"), query, nil, &diff); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+func (c *Client) InspectVersion(ctx context.Context, projectID string, id string) error {
+	return c.do(ctx, http.MethodPost, path("versions", projectID, id, "inspect"), nil, nil, nil)
+}
+
+// ExportVersion streams the version image along with its metadata, ready for UploadVersion with Import.
+func (c *Client) ExportVersion(ctx context.Context, projectID string, id string, gzip bool) (io.ReadCloser, error) {
+	return c.stream(ctx, path("versions", projectID, id, "image"), url.Values{"gzip": {strconv.FormatBool(gzip)}})
+}
+
+func (c *Client) BuildLogs(ctx context.Context, projectID string, id string) (io.ReadCloser, error) {
+	return c.stream(ctx, path("versions", projectID, id, "build-logs"), nil)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"scrapyd/api/errs"
+	"scrapyd/client"
+	"scrapyd/models"
+	"time"
+)
+
+func deploy(ctx context.Context, a *app, args []string) error {
+	flags := newFlags("deploy", a.stderr)
+	projectID := flags.String("project", "", "project ID")
+	id := flags.String("version", "", "version ID")
+	save := flags.String("save", "", "local docker image to save and upload")
+	file := flags.String("file", "", "image tar to upload, - reads it from stdin")
+	image := flags.String("image", "", "registry reference for the daemon to pull")
+	wait := flags.Bool("wait", false, "wait until the version is ready")
+	promote := flags.String("promote", "", "point the alias at the version once it is ready, implies -wait")
+	timeout := flags.Duration("timeout", 30*time.Minute, "how long to wait for the version")
+	positional, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usage(flags, "unexpected argument %q", positional[0])
+	}
+	if *projectID == "" || *id == "" {
+		return usage(flags, "-project and -version are required")
+	}
+	sources := 0
+	for _, source := range []string{*save, *file, *image} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return usage(flags, "expected exactly one of -save, -file or -image")
+	}
+
+	var version *models.Version
+	switch {
+	case *image != "":
+		version, err = a.client.PullVersion(ctx, *projectID, *id, *image)
+	case *file != "":
+		version, err = a.uploadFile(ctx, *projectID, *id, *file)
+	default:
+		version, err = a.uploadImage(ctx, *projectID, *id, *save)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *wait || *promote != "" {
+		waitCtx, cancel := context.WithTimeout(ctx, *timeout)
+		defer cancel()
+		version, err = a.client.WaitVersion(waitCtx, *projectID, *id, pollInterval)
+		if errors.Is(err, errs.ErrVersionFailed) {
+			return &failure{message: fmt.Sprintf("version %s: %s", *id, version.Error)}
+		}
+		// the upload was accepted, a version gone since then failed verification and was deleted
+		if errors.Is(err, errs.ErrVersionNotFound) {
+			return &failure{message: fmt.Sprintf("version %s was removed after its upload, it failed verification or was deleted", *id)}
+		}
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return &failure{message: fmt.Sprintf("version %s was not ready within %s", *id, *timeout)}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if *promote != "" {
+		if _, err := a.client.PromoteAlias(ctx, *projectID, *promote, *id); err != nil {
+			return err
+		}
+	}
+	return a.render(version, versionHeader, [][]string{versionRow(version)})
+}
+
+func (a *app) uploadFile(ctx context.Context, projectID string, id string, path string) (*models.Version, error) {
+	var tar io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		tar = file
+	}
+	return a.client.UploadVersion(ctx, &client.VersionUpload{ID: id, ProjectID: projectID, ImageTar: tar})
+}
+
+// uploadImage streams docker save straight into the upload,
+// a failing save breaks the upload instead of sending a truncated tar.
+func (a *app) uploadImage(ctx context.Context, projectID string, id string, image string) (*models.Version, error) {
+	saveCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tar, pw := io.Pipe()
+	cmd := exec.CommandContext(saveCtx, "docker", "save", image)
+	cmd.Stdout = pw
+	cmd.Stderr = a.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("docker save %s: %w", image, err)
+	}
+	saved := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		if err != nil {
+			err = fmt.Errorf("docker save %s: %w", image, err)
+		}
+		pw.CloseWithError(err)
+		saved <- err
+	}()
+
+	version, err := a.client.UploadVersion(ctx, &client.VersionUpload{ID: id, ProjectID: projectID, ImageTar: tar})
+	if err != nil {
+		// docker would block on a pipe nobody reads anymore
+		cancel()
+	}
+	tar.Close()
+	if saveErr := <-saved; err == nil && saveErr != nil {
+		return nil, saveErr
+	}
+	return version, err
+}
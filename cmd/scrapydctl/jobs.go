@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"scrapyd/api/types"
+	"scrapyd/client"
+	"scrapyd/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+func schedule(ctx context.Context, a *app, args []string) error {
+	flags := newFlags("schedule", a.stderr)
+	projectID := flags.String("project", "", "project ID")
+	versionID := flags.String("version", "", "version ID or alias")
+	id := flags.String("id", "", "job ID, generated when empty")
+	uniqueness := flags.String("uniqueness", "", "what to do when the same crawl is already active: allow, reject or queue")
+	spiderArgs := pairs{}
+	flags.Var(spiderArgs, "a", "spider argument `KEY=VALUE`, may repeat")
+	env := pairs{}
+	flags.Var(env, "e", "environment variable `KEY=VALUE`, may repeat")
+	var settings, secrets, inputs list
+	flags.Var(&settings, "s", "scrapy setting `KEY=VALUE`, may repeat")
+	flags.Var(&secrets, "secret", "project secret `NAME` to inject, may repeat")
+	flags.Var(&inputs, "input", "input file `ID` to mount, may repeat")
+	wait := flags.Bool("wait", false, "wait for the crawl to end, exit 3 unless it finished with exit code 0")
+	follow := flags.Bool("follow", false, "print the logs while waiting, implies -wait")
+	timeout := flags.Duration("timeout", 0, "how long to wait for the crawl, 0 waits forever")
+	positional, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usage(flags, "expected a spider")
+	}
+	if *projectID == "" || *versionID == "" {
+		return usage(flags, "-project and -version are required")
+	}
+	for _, setting := range settings {
+		if !strings.Contains(setting, "=") {
+			return usage(flags, "setting %q: expected KEY=VALUE", setting)
+		}
+	}
+
+	job, err := a.client.CreateJob(ctx, &types.JobRequest{
+		ID:         *id,
+		ProjectID:  *projectID,
+		VersionID:  *versionID,
+		Spider:     positional[0],
+		Setting:    strings.Join(settings, "\n"),
+		Args:       spiderArgs,
+		Uniqueness: *uniqueness,
+		Inputs:     inputs,
+		Env:        env,
+		Secrets:    secrets,
+	})
+	if err != nil {
+		return err
+	}
+	if !*wait && !*follow {
+		return a.render(job, jobHeader, [][]string{jobRow(job)})
+	}
+
+	waitCtx := ctx
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	fmt.Fprintf(a.stderr, "job %s %s\n", job.ID, job.Status)
+	if *follow {
+		// logs go to stderr, stdout keeps the job for -o json
+		if err := a.followJob(waitCtx, job.ID, a.stderr); err != nil {
+			fmt.Fprintln(a.stderr, "logs:", err)
+		}
+	}
+	done, err := a.client.WaitJob(waitCtx, job.ID, pollInterval)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return &failure{message: fmt.Sprintf("job %s did not end within %s", job.ID, *timeout)}
+	}
+	if err != nil {
+		return err
+	}
+	if err := a.render(done, jobHeader, [][]string{jobRow(done)}); err != nil {
+		return err
+	}
+	return jobOutcome(done)
+}
+
+// jobOutcome fails unless the crawl finished with exit code 0.
+func jobOutcome(job *models.Job) error {
+	if job.Status != "finished" {
+		return &failure{message: fmt.Sprintf("job %s %s", job.ID, job.Status)}
+	}
+	if job.ExitCode != 0 {
+		return &failure{message: fmt.Sprintf("job %s exited with code %d", job.ID, job.ExitCode)}
+	}
+	return nil
+}
+
+// followJob waits for the crawl container to start, then streams its logs until it ends.
+func (a *app) followJob(ctx context.Context, id string, w io.Writer) error {
+	for {
+		job, err := a.client.GetJob(ctx, id)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(client.TerminalStatuses, job.Status) {
+			return nil
+		}
+		if job.Status == "running" {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+
+	logs, err := a.client.JobLogs(ctx, id, true)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+	_, err = io.Copy(w, logs)
+	return err
+}
+
+func jobsList(ctx context.Context, a *app, args []string) error {
+	flags := newFlags("jobs ls", a.stderr)
+	projectID := flags.String("project", "", "only the jobs of the project")
+	status := flags.String("status", "", "only the jobs with the status")
+	spider := flags.String("spider", "", "only the jobs of the spider")
+	positional, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usage(flags, "unexpected argument %q", positional[0])
+	}
+
+	jobs, err := a.client.ListJobs(ctx)
+	if err != nil {
+		return err
+	}
+	jobs = slices.DeleteFunc(jobs, func(job models.Job) bool {
+		return (*projectID != "" && job.ProjectID != *projectID) ||
+			(*status != "" && job.Status != *status) ||
+			(*spider != "" && job.Spider != *spider)
+	})
+
+	rows := make([][]string, 0, len(jobs))
+	for i := range jobs {
+		rows = append(rows, jobRow(&jobs[i]))
+	}
+	return a.render(jobs, jobHeader, rows)
+}
+
+func jobsCancel(ctx context.Context, a *app, args []string) error {
+	flags := newFlags("jobs cancel", a.stderr)
+	ids, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return usage(flags, "expected at least one job")
+	}
+
+	// cancel as many as possible, the exit code still reports the ones that failed
+	var failed []error
+	for _, id := range ids {
+		if err := a.client.CancelJob(ctx, id); err != nil {
+			failed = append(failed, fmt.Errorf("job %s: %w", id, err))
+			continue
+		}
+		fmt.Fprintf(a.stderr, "job %s cancelled\n", id)
+	}
+	return errors.Join(failed...)
+}
+
+func logs(ctx context.Context, a *app, args []string) error {
+	flags := newFlags("logs", a.stderr)
+	follow := flags.Bool("f", false, "keep printing the logs until the job ends")
+	positional, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usage(flags, "expected a job")
+	}
+
+	if *follow {
+		err = a.followJob(ctx, positional[0], a.stdout)
+	} else {
+		var logs io.ReadCloser
+		logs, err = a.client.JobLogs(ctx, positional[0], false)
+		if err == nil {
+			_, err = io.Copy(a.stdout, logs)
+			logs.Close()
+		}
+	}
+	// interrupting -f is the usual way out
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
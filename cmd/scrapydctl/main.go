@@ -0,0 +1,227 @@
+// Command scrapydctl operates a scrapyd daemon from a shell or a CI pipeline:
+//
+//	scrapydctl profile set prod -url https://scrapyd.example.com -token "$TOKEN"
+//	scrapydctl deploy -project shop -version v42 -save shop:latest -promote prod
+//	scrapydctl schedule -project shop -version prod -a category=books -wait items
+//
+// It exits with 0 on success, 1 when the daemon can't be reached or answers with an error,
+// 2 on a command line mistake and 3 when a waited for crawl or version ends unsuccessfully.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"scrapyd/client"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	codeOK     = 0
+	codeError  = 1
+	codeUsage  = 2
+	codeFailed = 3
+)
+
+const pollInterval = 2 * time.Second
+
+// errUsage is returned once the usage of the command was printed
+var errUsage = errors.New("usage")
+
+// failure is a crawl or a version that ended unsuccessfully
+type failure struct {
+	message string
+}
+
+func (f *failure) Error() string {
+	return f.message
+}
+
+type app struct {
+	client *client.Client
+	output string // table or json
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	local   bool // doesn't talk to the daemon
+	run     func(ctx context.Context, a *app, args []string) error
+}
+
+var commands []command
+
+// commands are set up in init, their flag sets look the usage up in the table
+func init() {
+	commands = []command{
+		{name: "deploy", args: "-project ID -version ID (-save IMAGE | -file TAR | -image REF)", summary: "upload or pull a new version", run: deploy},
+		{name: "schedule", args: "-project ID -version ID [-a KEY=VALUE]... [-s KEY=VALUE]... [-wait] SPIDER", summary: "schedule a crawl", run: schedule},
+		{name: "jobs ls", args: "[-project ID] [-status STATUS] [-spider NAME]", summary: "list jobs", run: jobsList},
+		{name: "jobs cancel", args: "JOB...", summary: "cancel jobs", run: jobsCancel},
+		{name: "logs", args: "[-f] JOB", summary: "print the logs of a job", run: logs},
+		{name: "versions ls", args: "PROJECT", summary: "list the versions of a project", run: versionsList},
+		{name: "status", summary: "show the daemon status", run: status},
+		{name: "profile ls", summary: "list the daemon profiles", local: true, run: profileList},
+		{name: "profile set", args: "NAME [-url URL] [-token TOKEN]", summary: "add or update a daemon profile", local: true, run: profileSet},
+		{name: "profile use", args: "NAME", summary: "make the profile the default", local: true, run: profileUse},
+		{name: "profile rm", args: "NAME", summary: "remove a daemon profile", local: true, run: profileRemove},
+	}
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("scrapydctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	profileName := flags.String("profile", os.Getenv("SCRAPYD_PROFILE"), "daemon profile to use instead of the default one")
+	baseURL := flags.String("url", os.Getenv("SCRAPYD_URL"), "daemon URL, overrides the profile")
+	token := flags.String("token", os.Getenv("SCRAPYD_TOKEN"), "API token, overrides the profile")
+	output := flags.String("o", "table", "output format, table or json")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: scrapydctl [flags] <command> [args]\n\ncommands:\n")
+		for _, cmd := range commands {
+			fmt.Fprintf(stderr, "  %-12s %s\n", cmd.name, cmd.summary)
+		}
+		fmt.Fprintf(stderr, "\nflags:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitCode(stderr, err)
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(stderr, "unknown output format %q, use table or json\n", *output)
+		return codeUsage
+	}
+
+	cmd, rest := lookup(flags.Args())
+	if cmd == nil {
+		flags.Usage()
+		return codeUsage
+	}
+
+	a := &app{output: *output, stdout: stdout, stderr: stderr}
+	if !cmd.local {
+		profile, err := resolveProfile(*profileName)
+		if err != nil {
+			return exitCode(stderr, err)
+		}
+		if *baseURL != "" {
+			profile.URL = *baseURL
+		}
+		if *token != "" {
+			profile.Token = *token
+		}
+		a.client = client.New(profile.URL, profile.Token)
+	}
+	return exitCode(stderr, cmd.run(ctx, a, rest))
+}
+
+// lookup finds the command named by the leading arguments, subcommands like "jobs ls" take two.
+func lookup(args []string) (*command, []string) {
+	for i := range commands {
+		words := strings.Fields(commands[i].name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == commands[i].name {
+			return &commands[i], args[len(words):]
+		}
+	}
+	return nil, nil
+}
+
+func exitCode(stderr io.Writer, err error) int {
+	var f *failure
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return codeOK
+	case errors.Is(err, errUsage):
+		return codeUsage
+	case errors.As(err, &f):
+		fmt.Fprintln(stderr, "failed:", err)
+		return codeFailed
+	default:
+		fmt.Fprintln(stderr, "error:", err)
+		return codeError
+	}
+}
+
+// newFlags returns the flag set of the command, parse errors print its usage.
+func newFlags(name string, stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet("scrapydctl "+name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		for _, cmd := range commands {
+			if cmd.name == name {
+				fmt.Fprintf(stderr, "usage: scrapydctl %s %s\n", cmd.name, cmd.args)
+			}
+		}
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parse returns the positional arguments, they may come before, between or after the flags.
+func parse(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, errUsage
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// usage reports a command line mistake the flag package can't catch.
+func usage(flags *flag.FlagSet, format string, args ...any) error {
+	fmt.Fprintf(flags.Output(), format+"\n", args...)
+	flags.Usage()
+	return errUsage
+}
+
+// pairs collects repeated KEY=VALUE flags
+type pairs map[string]string
+
+func (p pairs) String() string {
+	return ""
+}
+
+func (p pairs) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return errors.New("expected KEY=VALUE")
+	}
+	p[key] = val
+	return nil
+}
+
+// list collects repeated flags
+type list []string
+
+func (l *list) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *list) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
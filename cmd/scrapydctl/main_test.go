@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"scrapyd/api/types"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// daemon serves the handler and returns the flags pointing scrapydctl at it,
+// the profile file stays in the test directory.
+func daemon(t *testing.T, handler http.HandlerFunc) []string {
+	t.Helper()
+	t.Setenv("SCRAPYDCTL_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return []string{"-url", server.URL, "-token", "tok"}
+}
+
+func reply(w http.ResponseWriter, status int, response types.Response) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+func runArgs(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestExitCodes(t *testing.T) {
+	// the job finishes as soon as it is created, so -wait doesn't poll
+	finished := map[string]any{"id": "j1", "status": "finished", "exit_code": 0}
+	tests := []struct {
+		name    string
+		args    []string
+		handler http.HandlerFunc
+		code    int
+	}{
+		{
+			name: "status",
+			args: []string{"status"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				reply(w, http.StatusOK, types.Response{Status: "success", Data: map[string]any{"running": 1}})
+			},
+			code: codeOK,
+		},
+		{
+			name: "help",
+			args: []string{"status", "-h"},
+			code: codeOK,
+		},
+		{
+			name: "daemon error",
+			args: []string{"jobs", "cancel", "j1"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				reply(w, http.StatusNotFound, types.Response{Status: "error", Code: "JOB_NOT_FOUND", Message: "job not found"})
+			},
+			code: codeError,
+		},
+		{name: "no command", args: nil, code: codeUsage},
+		{name: "unknown command", args: []string{"crawl"}, code: codeUsage},
+		{name: "unknown flag", args: []string{"status", "-x"}, code: codeUsage},
+		{name: "unknown output", args: []string{"-o", "yaml", "status"}, code: codeUsage},
+		{name: "missing spider", args: []string{"schedule", "-project", "shop", "-version", "v1"}, code: codeUsage},
+		{name: "missing version", args: []string{"deploy", "-project", "shop", "-image", "shop:v2"}, code: codeUsage},
+		{
+			name: "finished",
+			args: []string{"schedule", "-project", "shop", "-version", "v1", "-wait", "items"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				reply(w, http.StatusOK, types.Response{Status: "success", Data: finished})
+			},
+			code: codeOK,
+		},
+		{
+			name: "nonzero exit code",
+			args: []string{"schedule", "-project", "shop", "-version", "v1", "-wait", "items"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				reply(w, http.StatusOK, types.Response{Status: "success", Data: map[string]any{"id": "j1", "status": "finished", "exit_code": 1}})
+			},
+			code: codeFailed,
+		},
+		{
+			name: "cancelled",
+			args: []string{"schedule", "-project", "shop", "-version", "v1", "-wait", "items"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				reply(w, http.StatusOK, types.Response{Status: "success", Data: map[string]any{"id": "j1", "status": "cancelled"}})
+			},
+			code: codeFailed,
+		},
+		{
+			name: "failed version",
+			args: []string{"deploy", "-project", "shop", "-version", "v2", "-image", "shop:v2", "-wait"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				version := map[string]any{"id": "v2", "status": "failed", "error": "no spiders"}
+				if r.Method == http.MethodGet {
+					reply(w, http.StatusOK, types.Response{Status: "success", Data: []any{version}})
+					return
+				}
+				reply(w, http.StatusAccepted, types.Response{Status: "success", Data: version})
+			},
+			code: codeFailed,
+		},
+		{
+			name: "version removed",
+			args: []string{"deploy", "-project", "shop", "-version", "v2", "-image", "shop:v2", "-promote", "prod"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					// deleted by the daemon once its verification failed
+					reply(w, http.StatusOK, types.Response{Status: "success", Data: []any{}})
+				case http.MethodPost:
+					reply(w, http.StatusAccepted, types.Response{Status: "success", Data: map[string]any{"id": "v2", "status": "pulling"}})
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+			},
+			code: codeFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := tt.handler
+			if handler == nil {
+				handler = func(w http.ResponseWriter, r *http.Request) {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+			}
+			args := append(daemon(t, handler), tt.args...)
+
+			if code, _, stderr := runArgs(t, args...); code != tt.code {
+				t.Fatalf("exit code %d, want %d: %s", code, tt.code, stderr)
+			}
+		})
+	}
+}
+
+func TestExitCodeUnreachable(t *testing.T) {
+	t.Setenv("SCRAPYDCTL_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	if code, _, stderr := runArgs(t, "-url", server.URL, "status"); code != codeError {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+}
+
+func TestRunJSONOutput(t *testing.T) {
+	args := daemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/daemonstatus" || r.Header.Get("Authorization") != "Bearer tok" {
+			t.Errorf("%s %s %q", r.Method, r.URL.Path, r.Header.Get("Authorization"))
+		}
+		reply(w, http.StatusOK, types.Response{Status: "success", Data: map[string]any{"running": 1}})
+	})
+
+	code, stdout, stderr := runArgs(t, append(args, "-o", "json", "status")...)
+	if code != codeOK {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	var status map[string]any
+	if err := json.Unmarshal([]byte(stdout), &status); err != nil || status["running"] != float64(1) {
+		t.Fatalf("stdout %q: %v", stdout, err)
+	}
+}
+
+// fakeDocker puts a docker on the PATH that runs the shell script.
+func fakeDocker(t *testing.T, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script as docker")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "docker"), []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestDeploySave(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		code   int
+		stored bool
+	}{
+		{name: "saved", script: "printf 'image tar'", code: codeOK, stored: true},
+		{name: "save fails", script: "printf 'truncated'; echo 'no such image' >&2; exit 1", code: codeError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeDocker(t, tt.script)
+			var stored atomic.Bool
+			args := daemon(t, func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseMultipartForm(1 << 20); err != nil {
+					reply(w, http.StatusBadRequest, types.Response{Status: "error", Message: err.Error()})
+					return
+				}
+				file, _, err := r.FormFile("image_tar")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if content, _ := io.ReadAll(file); string(content) != "image tar" {
+					t.Errorf("image tar %q", content)
+				}
+				stored.Store(true)
+				reply(w, http.StatusAccepted, types.Response{Status: "success", Data: map[string]any{"id": "v2", "status": "loading"}})
+			})
+
+			code, _, stderr := runArgs(t, append(args, "deploy", "-project", "shop", "-version", "v2", "-save", "shop:latest")...)
+			if code != tt.code {
+				t.Fatalf("exit code %d, want %d: %s", code, tt.code, stderr)
+			}
+			if stored.Load() != tt.stored {
+				t.Fatalf("stored %v, want %v", stored.Load(), tt.stored)
+			}
+			if !tt.stored && !strings.Contains(stderr, "docker save shop:latest") {
+				t.Fatalf("stderr %q", stderr)
+			}
+		})
+	}
+}
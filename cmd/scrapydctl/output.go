@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"scrapyd/models"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// render prints value as indented JSON with -o json, otherwise the rows as an aligned table.
+func (a *app) render(value any, header []string, rows [][]string) error {
+	if a.output == "json" {
+		encoder := json.NewEncoder(a.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+var jobHeader = []string{"ID", "PROJECT", "VERSION", "SPIDER", "STATUS", "EXIT", "CREATED"}
+
+func jobRow(job *models.Job) []string {
+	version := job.VersionID
+	if job.Alias != "" {
+		version = fmt.Sprintf("%s (%s)", job.VersionID, job.Alias)
+	}
+	exitCode := "-"
+	if job.Status == "finished" {
+		exitCode = fmt.Sprint(job.ExitCode)
+	}
+	return []string{job.ID, job.ProjectID, version, job.Spider, job.Status, exitCode, timestamp(job.CreatedAt)}
+}
+
+var versionHeader = []string{"ID", "STATUS", "SOURCE", "SPIDERS", "CREATED"}
+
+func versionRow(version *models.Version) []string {
+	status := version.Status
+	if version.Status != "ready" && version.Status != "failed" && version.Progress > 0 {
+		status = fmt.Sprintf("%s %d%%", version.Status, version.Progress)
+	}
+	return []string{version.ID, status, version.Source, strings.Join(version.Spiders, ","), timestamp(version.CreatedAt)}
+}
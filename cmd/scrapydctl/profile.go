@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const defaultURL = "http://localhost:8081"
+
+type profile struct {
+	URL   string `json:"url"`
+	Token string `json:"token,omitempty"`
+}
+
+// config is the profile file, by default in the user config directory.
+type config struct {
+	Current  string              `json:"current,omitempty"`
+	Profiles map[string]*profile `json:"profiles"`
+}
+
+func configPath() (string, error) {
+	if path := os.Getenv("SCRAPYDCTL_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "scrapydctl", "config.json"), nil
+}
+
+func loadConfig() (*config, error) {
+	cfg := &config{Profiles: make(map[string]*profile)}
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = make(map[string]*profile)
+	}
+	return cfg, nil
+}
+
+// save keeps the file private to the user, it holds tokens.
+func (cfg *config) save() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// resolveProfile returns the named profile, the current one when name is empty,
+// or the local daemon when there are no profiles at all.
+func resolveProfile(name string) (profile, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return profile{}, err
+	}
+	if name == "" {
+		name = cfg.Current
+	}
+	if name == "" {
+		return profile{URL: defaultURL}, nil
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return profile{}, fmt.Errorf("unknown profile %q", name)
+	}
+	return *p, nil
+}
+
+func profileList(ctx context.Context, a *app, args []string) error {
+	flags := newFlags("profile ls", a.stderr)
+	if _, err := parse(flags, args); err != nil {
+		return err
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	var rows [][]string
+	for _, name := range slices.Sorted(maps.Keys(cfg.Profiles)) {
+		current := ""
+		if name == cfg.Current {
+			current = "*"
+		}
+		rows = append(rows, []string{current, name, cfg.Profiles[name].URL})
+	}
+	// tokens stay out of the output, JSON included
+	names := make(map[string]string)
+	for name, p := range cfg.Profiles {
+		names[name] = p.URL
+	}
+	return a.render(map[string]any{"current": cfg.Current, "profiles": names}, []string{"CURRENT", "NAME", "URL"}, rows)
+}
+
+func profileSet(ctx context.Context, a *app, args []string) error {
+	flags := newFlags("profile set", a.stderr)
+	baseURL := flags.String("url", "", "daemon URL")
+	token := flags.String("token", "", "API token")
+	names, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(names) != 1 {
+		return usage(flags, "expected a profile name")
+	}
+	name := names[0]
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		p = &profile{URL: defaultURL}
+		cfg.Profiles[name] = p
+	}
+	if *baseURL != "" {
+		p.URL = strings.TrimRight(*baseURL, "/")
+	}
+	if *token != "" {
+		p.Token = *token
+	}
+	if cfg.Current == "" {
+		cfg.Current = name
+	}
+	return cfg.save()
+}
+
+func profileUse(ctx context.Context, a *app, args []string) error {
+	flags := newFlags("profile use", a.stderr)
+	names, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(names) != 1 {
+		return usage(flags, "expected a profile name")
+	}
+	name := names[0]
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.Profiles[name]; !ok {
+		return fmt.Errorf("unknown profile %q", name)
+	}
+	cfg.Current = name
+	return cfg.save()
+}
+
+func profileRemove(ctx context.Context, a *app, args []string) error {
+	flags := newFlags("profile rm", a.stderr)
+	names, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(names) != 1 {
+		return usage(flags, "expected a profile name")
+	}
+	name := names[0]
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.Profiles[name]; !ok {
+		return fmt.Errorf("unknown profile %q", name)
+	}
+	delete(cfg.Profiles, name)
+	if cfg.Current == name {
+		cfg.Current = ""
+	}
+	return cfg.save()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+func versionsList(ctx context.Context, a *app, args []string) error {
+	flags := newFlags("versions ls", a.stderr)
+	positional, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usage(flags, "expected a project")
+	}
+
+	versions, err := a.client.ListVersions(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(versions))
+	for i := range versions {
+		rows = append(rows, versionRow(&versions[i]))
+	}
+	return a.render(versions, versionHeader, rows)
+}
+
+func status(ctx context.Context, a *app, args []string) error {
+	flags := newFlags("status", a.stderr)
+	positional, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usage(flags, "unexpected argument %q", positional[0])
+	}
+
+	status, err := a.client.DaemonStatus(ctx)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, key := range slices.Sorted(maps.Keys(status)) {
+		rows = append(rows, []string{key, fmt.Sprint(status[key])})
+	}
+	return a.render(status, []string{"KEY", "VALUE"}, rows)
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"os"
+	"time"
+)
+
+var (
+	// DataDir holds everything the daemon keeps on local disk (input files, uploads, ...)
+	DataDir = getEnv("SCRAPYD_DATA_DIR", "data")
+	// MasterKey seals project secrets at rest, the secrets store is disabled without it
+	MasterKey = getEnv("SCRAPYD_MASTER_KEY", "")
+	// AdminToken is the bootstrap admin API token, used to create the stored tokens
+	AdminToken = getEnv("SCRAPYD_ADMIN_TOKEN", "")
+	// BuildBaseImage is the FROM of images built from uploaded project sources and eggs,
+	// unless the project sets its own
+	BuildBaseImage = getEnv("SCRAPYD_BUILD_BASE_IMAGE", "python:3.12-slim")
+	// BuildDockerfile optionally points at a Dockerfile template replacing the built-in one
+	BuildDockerfile = getEnv("SCRAPYD_BUILD_DOCKERFILE", "")
+	// ImageLoadTimeout bounds how long loading an uploaded image tar may take
+	ImageLoadTimeout = getDuration("SCRAPYD_IMAGE_LOAD_TIMEOUT", 30*time.Minute)
+	// InspectTimeout bounds the `scrapy list` run inspecting a version
+	InspectTimeout = getDuration("SCRAPYD_INSPECT_TIMEOUT", 5*time.Minute)
+	// AddVersionWait is how long addversion.json waits for the egg to be built and inspected,
+	// it stays below the minute most proxies and clients give a request
+	AddVersionWait = getDuration("SCRAPYD_ADDVERSION_WAIT", 30*time.Second)
+	// RetentionSchedule is the cron spec the version retention task runs on
+	RetentionSchedule = getEnv("SCRAPYD_RETENTION_SCHEDULE", "@hourly")
+	// NodeName names the daemon in the classic API and in the versions it exports
+	NodeName = getEnv("SCRAPYD_NODE_NAME", hostname())
+)
+
+func hostname() string {
+	name, _ := os.Hostname()
+	return name
+}
+
+func getEnv(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"net/http"
+	"scrapyd/api/errs"
+	"scrapyd/api/types"
+	"scrapyd/models"
+	"scrapyd/services"
+)
+
+func AliasList(c *gin.Context) {
+	var aliases []models.Alias
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "read", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	models.DB.Find(&aliases, "project_id = ?", projectID)
+	c.JSON(http.StatusOK, types.Response{
+		Status: "success",
+		Data:   aliases,
+	})
+}
+
+// AliasPromote moves the alias to another version, creating it when needed.
+func AliasPromote(c *gin.Context) {
+	var request types.AliasRequest
+
+	if err := c.ShouldBindWith(&request, binding.JSON); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "deploy", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	name := c.Params.ByName("name")
+	before := auditBefore[models.Alias]("project_id = ? AND name = ?", projectID, name)
+	alias, err := services.AliasMove(projectID, name, request.VersionID, "promote")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	audit(c, "alias", name, projectID, before, alias)
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "updated",
+		Data:    alias,
+	})
+}
+
+func AliasRollback(c *gin.Context) {
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "deploy", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	name := c.Params.ByName("name")
+	before := auditBefore[models.Alias]("project_id = ? AND name = ?", projectID, name)
+	alias, err := services.AliasMove(projectID, name, "", "rollback")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	audit(c, "alias", name, projectID, before, alias)
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "updated",
+		Data:    alias,
+	})
+}
+
+func AliasHistory(c *gin.Context) {
+	var changes []models.AliasChange
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "read", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	name := c.Params.ByName("name")
+	if err := models.DB.First(&models.Alias{}, "project_id = ? AND name = ?", projectID, name).Error; err != nil {
+		c.Error(errs.ErrAliasNotFound)
+		return
+	}
+
+	models.DB.Order("id DESC").Find(&changes, "project_id = ? AND name = ?", projectID, name)
+	c.JSON(http.StatusOK, types.Response{
+		Status: "success",
+		Data:   changes,
+	})
+}
+
+func AliasDelete(c *gin.Context) {
+	var alias models.Alias
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "deploy", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	name := c.Params.ByName("name")
+	if err := models.DB.First(&alias, "project_id = ? AND name = ?", projectID, name).Error; err != nil {
+		c.Error(errs.ErrAliasNotFound)
+		return
+	}
+
+	audit(c, "alias", name, projectID, alias, nil)
+	if err := models.DB.Delete(&alias).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "deleted",
+	})
+}
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"scrapyd/models"
+	"scrapyd/testutil"
+	"testing"
+)
+
+func TestAliasPromoteRollbackHistory(t *testing.T) {
+	setupJobs(t)
+	testutil.Create(t, &models.Version{ID: "v2", ProjectID: "shop", Image: "shop:v2", Status: "ready", Spiders: []string{"items"}})
+	promote := newRouter(admin, http.MethodPut, "/projects/:id/aliases/:name", AliasPromote)
+	rollback := newRouter(admin, http.MethodPost, "/projects/:id/aliases/:name/rollback", AliasRollback)
+	history := newRouter(admin, http.MethodGet, "/projects/:id/aliases/:name/history", AliasHistory)
+
+	for _, versionID := range []string{"v1", "v2"} {
+		if w, _ := serveJSON(t, promote, http.MethodPut, "/projects/shop/aliases/prod", map[string]any{"version_id": versionID}); w.Code != http.StatusOK {
+			t.Fatalf("promote %s: status %d: %s", versionID, w.Code, w.Body)
+		}
+	}
+	if w, response := serveJSON(t, promote, http.MethodPut, "/projects/shop/aliases/v1", map[string]any{"version_id": "v2"}); w.Code != http.StatusConflict || response.Code != "ALIAS_NAME_TAKEN" {
+		t.Fatalf("alias named after a version: status %d: %s", w.Code, w.Body)
+	}
+
+	w, response := serve(t, rollback, http.MethodPost, "/projects/shop/aliases/prod/rollback", "", nil)
+	if w.Code != http.StatusOK || response.Data.(map[string]any)["version_id"] != "v1" {
+		t.Fatalf("rollback: status %d: %s", w.Code, w.Body)
+	}
+	if w, response := serve(t, rollback, http.MethodPost, "/projects/shop/aliases/prod/rollback", "", nil); w.Code != http.StatusConflict || response.Code != "ALIAS_NO_PREVIOUS" {
+		t.Fatalf("second rollback: status %d: %s", w.Code, w.Body)
+	}
+
+	w, response = serve(t, history, http.MethodGet, "/projects/shop/aliases/prod/history", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("history: status %d: %s", w.Code, w.Body)
+	}
+	data, _ := json.Marshal(response.Data)
+	var changes []models.AliasChange
+	json.Unmarshal(data, &changes)
+	if len(changes) != 3 || changes[0].Action != "rollback" || changes[0].ToVersionID != "v1" || changes[2].ToVersionID != "v1" {
+		t.Fatalf("history, newest first: %+v", changes)
+	}
+	if w, _ := serve(t, history, http.MethodGet, "/projects/shop/aliases/staging/history", "", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("history of a missing alias: status %d", w.Code)
+	}
+}
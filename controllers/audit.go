@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"net/http"
+	"regexp"
+	"scrapyd/api/types"
+	"scrapyd/models"
+	"strings"
+	"time"
+)
+
+const (
+	RequestIDKey = "request_id"
+	auditKey     = "audit"
+)
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID tags the request with the X-Request-ID of the caller, or a new one.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			reqID, _ := uuid.NewUUID()
+			id = strings.ReplaceAll(reqID.String(), "-", "")
+		}
+		c.Set(RequestIDKey, id)
+		c.Header("X-Request-ID", id)
+		c.Next()
+	}
+}
+
+type auditTarget struct {
+	targetType string
+	targetID   string
+	projectID  string
+	before     any
+	after      any
+}
+
+// audit describes a target of the call for the audit log, before and after summarize it
+// around the change. Calls changing several targets describe each, every one gets an entry.
+// Secrets and password hashes stay out since their fields aren't marshalled.
+func audit(c *gin.Context, targetType string, targetID string, projectID string, before any, after any) {
+	targets, _ := c.Get(auditKey)
+	targetList, _ := targets.([]*auditTarget)
+	c.Set(auditKey, append(targetList, &auditTarget{
+		targetType: targetType,
+		targetID:   targetID,
+		projectID:  projectID,
+		before:     before,
+		after:      after,
+	}))
+}
+
+// auditBefore loads the row about to change as the before summary.
+func auditBefore[T any](query string, args ...any) any {
+	var row T
+	if err := models.DB.Where(query, args...).First(&row).Error; err != nil {
+		return nil
+	}
+	return &row
+}
+
+func auditJSON(value any) json.RawMessage {
+	if value == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// AuditLog records every mutating call once it has been answered, whatever the outcome.
+// Calls the controller didn't describe are recorded with the route parameters as target.
+func AuditLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return
+		}
+
+		p := principal(c)
+		action := c.HandlerName()
+		if i := strings.LastIndex(action, "."); i >= 0 {
+			action = action[i+1:]
+		}
+		entry := models.AuditEntry{
+			Actor:      p.Name,
+			UserID:     p.UserID,
+			TokenID:    p.TokenID,
+			IP:         c.ClientIP(),
+			RequestID:  c.GetString(RequestIDKey),
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.Path,
+			Action:     action,
+			StatusCode: c.Writer.Status(),
+			Outcome:    "success",
+		}
+		switch {
+		case entry.StatusCode == http.StatusUnauthorized || entry.StatusCode == http.StatusForbidden:
+			entry.Outcome = "denied"
+		case entry.StatusCode >= 400:
+			entry.Outcome = "error"
+		}
+		if len(c.Errors) > 0 {
+			entry.Error = c.Errors.Last().Error()
+		}
+
+		targets, _ := c.Get(auditKey)
+		targetList, _ := targets.([]*auditTarget)
+		if len(targetList) == 0 {
+			params := make([]string, 0, len(c.Params))
+			for _, param := range c.Params {
+				params = append(params, param.Key+"="+param.Value)
+			}
+			entry.TargetID = strings.Join(params, ",")
+			entry.ProjectID = c.Param("project_id")
+			if strings.HasPrefix(c.FullPath(), "/projects/:id") {
+				entry.ProjectID = c.Param("id")
+			}
+			auditCreate(&entry)
+			return
+		}
+		for _, target := range targetList {
+			entry := entry
+			entry.TargetType = target.targetType
+			entry.TargetID = target.targetID
+			entry.ProjectID = target.projectID
+			entry.Before = auditJSON(target.before)
+			if entry.Outcome == "success" {
+				entry.After = auditJSON(target.after)
+			}
+			auditCreate(&entry)
+		}
+	}
+}
+
+func auditCreate(entry *models.AuditEntry) {
+	if err := models.DB.Create(entry).Error; err != nil {
+		log.Error().
+			Err(err).
+			Str("request", entry.RequestID).
+			Str("action", entry.Action).
+			Msg("failed to record audit entry")
+	}
+}
+
+// auditQuery applies the filters, admins see everything and owners the entries of their projects.
+func auditQuery(c *gin.Context, filter *types.AuditFilter) *gorm.DB {
+	query := models.DB.Model(&models.AuditEntry{})
+	if !principal(c).IsAdmin() {
+		query = visible(c, query, "project_id", "admin")
+	}
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.ProjectID != "" {
+		query = query.Where("project_id = ?", filter.ProjectID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.RequestID != "" {
+		query = query.Where("request_id = ?", filter.RequestID)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+	return query
+}
+
+func AuditList(c *gin.Context) {
+	var filter types.AuditFilter
+	var entries []models.AuditEntry
+
+	if err := c.ShouldBindWith(&filter, binding.Query); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	if err := authorize(c, "admin", ""); err != nil {
+		c.Error(err)
+		return
+	}
+	if filter.Limit == 0 {
+		filter.Limit = 100
+	}
+
+	query := auditQuery(c, &filter)
+	if filter.BeforeID > 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+	query.Order("id DESC").Limit(filter.Limit).Find(&entries)
+	c.JSON(http.StatusOK, types.Response{
+		Status: "success",
+		Data:   entries,
+	})
+}
+
+// AuditExport streams the matching entries as JSON lines, oldest first.
+func AuditExport(c *gin.Context) {
+	var filter types.AuditFilter
+
+	if err := c.ShouldBindWith(&filter, binding.Query); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	if err := authorize(c, "admin", ""); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="audit-`+time.Now().UTC().Format("20060102T150405Z")+`.jsonl"`)
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	var batch []models.AuditEntry
+	auditQuery(c, &filter).Order("id").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, entry := range batch {
+			if err := encoder.Encode(entry); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+}
@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"scrapyd/api/errs"
+	"scrapyd/models"
+	"scrapyd/services"
+	"scrapyd/testutil"
+	"slices"
+	"testing"
+)
+
+func TestAuditLogOutcome(t *testing.T) {
+	before := &models.Project{ID: "shop", BaseImage: "before"}
+	after := &models.Project{ID: "shop", BaseImage: "after"}
+	tests := []struct {
+		name       string
+		method     string
+		err        error
+		bind       bool
+		status     int
+		outcome    string
+		wantBefore bool
+		wantAfter  bool
+	}{
+		{name: "success", method: http.MethodPatch, status: http.StatusOK, outcome: "success", wantBefore: true, wantAfter: true},
+		{name: "unauthorized", method: http.MethodPatch, err: errs.ErrUnauthorized, status: http.StatusUnauthorized, outcome: "denied", wantBefore: true},
+		{name: "forbidden", method: http.MethodDelete, err: errs.ErrForbidden, status: http.StatusForbidden, outcome: "denied", wantBefore: true},
+		{name: "not found", method: http.MethodPatch, err: errs.ErrProjectNotFound, status: http.StatusNotFound, outcome: "error", wantBefore: true},
+		{name: "invalid", method: http.MethodPost, err: errors.New("name is required"), bind: true, status: http.StatusBadRequest, outcome: "error", wantBefore: true},
+		{name: "internal", method: http.MethodPost, err: errors.New("disk full"), status: http.StatusInternalServerError, outcome: "error", wantBefore: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.Setup(t)
+			caller := &services.Principal{Name: "ann", UserID: "u1", TokenID: "t1", Scopes: []string{"admin"}}
+			router := newRouter(caller, tt.method, "/projects/:id", func(c *gin.Context) {
+				audit(c, "project", "shop", "shop", before, after)
+				if tt.err != nil {
+					e := c.Error(tt.err)
+					if tt.bind {
+						e.SetType(gin.ErrorTypeBind)
+					}
+					return
+				}
+				c.Status(http.StatusOK)
+			})
+			if w, _ := serve(t, router, tt.method, "/projects/shop", "", nil); w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+
+			var entries []models.AuditEntry
+			models.DB.Find(&entries)
+			if len(entries) != 1 {
+				t.Fatalf("%d entries", len(entries))
+			}
+			entry := entries[0]
+			if entry.Outcome != tt.outcome || entry.StatusCode != tt.status || entry.Method != tt.method {
+				t.Fatalf("entry %+v, want %s with %d", entry, tt.outcome, tt.status)
+			}
+			if entry.Actor != "ann" || entry.UserID != "u1" || entry.TokenID != "t1" || entry.RequestID == "" {
+				t.Fatalf("caller not recorded: %+v", entry)
+			}
+			if entry.TargetType != "project" || entry.TargetID != "shop" || entry.ProjectID != "shop" {
+				t.Fatalf("target not recorded: %+v", entry)
+			}
+			if (tt.err != nil) != (entry.Error != "") {
+				t.Fatalf("error %q", entry.Error)
+			}
+			if got := auditBaseImage(t, entry.Before); tt.wantBefore != (got == "before") {
+				t.Fatalf("before %s", entry.Before)
+			}
+			if got := auditBaseImage(t, entry.After); tt.wantAfter != (got == "after") {
+				t.Fatalf("after %s", entry.After)
+			}
+		})
+	}
+}
+
+func auditBaseImage(t *testing.T, summary json.RawMessage) string {
+	t.Helper()
+	if summary == nil {
+		return ""
+	}
+	var project models.Project
+	if err := json.Unmarshal(summary, &project); err != nil {
+		t.Fatal(err)
+	}
+	return project.BaseImage
+}
+
+func TestAuditLogUndescribedCalls(t *testing.T) {
+	testutil.Setup(t)
+	handler := func(c *gin.Context) { c.Status(http.StatusOK) }
+
+	// reads aren't recorded
+	router := newRouter(admin, http.MethodGet, "/projects/:id", handler)
+	serve(t, router, http.MethodGet, "/projects/shop", "", nil)
+	if n := testutil.Count[models.AuditEntry](t, "1 = 1"); n != 0 {
+		t.Fatalf("%d entries for a read", n)
+	}
+
+	// the route parameters stand in for the target
+	router = newRouter(admin, http.MethodDelete, "/projects/:id/aliases/:name", handler)
+	serve(t, router, http.MethodDelete, "/projects/shop/aliases/live", "", nil)
+	var entry models.AuditEntry
+	if err := models.DB.First(&entry).Error; err != nil {
+		t.Fatal(err)
+	}
+	if entry.ProjectID != "shop" || entry.TargetID != "id=shop,name=live" || entry.Before != nil || entry.After != nil {
+		t.Fatalf("entry %+v", entry)
+	}
+}
+
+func TestAuditListVisibility(t *testing.T) {
+	testutil.Setup(t)
+	testutil.Create(t,
+		&models.AuditEntry{Actor: "ann", ProjectID: "shop", Outcome: "success"},
+		&models.AuditEntry{Actor: "ann", ProjectID: "blog", Outcome: "success"},
+		&models.AuditEntry{Actor: "bob", Outcome: "denied"},
+	)
+	tests := []struct {
+		name   string
+		caller *services.Principal
+		status int
+		want   []string
+	}{
+		{name: "admin", caller: admin, status: http.StatusOK, want: []string{"", "blog", "shop"}},
+		{name: "user admin", caller: &services.Principal{Name: "root", UserID: "u0", Admin: true}, status: http.StatusOK, want: []string{"", "blog", "shop"}},
+		{name: "owner", caller: &services.Principal{Name: "ann", UserID: "u1", Roles: map[string]string{"shop": "owner", "blog": "deployer"}}, status: http.StatusOK, want: []string{"shop"}},
+		{name: "restricted admin token", caller: &services.Principal{Name: "ci", TokenID: "t1", Scopes: []string{"admin"}, ProjectIDs: []string{"blog"}}, status: http.StatusOK, want: []string{"blog"}},
+		{name: "deployer", caller: &services.Principal{Name: "bob", UserID: "u2", Roles: map[string]string{"shop": "deployer"}}, status: http.StatusForbidden},
+		{name: "token without admin", caller: &services.Principal{Name: "ci", TokenID: "t2", Scopes: []string{"deploy"}}, status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newRouter(tt.caller, http.MethodGet, "/audit", AuditList)
+			w, response := serve(t, router, http.MethodGet, "/audit", "", nil)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var projects []string
+			for _, entry := range response.Data.([]any) {
+				projectID, _ := entry.(map[string]any)["project_id"].(string)
+				projects = append(projects, projectID)
+			}
+			slices.Sort(projects)
+			if !slices.Equal(projects, tt.want) {
+				t.Fatalf("entries of %q, want %q", projects, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"scrapyd/api/errs"
+	"scrapyd/services"
+	"slices"
+	"strings"
+)
+
+const principalKey = "principal"
+
+// publicPaths are served without authentication
+var publicPaths = []string{"/openapi.json", "/ui/*filepath"}
+
+// Authenticate resolves the bearer token, or HTTP Basic auth as sent by scrapyd-style clients,
+// into the principal of the request. Basic auth is either a user and its password, or any
+// username with a token as the password.
+func Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if slices.Contains(publicPaths, c.FullPath()) {
+			return
+		}
+
+		var p *services.Principal
+		var err error
+		challenge := `Basic realm="scrapyd"`
+		if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+			// browsers prompt for Basic credentials, the dashboard handles a bad token itself
+			challenge = `Bearer realm="scrapyd"`
+			p, err = services.Authenticate(strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")))
+		} else if username, password, ok := c.Request.BasicAuth(); ok {
+			if p, err = services.AuthenticatePassword(username, password); err != nil {
+				p, err = services.Authenticate(password)
+			}
+		} else {
+			err = errs.ErrUnauthorized
+		}
+		if err != nil {
+			c.Header("WWW-Authenticate", challenge)
+			c.Error(err)
+			c.Abort()
+			return
+		}
+		c.Set(principalKey, p)
+	}
+}
+
+func principal(c *gin.Context) *services.Principal {
+	if p, ok := c.Get(principalKey); ok {
+		return p.(*services.Principal)
+	}
+	return &services.Principal{}
+}
+
+// visible restricts the query to the projects the caller holds the scope on.
+func visible(c *gin.Context, query *gorm.DB, column string, scope string) *gorm.DB {
+	projectIDs, all := principal(c).Projects(scope)
+	if all {
+		return query
+	}
+	return query.Where(column+" IN ?", projectIDs)
+}
+
+// authorize checks the caller holds the scope on the project, an empty project only checks the scope.
+func authorize(c *gin.Context, scope string, projectID string) error {
+	if !principal(c).Allows(scope, projectID) {
+		return errs.ErrForbidden
+	}
+	return nil
+}
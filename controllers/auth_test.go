@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"scrapyd/models"
+	"scrapyd/services"
+	"scrapyd/testutil"
+	"testing"
+	"time"
+)
+
+func TestAuthenticateMiddleware(t *testing.T) {
+	testutil.Setup(t)
+	hash, err := services.PasswordHash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedAt := time.Now()
+	testutil.Create(t,
+		&models.User{ID: "u1", Name: "ann", PasswordHash: hash},
+		&models.Token{ID: "t1", Name: "ci", Hash: services.TokenHash("valid"), Scopes: []string{"read"}},
+		&models.Token{ID: "t2", Name: "old", Hash: services.TokenHash("revoked"), Scopes: []string{"admin"}, RevokedAt: &revokedAt},
+	)
+	router := newRouter(nil, http.MethodGet, "/projects", Authenticate(), func(c *gin.Context) {
+		c.String(http.StatusOK, principal(c).Name)
+	})
+
+	tests := []struct {
+		name      string
+		header    string
+		basic     []string
+		status    int
+		want      string
+		challenge string
+	}{
+		{name: "bearer", header: "Bearer valid", status: http.StatusOK, want: "ci"},
+		{name: "bearer revoked", header: "Bearer revoked", status: http.StatusUnauthorized, challenge: "Bearer"},
+		{name: "bearer unknown", header: "Bearer guess", status: http.StatusUnauthorized, challenge: "Bearer"},
+		{name: "basic password", basic: []string{"ann", "password"}, status: http.StatusOK, want: "ann"},
+		{name: "basic wrong password", basic: []string{"ann", "guess"}, status: http.StatusUnauthorized, challenge: "Basic"},
+		{name: "basic token", basic: []string{"anyone", "valid"}, status: http.StatusOK, want: "ci"},
+		{name: "basic revoked token", basic: []string{"anyone", "revoked"}, status: http.StatusUnauthorized, challenge: "Basic"},
+		{name: "none", status: http.StatusUnauthorized, challenge: "Basic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/projects", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if tt.basic != nil {
+				req.SetBasicAuth(tt.basic[0], tt.basic[1])
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status == http.StatusOK && w.Body.String() != tt.want {
+				t.Fatalf("authenticated as %q, want %q", w.Body, tt.want)
+			}
+			if challenge := w.Header().Get("WWW-Authenticate"); tt.challenge != "" && challenge != tt.challenge+` realm="scrapyd"` {
+				t.Fatalf("challenge %q, want %s", challenge, tt.challenge)
+			}
+		})
+	}
+
+	// public paths need no credentials
+	public := newRouter(nil, http.MethodGet, "/openapi.json", Authenticate(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	if w, _ := serve(t, public, http.MethodGet, "/openapi.json", "", nil); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+}
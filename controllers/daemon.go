@@ -9,6 +9,10 @@ import (
 )
 
 func DaemonStatus(c *gin.Context) {
+	if err := authorize(c, "read", ""); err != nil {
+		c.Error(err)
+		return
+	}
 	info, err := services.DaemonStatus()
 	if err != nil {
 		c.Error(err)
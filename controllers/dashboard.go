@@ -0,0 +1,15 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"scrapyd/dashboard"
+)
+
+var dashboardFS = http.FS(dashboard.FS)
+
+// Dashboard serves the embedded web UI. The page itself is public, it calls the API
+// with the token the user signs in with.
+func Dashboard(c *gin.Context) {
+	c.FileFromFS(c.Param("filepath"), dashboardFS)
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// authenticated runs the handler behind Authenticate, like the daemon router does.
+func authenticated(handler gin.HandlerFunc) gin.HandlerFunc {
+	authenticate := Authenticate()
+	return func(c *gin.Context) {
+		authenticate(c)
+		if !c.IsAborted() {
+			handler(c)
+		}
+	}
+}
+
+func TestDashboardIsPublic(t *testing.T) {
+	router := newRouter(nil, http.MethodGet, "/ui/*filepath", authenticated(Dashboard))
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+		content     string
+	}{
+		{path: "/ui/", status: http.StatusOK, contentType: "text/html", content: "<title>scrapyd</title>"},
+		{path: "/ui/app.js", status: http.StatusOK, contentType: "javascript"},
+		{path: "/ui/style.css", status: http.StatusOK, contentType: "text/css"},
+		{path: "/ui/missing.js", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w, _ := serve(t, router, http.MethodGet, tt.path, "", nil)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if contentType := w.Header().Get("Content-Type"); !strings.Contains(contentType, tt.contentType) {
+				t.Fatalf("content type %q, want %q", contentType, tt.contentType)
+			}
+			if !strings.Contains(w.Body.String(), tt.content) {
+				t.Fatalf("body doesn't contain %q", tt.content)
+			}
+		})
+	}
+}
+
+func TestDashboardAssetsExist(t *testing.T) {
+	router := newRouter(nil, http.MethodGet, "/ui/*filepath", authenticated(Dashboard))
+
+	w, _ := serve(t, router, http.MethodGet, "/ui/", "", nil)
+	assets := regexp.MustCompile(`(?:src|href)="([^"]+)"`).FindAllStringSubmatch(w.Body.String(), -1)
+	if len(assets) == 0 {
+		t.Fatal("index.html references no assets")
+	}
+	for _, asset := range assets {
+		if w, _ := serve(t, router, http.MethodGet, "/ui/"+asset[1], "", nil); w.Code != http.StatusOK {
+			t.Errorf("%s: status %d", asset[1], w.Code)
+		}
+	}
+}
+
+func TestAPIStillNeedsAuthentication(t *testing.T) {
+	router := newRouter(nil, http.MethodGet, "/daemonstatus", authenticated(DaemonStatus))
+
+	w, response := serve(t, router, http.MethodGet, "/daemonstatus", "", nil)
+	if w.Code != http.StatusUnauthorized || response.Code != "UNAUTHORIZED" {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if w.Header().Get("WWW-Authenticate") == "" {
+		t.Fatal("no challenge")
+	}
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"scrapyd/api/errs"
+	"scrapyd/api/types"
+	"scrapyd/models"
+	"scrapyd/services"
+)
+
+func EnvList(c *gin.Context) {
+	var envVars []models.EnvVar
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "read", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	models.DB.Find(&envVars, "project_id = ?", projectID)
+	c.JSON(http.StatusOK, types.Response{
+		Status: "success",
+		Data:   envVars,
+	})
+}
+
+func EnvPut(c *gin.Context) {
+	var request types.EnvVarRequest
+
+	if err := c.ShouldBindWith(&request, binding.JSON); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "admin", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	name := c.Params.ByName("name")
+	if !services.EnvNameValid(name) {
+		c.Error(errs.ErrEnvInvalid)
+		return
+	}
+
+	envVar := models.EnvVar{
+		ProjectID: projectID,
+		Name:      name,
+		Value:     request.Value,
+	}
+	audit(c, "env", name, projectID, auditBefore[models.EnvVar]("project_id = ? AND name = ?", projectID, name), &envVar)
+	if err := models.DB.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&envVar).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "updated",
+	})
+}
+
+func EnvDelete(c *gin.Context) {
+	var envVar models.EnvVar
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "admin", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	name := c.Params.ByName("name")
+	if err := models.DB.First(&envVar, "project_id = ? AND name = ?", projectID, name).Error; err != nil {
+		c.Error(errs.ErrEnvNotFound)
+		return
+	}
+
+	audit(c, "env", name, projectID, envVar, nil)
+	if err := models.DB.Delete(&envVar).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "deleted",
+	})
+}
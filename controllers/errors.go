@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+	"io"
+	"reflect"
+	"scrapyd/api/errs"
+	"scrapyd/api/openapi"
+	"scrapyd/api/types"
+	"strings"
+)
+
+// ErrorResponse answers the last error of the call unless the handler already answered.
+// Binding errors list the failed checks, unknown errors only hand out the request ID to report.
+func ErrorResponse() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		last := c.Errors.Last()
+		err := last.Err
+		response := types.Response{
+			Status:    "error",
+			RequestID: c.GetString(RequestIDKey),
+		}
+
+		if last.IsType(gin.ErrorTypeBind) {
+			err = errs.ErrValidationFailed
+			response.Details = validationDetails(last.Err)
+		}
+		knownErr := errs.Known(err)
+		if knownErr == errs.ErrInternal {
+			log.Error().
+				Err(err).
+				Str("request", response.RequestID).
+				Str("method", c.Request.Method).
+				Str("path", c.Request.URL.Path).
+				Msg("unhandled error")
+		}
+		response.Code = errs.ErrCodeMap[knownErr]
+		response.Message = knownErr.Error()
+		if IsScrapyd(c) {
+			ScrapydError(c, response)
+			return
+		}
+		c.AbortWithStatusJSON(errs.ErrStatusMap[knownErr], response)
+	}
+}
+
+// SetupValidator names the fields of validation errors as the requests do and adds the custom rules.
+func SetupValidator() {
+	if validate, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		validate.RegisterTagNameFunc(fieldName)
+		types.RegisterValidations(validate)
+	}
+}
+
+// validationDetails lists the failed checks of a binding error, fields are named by their json or form tag.
+func validationDetails(err error) []types.FieldError {
+	var schemaErr *openapi.ValidationError
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+
+	switch {
+	case errors.As(err, &schemaErr):
+		return schemaErr.Details
+	case errors.As(err, &validationErrs):
+		details := make([]types.FieldError, 0, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			// the namespace starts with the request struct name
+			_, field, _ := strings.Cut(fieldErr.Namespace(), ".")
+			detail := types.FieldError{Field: field, Rule: fieldErr.Tag()}
+			switch fieldErr.Tag() {
+			case "required":
+				detail.Message = field + " is required"
+			case "oneof":
+				detail.Message = field + " must be one of " + fieldErr.Param()
+			case "min", "max", "gte", "lte", "gt", "lt", "len":
+				detail.Message = field + " must be " + fieldErr.Tag() + " " + fieldErr.Param()
+			case "id":
+				detail.Message = field + " may only contain letters, digits, '.', '_' and '-', without '..'"
+			default:
+				detail.Message = field + " is invalid"
+			}
+			details = append(details, detail)
+		}
+		return details
+	case errors.As(err, &typeErr):
+		return []types.FieldError{{Field: typeErr.Field, Rule: "type", Message: typeErr.Field + " must be " + typeErr.Type.String()}}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return []types.FieldError{{Rule: "json", Message: "body is not valid JSON"}}
+	case errors.Is(err, io.EOF):
+		return []types.FieldError{{Rule: "json", Message: "body is empty"}}
+	}
+	return []types.FieldError{{Rule: "format", Message: err.Error()}}
+}
+
+// fieldName names struct fields in validation errors as the request does.
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
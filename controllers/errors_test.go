@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"net/http"
+	"net/http/httptest"
+	"scrapyd/api/errs"
+	"scrapyd/api/openapi"
+	"scrapyd/api/types"
+	"scrapyd/testutil"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestErrorResponse(t *testing.T) {
+	type request struct {
+		Name     string `json:"name" binding:"required"`
+		Priority int    `json:"priority" binding:"min=0,max=10"`
+		Kind     string `json:"kind" binding:"omitempty,oneof=egg image"`
+	}
+	bind := func(c *gin.Context) {
+		var r request
+		if err := c.ShouldBindWith(&r, binding.JSON); err != nil {
+			c.Error(err).SetType(gin.ErrorTypeBind)
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+	fail := func(err error) gin.HandlerFunc {
+		return func(c *gin.Context) { c.Error(err) }
+	}
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		body    string
+		status  int
+		code    string
+		details []types.FieldError
+	}{
+		{
+			name:    "binding",
+			handler: bind,
+			body:    `{"priority": 11, "kind": "zip"}`,
+			status:  http.StatusBadRequest,
+			code:    "VALIDATION_FAILED",
+			details: []types.FieldError{
+				{Field: "name", Rule: "required", Message: "name is required"},
+				{Field: "priority", Rule: "max", Message: "priority must be max 10"},
+				{Field: "kind", Rule: "oneof", Message: "kind must be one of egg image"},
+			},
+		},
+		{
+			name:    "type mismatch",
+			handler: bind,
+			body:    `{"name": "ci", "priority": "high"}`,
+			status:  http.StatusBadRequest,
+			code:    "VALIDATION_FAILED",
+			details: []types.FieldError{{Field: "priority", Rule: "type", Message: "priority must be int"}},
+		},
+		{
+			name:    "json syntax",
+			handler: bind,
+			body:    `{"name": "ci",}`,
+			status:  http.StatusBadRequest,
+			code:    "VALIDATION_FAILED",
+			details: []types.FieldError{{Rule: "json", Message: "body is not valid JSON"}},
+		},
+		{
+			name:    "truncated json",
+			handler: bind,
+			body:    `{"name": "ci"`,
+			status:  http.StatusBadRequest,
+			code:    "VALIDATION_FAILED",
+			details: []types.FieldError{{Rule: "json", Message: "body is not valid JSON"}},
+		},
+		{
+			name:    "empty body",
+			handler: bind,
+			status:  http.StatusBadRequest,
+			code:    "VALIDATION_FAILED",
+			details: []types.FieldError{{Rule: "json", Message: "body is empty"}},
+		},
+		{
+			name: "schema",
+			handler: func(c *gin.Context) {
+				c.Error(&openapi.ValidationError{Details: []types.FieldError{{Field: "spider", Rule: "schema", Message: "spider is required"}}}).SetType(gin.ErrorTypeBind)
+			},
+			status:  http.StatusBadRequest,
+			code:    "VALIDATION_FAILED",
+			details: []types.FieldError{{Field: "spider", Rule: "schema", Message: "spider is required"}},
+		},
+		{
+			name: "other binding error",
+			handler: func(c *gin.Context) {
+				c.Error(errors.New("multipart: NextPart: EOF")).SetType(gin.ErrorTypeBind)
+			},
+			status:  http.StatusBadRequest,
+			code:    "VALIDATION_FAILED",
+			details: []types.FieldError{{Rule: "format", Message: "multipart: NextPart: EOF"}},
+		},
+		{name: "known", handler: fail(errs.ErrProjectNotFound), status: http.StatusNotFound, code: "PROJECT_NOT_FOUND"},
+		{name: "wrapped known", handler: fail(fmt.Errorf("load shop: %w", errs.ErrProjectNotFound)), status: http.StatusNotFound, code: "PROJECT_NOT_FOUND"},
+		{name: "unknown", handler: fail(errors.New("database is locked")), status: http.StatusInternalServerError, code: "INTERNAL_ERROR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.Setup(t)
+			router := newRouter(admin, http.MethodPost, "/projects", tt.handler)
+			req := httptest.NewRequest(http.MethodPost, "/projects", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Request-ID", "req-42")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			_, response := decodeResponse(t, w)
+			if w.Code != tt.status || response.Status != "error" || response.Code != tt.code {
+				t.Fatalf("status %d, want %d %s: %s", w.Code, tt.status, tt.code, w.Body)
+			}
+			if !slices.Equal(response.Details, tt.details) {
+				t.Fatalf("details %+v, want %+v", response.Details, tt.details)
+			}
+			// the caller's request ID comes back to look the error up in the logs
+			if response.RequestID != "req-42" || w.Header().Get("X-Request-ID") != "req-42" {
+				t.Fatalf("request ID %q", response.RequestID)
+			}
+			// unknown errors don't leak their cause
+			if tt.status == http.StatusInternalServerError && response.Message != errs.ErrInternal.Error() {
+				t.Fatalf("message %q", response.Message)
+			}
+		})
+	}
+}
+
+func TestErrorResponseAnswered(t *testing.T) {
+	testutil.Setup(t)
+	// errors of handlers that already answered are left alone
+	router := newRouter(admin, http.MethodPost, "/projects", func(c *gin.Context) {
+		c.String(http.StatusAccepted, "queued")
+		c.Error(errs.ErrProjectNotFound)
+	})
+	w, _ := serve(t, router, http.MethodPost, "/projects", "", nil)
+	if w.Code != http.StatusAccepted || w.Body.String() != "queued" {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	// a request ID that could forge log lines is replaced
+	req := httptest.NewRequest(http.MethodPost, "/projects", nil)
+	req.Header.Set("X-Request-ID", "bad id\nforged")
+	w = httptest.NewRecorder()
+	router = newRouter(admin, http.MethodPost, "/projects", func(c *gin.Context) { c.Error(errs.ErrForbidden) })
+	router.ServeHTTP(w, req)
+	_, response := decodeResponse(t, w)
+	if response.RequestID == "" || response.RequestID == "bad id\nforged" || response.RequestID != w.Header().Get("X-Request-ID") {
+		t.Fatalf("request ID %q", response.RequestID)
+	}
+}
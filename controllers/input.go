@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"net/http"
+	"scrapyd/api/errs"
+	"scrapyd/api/types"
+	"scrapyd/models"
+	"scrapyd/services"
+)
+
+func InputCreate(c *gin.Context) {
+	var request types.InputRequest
+
+	if err := c.ShouldBindWith(&request, binding.FormMultipart); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	if err := authorize(c, "schedule", request.ProjectID); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", request.ProjectID).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.Error(errs.ErrInputInvalid)
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.Error(errs.ErrInputInvalid)
+		return
+	}
+	defer file.Close()
+
+	input, err := services.InputStore(request.ProjectID, fileHeader.Filename, file)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	audit(c, "input", input.ID, request.ProjectID, nil, input)
+	if err := models.DB.Create(input).Error; err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusCreated, types.Response{
+		Status:  "success",
+		Message: "created",
+		Data:    input,
+	})
+}
+
+func InputList(c *gin.Context) {
+	var inputs []models.InputFile
+
+	projectID := c.Params.ByName("project_id")
+	if err := authorize(c, "read", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	models.DB.Find(&inputs, "project_id = ?", projectID)
+	c.JSON(http.StatusOK, types.Response{
+		Status: "success",
+		Data:   inputs,
+	})
+}
+
+func InputDelete(c *gin.Context) {
+	var input models.InputFile
+
+	projectID := c.Params.ByName("project_id")
+	if err := authorize(c, "schedule", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	id := c.Params.ByName("input_id")
+	if err := models.DB.First(&input, "id = ? AND project_id = ?", id, projectID).Error; err != nil {
+		c.Error(errs.ErrInputNotFound)
+		return
+	}
+
+	// jobs keep pointing at their inputs so that they can be rerun as they were
+	var refs int64
+	if err := models.DB.Model(&models.Job{}).Where("project_id = ? AND inputs LIKE ?", projectID, `%"`+id+`"%`).Count(&refs).Error; err != nil {
+		c.Error(err)
+		return
+	}
+	if refs > 0 {
+		c.Error(errs.ErrInputInUse)
+		return
+	}
+
+	audit(c, "input", id, projectID, input, nil)
+
+	// cleanup the stored content if nothing else uses it
+	if err := services.InputCleanup(&input); err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := models.DB.Delete(&input).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "deleted",
+	})
+}
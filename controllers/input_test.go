@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"scrapyd/config"
+	"scrapyd/models"
+	"scrapyd/testutil"
+	"testing"
+)
+
+// setupJobs creates the project shop with the ready version v1 running the spider items.
+func setupJobs(t *testing.T) {
+	t.Helper()
+	testutil.Setup(t)
+	testutil.Create(t,
+		&models.Project{ID: "shop"},
+		&models.Version{ID: "v1", ProjectID: "shop", Image: "shop:v1", Status: "ready", Spiders: []string{"items"}},
+	)
+}
+
+func storedBlobs(t *testing.T) []string {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(config.DataDir, "inputs"))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestJobCreateStoresUploads(t *testing.T) {
+	setupJobs(t)
+	router := newRouter(admin, http.MethodPost, "/jobs", JobCreate)
+
+	contentType, body := multipartBody(t,
+		map[string]string{"project_id": "shop", "version_id": "v1", "spider": "items"},
+		map[string][][2]string{"input_files": {{"urls.txt", "https://example.com\n"}}},
+	)
+	w, response := serve(t, router, http.MethodPost, "/jobs", contentType, body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	var job models.Job
+	models.DB.First(&job, "id = ?", response.Data.(map[string]any)["id"])
+	if len(job.Inputs) != 1 || job.InputHash == "" {
+		t.Fatalf("job inputs %v hash %q", job.Inputs, job.InputHash)
+	}
+	if n := testutil.Count[models.InputFile](t, "id = ?", job.Inputs[0]); n != 1 {
+		t.Fatalf("%d input rows", n)
+	}
+	if blobs := storedBlobs(t); len(blobs) != 1 {
+		t.Fatalf("stored blobs %v", blobs)
+	}
+}
+
+func TestJobCreateRejectedStoresNothing(t *testing.T) {
+	tests := []struct {
+		name   string
+		before func(t *testing.T)
+		files  [][2]string
+		status int
+	}{
+		{
+			name:   "duplicate names",
+			files:  [][2]string{{"urls.txt", "a"}, {"dir/urls.txt", "b"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "duplicate job",
+			before: func(t *testing.T) {
+				testutil.Create(t, &models.SpiderPolicy{ProjectID: "shop", Spider: "items", Uniqueness: "reject"})
+				router := newRouter(admin, http.MethodPost, "/jobs", JobCreate)
+				if w, _ := serveJSON(t, router, http.MethodPost, "/jobs", map[string]any{"project_id": "shop", "version_id": "v1", "spider": "items"}); w.Code != http.StatusCreated {
+					t.Fatalf("status %d: %s", w.Code, w.Body)
+				}
+			},
+			files:  [][2]string{{"urls.txt", "a"}},
+			status: http.StatusConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupJobs(t)
+			if tt.before != nil {
+				tt.before(t)
+			}
+			router := newRouter(admin, http.MethodPost, "/jobs", JobCreate)
+
+			contentType, body := multipartBody(t,
+				map[string]string{"project_id": "shop", "version_id": "v1", "spider": "items"},
+				map[string][][2]string{"input_files": tt.files},
+			)
+			w, _ := serve(t, router, http.MethodPost, "/jobs", contentType, body)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if n := testutil.Count[models.InputFile](t, "1 = 1"); n != 0 {
+				t.Fatalf("%d input rows left behind", n)
+			}
+			if blobs := storedBlobs(t); len(blobs) != 0 {
+				t.Fatalf("blobs left behind %v", blobs)
+			}
+		})
+	}
+}
+
+func TestInputDeleteReferenced(t *testing.T) {
+	setupJobs(t)
+	testutil.Create(t,
+		&models.InputFile{ID: "used", ProjectID: "shop", Name: "a.txt", Hash: "aa", Path: filepath.Join(t.TempDir(), "aa")},
+		&models.InputFile{ID: "unused", ProjectID: "shop", Name: "b.txt", Hash: "bb", Path: filepath.Join(t.TempDir(), "bb")},
+		&models.Job{ID: "j1", ProjectID: "shop", VersionID: "v1", Spider: "items", Status: "finished", Inputs: []string{"used"}},
+	)
+	router := newRouter(admin, http.MethodDelete, "/inputs/:project_id/:input_id", InputDelete)
+
+	w, response := serve(t, router, http.MethodDelete, "/inputs/shop/used", "", nil)
+	if w.Code != http.StatusConflict || response.Code != "INPUT_IN_USE" {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if n := testutil.Count[models.InputFile](t, "id = ?", "used"); n != 1 {
+		t.Fatal("referenced input was deleted")
+	}
+
+	if w, _ := serve(t, router, http.MethodDelete, "/inputs/shop/unused", "", nil); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if n := testutil.Count[models.InputFile](t, "id = ?", "unused"); n != 0 {
+		t.Fatal("unused input was kept")
+	}
+}
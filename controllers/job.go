@@ -5,7 +5,10 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"scrapyd/api/errs"
 	"scrapyd/api/types"
@@ -14,6 +17,7 @@ import (
 	"scrapyd/tasks"
 	"slices"
 	"strings"
+	"time"
 )
 
 type flushingWriter struct {
@@ -32,29 +36,77 @@ func (fw *flushingWriter) Write(p []byte) (int, error) {
 func JobCreate(c *gin.Context) {
 	var request types.JobRequest
 
-	if err := c.MustBindWith(&request, binding.JSON); err != nil {
+	if c.ContentType() == binding.MIMEMultipartPOSTForm {
+		if err := c.ShouldBindWith(&request, binding.FormMultipart); err != nil {
+			c.Error(err).SetType(gin.ErrorTypeBind)
+			return
+		}
+	} else if err := c.ShouldBindWith(&request, binding.JSON); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
-	if err := models.DB.First(&models.Project{}, "id = ?", request.ProjectID).Error; err != nil {
-		c.Error(errs.ErrProjectNotFound)
+
+	job, err := jobCreate(c, &request)
+	if err != nil {
+		c.Error(err)
 		return
 	}
+	audit(c, "job", job.ID, job.ProjectID, nil, job)
+
+	c.JSON(http.StatusCreated, types.Response{
+		Status:  "success",
+		Message: "created",
+		Data:    job,
+	})
+}
+
+// jobCreate validates the request, admits the job and enqueues it for execution.
+func jobCreate(c *gin.Context, request *types.JobRequest) (*models.Job, error) {
+	if err := authorize(c, "schedule", request.ProjectID); err != nil {
+		return nil, err
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", request.ProjectID).Error; err != nil {
+		return nil, errs.ErrProjectNotFound
+	}
+	// version_id may also name an alias of the project
+	var alias string
 	var version models.Version
-	if err := models.DB.First(&version, "id = ?", request.VersionID).Error; err != nil {
-		c.Error(errs.ErrVersionNotFound)
-		return
+	if err := models.DB.First(&version, "id = ? AND project_id = ?", request.VersionID, request.ProjectID).Error; err != nil {
+		resolved, err := services.AliasResolve(request.ProjectID, request.VersionID)
+		if err != nil {
+			return nil, errs.ErrVersionNotFound
+		}
+		alias = request.VersionID
+		version = *resolved
+	}
+	if version.Status != "ready" {
+		return nil, errs.ErrVersionNotReady
 	}
 	if !slices.Contains(version.Spiders, request.Spider) {
-		c.Error(errs.ErrSpiderNotFound)
-		return
+		return nil, errs.ErrSpiderNotFound
 	}
 	if request.ID != "" {
 		if err := models.DB.First(&models.Job{}, "id = ?", request.ID).Error; err == nil {
-			c.Error(errs.ErrJobConflict)
-			return
+			return nil, errs.ErrJobConflict
+		}
+	}
+
+	for name := range request.Env {
+		if !services.EnvNameValid(name) {
+			return nil, errs.ErrEnvInvalid
+		}
+	}
+	for _, name := range request.Secrets {
+		if err := models.DB.First(&models.Secret{}, "project_id = ? AND name = ?", request.ProjectID, name).Error; err != nil {
+			return nil, errs.ErrSecretNotFound
 		}
 	}
 
+	inputs, uploads, err := jobInputs(c, request)
+	if err != nil {
+		return nil, err
+	}
+
 	if request.ID == "" {
 		reqID, _ := uuid.NewUUID()
 		request.ID = strings.ReplaceAll(reqID.String(), "-", "")
@@ -62,28 +114,117 @@ func JobCreate(c *gin.Context) {
 	job := models.Job{
 		ID:        request.ID,
 		ProjectID: request.ProjectID,
-		VersionID: request.VersionID,
+		VersionID: version.ID,
+		Alias:     alias,
 		Status:    "pending",
 		Spider:    request.Spider,
 		Setting:   request.Setting,
+		Env:       request.Env,
+		Secrets:   request.Secrets,
+		Args:      request.Args,
 	}
 
-	if err := tasks.NewTask("execute:job", job.ID); err != nil {
-		c.Error(err)
-		return
+	// per-job uniqueness wins over the spider policy
+	policy := models.SpiderPolicy{Uniqueness: "allow"}
+	models.DB.Limit(1).Find(&policy, "project_id = ? AND spider = ?", job.ProjectID, job.Spider)
+	job.Uniqueness = policy.Uniqueness
+	if request.Uniqueness != "" {
+		job.Uniqueness = request.Uniqueness
 	}
+	job.Fingerprint = services.JobFingerprint(&job, policy.UniqueByArgs || request.UniqueByArgs)
 
-	models.DB.Create(&job)
-	c.JSON(http.StatusCreated, types.Response{
-		Status:  "success",
-		Message: "created",
+	// queued jobs get dispatched once the identical running one is done,
+	// uploads are only stored for admitted jobs
+	var stored []models.InputFile
+	err = services.JobAdmit(&job, func(tx *gorm.DB) error {
+		stored, err = jobUploads(tx, &job, inputs, uploads)
+		return err
 	})
+	if err != nil {
+		for _, input := range stored {
+			services.InputCleanup(&input)
+		}
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// jobInputs collects the referenced input files and the ones uploaded along with the job,
+// checking their names before anything gets stored.
+func jobInputs(c *gin.Context, request *types.JobRequest) ([]models.InputFile, []*multipart.FileHeader, error) {
+	var inputs []models.InputFile
+
+	if len(request.Inputs) > 0 {
+		if err := models.DB.Find(&inputs, "id IN ? AND project_id = ?", request.Inputs, request.ProjectID).Error; err != nil {
+			return nil, nil, err
+		}
+		if len(inputs) != len(slices.Compact(slices.Sorted(slices.Values(request.Inputs)))) {
+			return nil, nil, errs.ErrInputNotFound
+		}
+	}
+
+	var uploads []*multipart.FileHeader
+	if form, err := c.MultipartForm(); err == nil {
+		uploads = form.File["input_files"]
+	}
+
+	names := make(map[string]bool)
+	for _, input := range inputs {
+		names[input.Name] = true
+	}
+	for _, fileHeader := range uploads {
+		name, err := services.InputName(fileHeader.Filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		if names[name] {
+			return nil, nil, errs.ErrInputDuplicate
+		}
+		names[name] = true
+	}
+
+	return inputs, uploads, nil
+}
+
+// jobUploads stores the uploads of an admitted job so that it can be rerun with the exact
+// same content, the job gets pointed at them along with the referenced inputs.
+func jobUploads(tx *gorm.DB, job *models.Job, inputs []models.InputFile, uploads []*multipart.FileHeader) ([]models.InputFile, error) {
+	var stored []models.InputFile
+	for _, fileHeader := range uploads {
+		file, err := fileHeader.Open()
+		if err != nil {
+			return stored, errs.ErrInputInvalid
+		}
+		input, err := services.InputStore(job.ProjectID, fileHeader.Filename, file)
+		file.Close()
+		if err != nil {
+			return stored, err
+		}
+		stored = append(stored, *input)
+		if err := tx.Create(input).Error; err != nil {
+			return stored, err
+		}
+	}
+
+	all := append(slices.Clone(inputs), stored...)
+	job.Inputs = nil
+	for _, input := range all {
+		job.Inputs = append(job.Inputs, input.ID)
+	}
+	job.InputHash = services.InputHash(all)
+	return stored, nil
+}
+
+// unscoped lets jobs show the versions deleted since they ran
+func unscoped(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
 }
 
 func JobList(c *gin.Context) {
 	var jobs []models.Job
 
-	models.DB.Preload("Project").Preload("Version").Find(&jobs)
+	visible(c, models.DB, "project_id", "read").Preload("Project").Preload("Version", unscoped).Find(&jobs)
 	c.JSON(http.StatusOK, types.Response{
 		Status: "success",
 		Data:   jobs,
@@ -94,10 +235,14 @@ func JobGet(c *gin.Context) {
 	var job models.Job
 
 	id := c.Params.ByName("id")
-	if err := models.DB.Preload("Project").Preload("Version").First(&job, "id = ?", id).Error; err != nil {
+	if err := models.DB.Preload("Project").Preload("Version", unscoped).First(&job, "id = ?", id).Error; err != nil {
 		c.Error(errs.ErrJobNotFound)
 		return
 	}
+	if err := authorize(c, "read", job.ProjectID); err != nil {
+		c.Error(err)
+		return
+	}
 
 	c.JSON(http.StatusOK, types.Response{
 		Status: "success",
@@ -107,12 +252,10 @@ func JobGet(c *gin.Context) {
 
 func JobUpdate(c *gin.Context) {
 	var existingJob models.Job
-	var updateData struct {
-		ID     string `json:"id" binding:"required"`
-		Status string `json:"status" binding:"required"`
-	}
+	var updateData types.JobUpdateRequest
 
-	if err := c.MustBindWith(&updateData, binding.JSON); err != nil {
+	if err := c.ShouldBindWith(&updateData, binding.JSON); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
@@ -120,18 +263,15 @@ func JobUpdate(c *gin.Context) {
 		c.Error(errs.ErrJobNotFound)
 		return
 	}
-
-	if updateData.Status == "cancel" {
-		if err := tasks.NewTask("cancel:job", updateData.ID); err != nil {
-			c.Error(err)
-			return
-		}
+	if err := authorize(c, "schedule", existingJob.ProjectID); err != nil {
+		c.Error(err)
+		return
 	}
-	if updateData.Status == "restart" {
-		if err := tasks.NewTask("restart:job", updateData.ID); err != nil {
-			c.Error(err)
-			return
-		}
+
+	audit(c, "job", existingJob.ID, existingJob.ProjectID, existingJob, updateData)
+	if err := jobAction(&existingJob, updateData.Status); err != nil {
+		c.Error(err)
+		return
 	}
 
 	c.JSON(http.StatusOK, types.Response{
@@ -148,31 +288,168 @@ func JobDelete(c *gin.Context) {
 		c.Error(errs.ErrJobNotFound)
 		return
 	}
+	if err := authorize(c, "schedule", job.ProjectID); err != nil {
+		c.Error(err)
+		return
+	}
 
-	// cleanup the related stuff like container
-	if err := services.JobCleanup(&job); err != nil {
+	audit(c, "job", job.ID, job.ProjectID, job, nil)
+	if err := jobAction(&job, "delete"); err != nil {
 		c.Error(err)
 		return
 	}
 
-	models.DB.Delete(&job)
 	c.JSON(http.StatusOK, types.Response{
 		Status:  "success",
 		Message: "deleted",
 	})
 }
 
+// jobAction applies a single cancel, restart or delete, shared by the single and bulk endpoints.
+func jobAction(job *models.Job, action string) error {
+	switch action {
+	case "cancel":
+		return tasks.NewTask("cancel:job", job.ID)
+	case "restart":
+		return tasks.NewTask("restart:job", job.ID)
+	case "delete":
+		// cleanup the related stuff like container
+		if err := services.JobCleanup(job); err != nil {
+			return err
+		}
+		if err := models.DB.Delete(job).Error; err != nil {
+			return err
+		}
+		// the die event of the container won't find the job anymore to release those queued behind it
+		if err := tasks.DropExecuteTasks(job.ID); err != nil {
+			return err
+		}
+		return tasks.ReleaseQueuedJob(job.Fingerprint)
+	}
+
+	return nil
+}
+
+func JobBatchCreate(c *gin.Context) {
+	var request types.JobBatchRequest
+
+	if err := c.ShouldBindWith(&request, binding.JSON); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	results := make([]types.JobResult, 0, len(request.Jobs))
+	for _, jobRequest := range request.Jobs {
+		result := types.JobResult{ID: jobRequest.ID, Status: "success", Message: "created"}
+		if job, err := jobCreate(c, &jobRequest); err != nil {
+			jobFailed(c, &result, err)
+		} else {
+			result.ID = job.ID
+		}
+		results = append(results, result)
+	}
+	audit(c, "job", "", "", nil, results)
+
+	c.JSON(http.StatusOK, types.Response{
+		Status: "success",
+		Data:   results,
+	})
+}
+
+// jobFailed reports the error of one job of a batch the way error responses do,
+// unexpected errors are only logged.
+func jobFailed(c *gin.Context, result *types.JobResult, err error) {
+	known := errs.Known(err)
+	if known == errs.ErrInternal {
+		log.Error().
+			Err(err).
+			Str("request", c.GetString(RequestIDKey)).
+			Str("job", result.ID).
+			Msg("job operation failed")
+	}
+	result.Status = "error"
+	result.Code = errs.ErrCodeMap[known]
+	result.Message = known.Error()
+}
+
+func JobBulkUpdate(c *gin.Context) {
+	var request types.JobBulkRequest
+	var jobs []models.Job
+
+	if err := c.ShouldBindWith(&request, binding.JSON); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	filter := request.Filter
+	if filter.ProjectID == "" && filter.VersionID == "" && filter.Spider == "" && len(filter.Status) == 0 && filter.OlderThanDays == 0 {
+		c.Error(errs.ErrJobFilterEmpty)
+		return
+	}
+
+	if err := authorize(c, "schedule", filter.ProjectID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	query := visible(c, models.DB.Model(&models.Job{}), "project_id", "schedule")
+	if filter.ProjectID != "" {
+		query = query.Where("project_id = ?", filter.ProjectID)
+	}
+	if filter.VersionID != "" {
+		query = query.Where("version_id = ?", filter.VersionID)
+	}
+	if filter.Spider != "" {
+		query = query.Where("spider = ?", filter.Spider)
+	}
+	if len(filter.Status) > 0 {
+		query = query.Where("status IN ?", filter.Status)
+	}
+	if filter.OlderThanDays > 0 {
+		query = query.Where("created_at < ?", time.Now().AddDate(0, 0, -filter.OlderThanDays))
+	}
+	if err := query.Find(&jobs).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	results := make([]types.JobResult, 0, len(jobs))
+	for _, job := range jobs {
+		result := types.JobResult{ID: job.ID, Status: "success", Message: request.Action}
+		if err := jobAction(&job, request.Action); err != nil {
+			jobFailed(c, &result, err)
+		}
+		results = append(results, result)
+	}
+	audit(c, "job", "", filter.ProjectID, filter, results)
+
+	c.JSON(http.StatusOK, types.Response{
+		Status: "success",
+		Data:   results,
+	})
+}
+
 func JobLogStream(c *gin.Context) {
+	var request types.JobLogRequest
 	var job models.Job
 
+	if err := c.ShouldBindWith(&request, binding.Query); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
 	id := c.Params.ByName("id")
 	if err := models.DB.First(&job, "id = ?", id).Error; err != nil {
 		c.Error(errs.ErrJobNotFound)
 		return
 	}
+	if err := authorize(c, "read", job.ProjectID); err != nil {
+		c.Error(err)
+		return
+	}
 
 	reqCtx := c.Request.Context()
-	reader, err := services.JobLogReader(reqCtx, &job)
+	reader, err := services.JobLogReader(reqCtx, &job, request.Follow)
 	if err != nil {
 		c.Error(err)
 		return
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"scrapyd/api/types"
+	"scrapyd/models"
+	"scrapyd/testutil"
+	"slices"
+	"testing"
+	"time"
+)
+
+func results(t *testing.T, response types.Response) []types.JobResult {
+	t.Helper()
+	data, _ := json.Marshal(response.Data)
+	var results []types.JobResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+func TestJobBatchCreateErrorCodes(t *testing.T) {
+	setupJobs(t)
+	router := newRouter(admin, http.MethodPost, "/jobs/batch", JobBatchCreate)
+
+	w, response := serveJSON(t, router, http.MethodPost, "/jobs/batch", map[string]any{"jobs": []map[string]any{
+		{"project_id": "shop", "version_id": "v1", "spider": "items"},
+		{"project_id": "shop", "version_id": "v2", "spider": "items"},
+		{"project_id": "shop", "version_id": "v1", "spider": "items", "secrets": []string{"missing"}},
+	}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	got := results(t, response)
+	want := []struct{ status, code string }{{"success", ""}, {"error", "VERSION_NOT_FOUND"}, {"error", "SECRET_NOT_FOUND"}}
+	if len(got) != len(want) {
+		t.Fatalf("results %+v", got)
+	}
+	for i := range want {
+		if got[i].Status != want[i].status || got[i].Code != want[i].code {
+			t.Errorf("result %d: %+v, want %s %s", i, got[i], want[i].status, want[i].code)
+		}
+	}
+}
+
+func TestJobBulkUpdateOlderThan(t *testing.T) {
+	setupJobs(t)
+	testutil.Create(t,
+		&models.Job{ID: "old", ProjectID: "shop", VersionID: "v1", Spider: "items", Status: "finished", CreatedAt: time.Now().AddDate(0, 0, -10)},
+		&models.Job{ID: "new", ProjectID: "shop", VersionID: "v1", Spider: "items", Status: "finished"},
+	)
+	router := newRouter(admin, http.MethodPost, "/jobs/bulk", JobBulkUpdate)
+
+	w, response := serveJSON(t, router, http.MethodPost, "/jobs/bulk", map[string]any{
+		"action": "delete",
+		"filter": map[string]any{"older_than_days": 7},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var ids []string
+	for _, result := range results(t, response) {
+		ids = append(ids, result.ID)
+		// without a docker daemon the cleanup fails, the caller only gets the code
+		if result.Status == "error" && (result.Code == "" || result.Message != "internal server error") {
+			t.Errorf("result %+v", result)
+		}
+	}
+	if !slices.Equal(ids, []string{"old"}) {
+		t.Fatalf("matched %v", ids)
+	}
+}
+
+func TestJobCreateVersionOfOtherProject(t *testing.T) {
+	setupJobs(t)
+	testutil.Create(t,
+		&models.Project{ID: "blog"},
+		&models.Version{ID: "b1", ProjectID: "blog", Image: "blog:b1", Status: "ready", Spiders: []string{"items"}},
+	)
+	router := newRouter(admin, http.MethodPost, "/jobs", JobCreate)
+
+	w, response := serveJSON(t, router, http.MethodPost, "/jobs", map[string]any{"project_id": "shop", "version_id": "b1", "spider": "items"})
+	if w.Code != http.StatusNotFound || response.Code != "VERSION_NOT_FOUND" {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if n := testutil.Count[models.Job](t, "1 = 1"); n != 0 {
+		t.Fatal("job created")
+	}
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"scrapyd/api/errs"
+	"scrapyd/api/types"
+	"scrapyd/models"
+	"scrapyd/services"
+)
+
+func KeyList(c *gin.Context) {
+	var keys []models.TrustedKey
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "read", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	models.DB.Find(&keys, "project_id = ?", projectID)
+	c.JSON(http.StatusOK, types.Response{
+		Status: "success",
+		Data:   keys,
+	})
+}
+
+// KeyPut trusts the key for image tar signatures, once a project has a key unsigned uploads are rejected.
+func KeyPut(c *gin.Context) {
+	var request types.TrustedKeyRequest
+
+	if err := c.ShouldBindWith(&request, binding.JSON); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "admin", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	if _, err := services.ParsePublicKey(request.PublicKey); err != nil {
+		c.Error(err)
+		return
+	}
+
+	key := models.TrustedKey{
+		ProjectID: projectID,
+		Name:      c.Params.ByName("name"),
+		PublicKey: request.PublicKey,
+	}
+	audit(c, "key", key.Name, projectID, auditBefore[models.TrustedKey]("project_id = ? AND name = ?", projectID, key.Name), &key)
+	if err := models.DB.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"public_key", "updated_at"}),
+	}).Create(&key).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "updated",
+	})
+}
+
+func KeyDelete(c *gin.Context) {
+	var key models.TrustedKey
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "admin", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	name := c.Params.ByName("name")
+	if err := models.DB.First(&key, "project_id = ? AND name = ?", projectID, name).Error; err != nil {
+		c.Error(errs.ErrKeyNotFound)
+		return
+	}
+
+	audit(c, "key", name, projectID, key, nil)
+	if err := models.DB.Delete(&key).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "deleted",
+	})
+}
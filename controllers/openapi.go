@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"scrapyd/api/openapi"
+	"scrapyd/api/types"
+	"scrapyd/models"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// operation documents a handler, the schemas are derived from the Go types it binds and answers with.
+type operation struct {
+	summary  string
+	query    any             // struct with form tags, its fields are the query parameters
+	body     any             // request struct, JSON unless form is set
+	form     bool            // the body is a form, multipart when it has files
+	json     bool            // a form body may also be sent as JSON
+	files    map[string]bool // file fields of the multipart body, true when required
+	status   int             // success status, 200 unless set
+	data     any             // data of the success response
+	plain    bool            // data is the whole response, without the types.Response envelope
+	produces string          // media type of streamed responses
+	public   bool            // no authentication required
+}
+
+var operations = map[string]operation{
+	"ProjectCreate":          {summary: "Create a project", body: types.ProjectRequest{}, status: http.StatusCreated},
+	"ProjectList":            {summary: "List projects with their versions", data: []models.Project{}},
+	"ProjectDelete":          {summary: "Delete a project with its versions and jobs", query: types.ProjectDeleteRequest{}},
+	"EnvList":                {summary: "List the env vars of a project", data: []models.EnvVar{}},
+	"EnvPut":                 {summary: "Set an env var", body: types.EnvVarRequest{}},
+	"EnvDelete":              {summary: "Delete an env var"},
+	"SecretList":             {summary: "List the secret names of a project", data: []models.Secret{}},
+	"SecretPut":              {summary: "Set a secret", body: types.SecretRequest{}},
+	"SecretDelete":           {summary: "Delete a secret"},
+	"PolicyList":             {summary: "List the spider policies of a project", data: []models.SpiderPolicy{}},
+	"PolicyPut":              {summary: "Set the uniqueness policy of a spider", body: types.SpiderPolicyRequest{}},
+	"PolicyDelete":           {summary: "Delete a spider policy"},
+	"RegistryList":           {summary: "List the registry credentials of a project", data: []models.RegistryCredential{}},
+	"RegistryPut":            {summary: "Set the credential of a registry", body: types.RegistryRequest{}},
+	"RegistryDelete":         {summary: "Delete a registry credential"},
+	"KeyList":                {summary: "List the keys trusted to sign versions", data: []models.TrustedKey{}},
+	"KeyPut":                 {summary: "Trust a public key", body: types.TrustedKeyRequest{}},
+	"KeyDelete":              {summary: "Delete a trusted key"},
+	"AliasList":              {summary: "List the aliases of a project", data: []models.Alias{}},
+	"AliasPromote":           {summary: "Point an alias at a version", body: types.AliasRequest{}, data: models.Alias{}},
+	"AliasDelete":            {summary: "Delete an alias"},
+	"AliasRollback":          {summary: "Undo the latest promotion of an alias not undone yet", data: models.Alias{}},
+	"AliasHistory":           {summary: "List the changes of an alias", data: []models.AliasChange{}},
+	"ProjectBuildPut":        {summary: "Set the base image of builds", body: types.BuildRequest{}},
+	"RoleList":               {summary: "List the roles on a project", data: []models.ProjectRole{}},
+	"RolePut":                {summary: "Give a user or team a role on a project", body: types.RoleRequest{}},
+	"RoleDelete":             {summary: "Remove a role"},
+	"ProjectRetentionReport": {summary: "Report what the retention policy would remove", data: types.RetentionReport{}},
+	"ProjectRetentionPut":    {summary: "Set the retention policy", body: types.RetentionRequest{}},
+
+	"VersionCreate": {
+		summary: "Upload an image, a project source or an export, or pull an image",
+		body:    types.VersionRequest{}, form: true, json: true,
+		files:  map[string]bool{"image_tar": false, "source_zip": false, "signature": false},
+		status: http.StatusAccepted, data: models.Version{},
+	},
+	"VersionList":      {summary: "List the versions of a project", data: []models.Version{}},
+	"VersionDelete":    {summary: "Delete a version", query: types.VersionDeleteRequest{}},
+	"VersionCompare":   {summary: "Compare the spiders, settings and dependencies of two versions", query: types.VersionCompareRequest{}, data: types.VersionDiff{}},
+	"VersionExport":    {summary: "Download the version image with its metadata", query: types.VersionExportRequest{}, produces: "application/x-tar"},
+	"VersionBuildLogs": {summary: "Download the build log", produces: "text/plain"},
+	"VersionInspect":   {summary: "Inspect the version image again", status: http.StatusAccepted},
+
+	"JobCreate": {
+		summary: "Schedule a job",
+		body:    types.JobRequest{}, form: true, json: true,
+		files:  map[string]bool{"input_files": false},
+		status: http.StatusCreated, data: models.Job{},
+	},
+	"JobList":        {summary: "List jobs", data: []models.Job{}},
+	"JobGet":         {summary: "Get a job", data: models.Job{}},
+	"JobUpdate":      {summary: "Cancel, restart or delete a job", body: types.JobUpdateRequest{}},
+	"JobDelete":      {summary: "Delete a job"},
+	"JobLogStream":   {summary: "Stream the job logs", query: types.JobLogRequest{}, produces: "text/plain"},
+	"JobBatchCreate": {summary: "Schedule several jobs", body: types.JobBatchRequest{}, data: []types.JobResult{}},
+	"JobBulkUpdate":  {summary: "Cancel, restart or delete the jobs matching a filter", body: types.JobBulkRequest{}, data: []types.JobResult{}},
+
+	"InputCreate": {
+		summary: "Upload an input file",
+		body:    types.InputRequest{}, form: true,
+		files:  map[string]bool{"file": true},
+		status: http.StatusCreated, data: models.InputFile{},
+	},
+	"InputList":   {summary: "List the input files of a project", data: []models.InputFile{}},
+	"InputDelete": {summary: "Delete an input file no job uses"},
+
+	"TokenCreate": {summary: "Create an API token", body: types.TokenRequest{}, status: http.StatusCreated, data: types.TokenCreated{}},
+	"TokenList":   {summary: "List API tokens", data: []models.Token{}},
+	"TokenRevoke": {summary: "Revoke an API token"},
+
+	"UserCreate":       {summary: "Create a user", body: types.UserRequest{}, status: http.StatusCreated, data: models.User{}},
+	"UserList":         {summary: "List users", data: []models.User{}},
+	"UserDelete":       {summary: "Delete a user"},
+	"TeamCreate":       {summary: "Create a team", body: types.TeamRequest{}, status: http.StatusCreated},
+	"TeamList":         {summary: "List teams with their members", data: []models.Team{}},
+	"TeamDelete":       {summary: "Delete a team"},
+	"TeamMemberPut":    {summary: "Add a user to a team"},
+	"TeamMemberDelete": {summary: "Remove a user from a team"},
+
+	"AuditList":   {summary: "List audit entries, newest first", query: types.AuditFilter{}, data: []models.AuditEntry{}},
+	"AuditExport": {summary: "Export audit entries as JSON lines", query: types.AuditFilter{}, produces: "application/x-ndjson"},
+
+	"DaemonStatus": {summary: "Report the daemon and job counts", data: map[string]any{}},
+	"OpenAPISpec":  {summary: "This document", data: map[string]any{}, plain: true, public: true},
+	"Dashboard":    {summary: "Web dashboard", produces: "text/html", public: true},
+
+	"ScrapydDaemonStatus": {summary: "scrapyd daemonstatus.json", data: map[string]any{}, plain: true},
+	"ScrapydListProjects": {summary: "scrapyd listprojects.json", data: map[string]any{}, plain: true},
+	"ScrapydListVersions": {summary: "scrapyd listversions.json", query: types.ScrapydProjectRequest{}, data: map[string]any{}, plain: true},
+	"ScrapydListSpiders":  {summary: "scrapyd listspiders.json", query: types.ScrapydSpidersRequest{}, data: map[string]any{}, plain: true},
+	"ScrapydListJobs":     {summary: "scrapyd listjobs.json", query: types.ScrapydJobsRequest{}, data: map[string]any{}, plain: true},
+	"ScrapydAddVersion": {
+		summary: "scrapyd addversion.json",
+		body:    types.ScrapydAddVersionRequest{}, form: true,
+		files: map[string]bool{"egg": true, "signature": false},
+		data:  map[string]any{}, plain: true,
+	},
+	"ScrapydSchedule":   {summary: "scrapyd schedule.json, other parameters are spider arguments", body: types.ScrapydScheduleRequest{}, form: true, data: map[string]any{}, plain: true},
+	"ScrapydCancel":     {summary: "scrapyd cancel.json", body: types.ScrapydCancelRequest{}, form: true, data: map[string]any{}, plain: true},
+	"ScrapydDelVersion": {summary: "scrapyd delversion.json", body: types.ScrapydVersionRequest{}, form: true, data: map[string]any{}, plain: true},
+	"ScrapydDelProject": {summary: "scrapyd delproject.json", body: types.ScrapydProjectRequest{}, form: true, data: map[string]any{}, plain: true},
+}
+
+var (
+	openAPI           *openapi.Document
+	openAPIOperations = make(map[string]*openapi.Operation)
+	routeParam        = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+)
+
+// OpenAPIInit documents the registered routes, it has to run once all of them are in place.
+func OpenAPIInit(routes gin.RoutesInfo) {
+	doc := openapi.New("scrapyd", "1.0.0")
+	errorResponse := openapi.Response{
+		Description: "error",
+		Content:     map[string]openapi.MediaType{"application/json": {Schema: doc.Schema(types.Response{}, "json")}},
+	}
+
+	for _, route := range routes {
+		name := route.Handler[strings.LastIndex(route.Handler, ".")+1:]
+		spec := operations[name]
+
+		path := routeParam.ReplaceAllString(route.Path, "{$1}")
+		op := &openapi.Operation{
+			OperationID: strings.ToLower(name[:1]) + name[1:],
+			Summary:     spec.summary,
+			Tags:        []string{routeTag(route.Path)},
+			Responses:   map[string]openapi.Response{"default": errorResponse},
+		}
+		if spec.public {
+			op.Security = &[]map[string][]string{}
+		}
+
+		for _, match := range routeParam.FindAllStringSubmatch(route.Path, -1) {
+			op.Parameters = append(op.Parameters, openapi.Parameter{
+				Name: match[1], In: "path", Required: true, Schema: &openapi.Schema{Type: "string"},
+			})
+		}
+		if spec.query != nil {
+			names, properties, required := doc.Fields(reflect.TypeOf(spec.query), "form")
+			for _, param := range names {
+				op.Parameters = append(op.Parameters, openapi.Parameter{
+					Name: param, In: "query", Required: slices.Contains(required, param), Schema: properties[param],
+				})
+			}
+		}
+
+		if spec.body != nil {
+			op.RequestBody = &openapi.RequestBody{Required: true, Content: make(map[string]openapi.MediaType)}
+			if !spec.form || spec.json {
+				op.RequestBody.Content["application/json"] = openapi.MediaType{Schema: doc.Schema(spec.body, "json")}
+			}
+			if spec.form {
+				schema := doc.Schema(spec.body, "form")
+				for file, required := range spec.files {
+					schema.Properties[file] = &openapi.Schema{Type: "string", Format: "binary"}
+					if required {
+						schema.Required = append(schema.Required, file)
+					}
+				}
+				mediaType := "application/x-www-form-urlencoded"
+				if len(spec.files) > 0 {
+					mediaType = "multipart/form-data"
+				}
+				op.RequestBody.Content[mediaType] = openapi.MediaType{Schema: schema}
+			}
+		}
+
+		status := spec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		response := openapi.Response{Description: http.StatusText(status)}
+		switch {
+		case spec.produces != "":
+			response.Content = map[string]openapi.MediaType{spec.produces: {Schema: &openapi.Schema{Type: "string", Format: "binary"}}}
+		case spec.plain:
+			response.Content = map[string]openapi.MediaType{"application/json": {Schema: doc.Schema(spec.data, "json")}}
+		default:
+			envelope := &openapi.Schema{
+				Type: "object",
+				Properties: map[string]*openapi.Schema{
+					"status":  {Type: "string", Enum: []string{"success"}},
+					"message": {Type: "string"},
+				},
+				Required: []string{"status"},
+			}
+			if spec.data != nil {
+				envelope.Properties["data"] = doc.Schema(spec.data, "json")
+			}
+			response.Content = map[string]openapi.MediaType{"application/json": {Schema: envelope}}
+		}
+		op.Responses[strconv.Itoa(status)] = response
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*openapi.Operation)
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = op
+		openAPIOperations[route.Method+" "+route.Path] = op
+	}
+
+	openAPI = doc
+}
+
+// routeTag groups operations by their first path segment, the classic API apart.
+func routeTag(path string) string {
+	if strings.HasSuffix(path, ".json") {
+		return "scrapyd"
+	}
+	tag, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	return tag
+}
+
+func OpenAPISpec(c *gin.Context) {
+	c.JSON(http.StatusOK, openAPI)
+}
+
+// ValidateRequest checks the query and body of the request against the OpenAPI document,
+// binding still runs afterwards so handlers see the same values.
+func ValidateRequest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		op := openAPIOperations[c.Request.Method+" "+c.FullPath()]
+		if op == nil {
+			return
+		}
+
+		var details []types.FieldError
+		query := c.Request.URL.Query()
+		for _, param := range op.Parameters {
+			if param.In != "query" {
+				continue
+			}
+			values := query[param.Name]
+			if len(values) == 0 {
+				if param.Required {
+					details = append(details, types.FieldError{Field: param.Name, Rule: "required", Message: param.Name + " is required"})
+				}
+				continue
+			}
+			for _, value := range values {
+				details = append(details, openAPI.ValidateString(param.Schema, value, param.Name)...)
+			}
+		}
+		if op.RequestBody != nil {
+			details = append(details, validateBody(c, op.RequestBody)...)
+		}
+
+		if len(details) > 0 {
+			c.Error(&openapi.ValidationError{Details: details}).SetType(gin.ErrorTypeBind)
+			c.Abort()
+		}
+	}
+}
+
+// validateBody checks forms against their form schema and anything else as JSON, bodies
+// that don't parse are left to binding to report.
+func validateBody(c *gin.Context, body *openapi.RequestBody) []types.FieldError {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if content, ok := body.Content[mediaType]; ok && mediaType != "application/json" {
+		files := make(map[string]bool)
+		if mediaType == "multipart/form-data" {
+			form, err := c.MultipartForm()
+			if err != nil {
+				return nil
+			}
+			for name := range form.File {
+				files[name] = true
+			}
+		} else if err := c.Request.ParseForm(); err != nil {
+			return nil
+		}
+
+		var details []types.FieldError
+		for _, name := range content.Schema.Required {
+			if !files[name] && c.Request.Form.Get(name) == "" {
+				details = append(details, types.FieldError{Field: name, Rule: "required", Message: name + " is required"})
+			}
+		}
+		for name, property := range content.Schema.Properties {
+			for _, value := range c.Request.Form[name] {
+				details = append(details, openAPI.ValidateString(property, value, name)...)
+			}
+		}
+		slices.SortFunc(details, func(a, b types.FieldError) int { return strings.Compare(a.Field, b.Field) })
+		return details
+	}
+
+	content, ok := body.Content["application/json"]
+	if !ok || c.Request.Body == nil {
+		return nil
+	}
+	data, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil
+	}
+	return openAPI.Validate(content.Schema, value, "")
+}
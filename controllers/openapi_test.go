@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"scrapyd/api/openapi"
+	"scrapyd/api/types"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// apiRequest is a request to the route of an operation, sent as JSON, as a form or as a
+// multipart form when it has files.
+type apiRequest struct {
+	operation string
+	method    string
+	route     string
+	url       string
+	json      string
+	form      map[string]string
+	files     map[string][][2]string
+}
+
+// validRequests holds valid requests for every operation taking a body or query parameters.
+var validRequests = []apiRequest{
+	{operation: "ProjectCreate", method: http.MethodPost, route: "/projects", json: `{"id": "shop"}`},
+	{operation: "EnvPut", method: http.MethodPut, route: "/projects/:id/env/:name", url: "/projects/shop/env/API_URL", json: `{"value": "https://example.com"}`},
+	{operation: "SecretPut", method: http.MethodPut, route: "/projects/:id/secrets/:name", url: "/projects/shop/secrets/API_KEY", json: `{"value": "s3cret"}`},
+	{operation: "PolicyPut", method: http.MethodPut, route: "/projects/:id/policies/:spider", url: "/projects/shop/policies/items", json: `{"uniqueness": "queue", "unique_by_args": true}`},
+	{operation: "RegistryPut", method: http.MethodPut, route: "/projects/:id/registries/:registry", url: "/projects/shop/registries/ghcr.io", json: `{"username": "ci", "password": "pat"}`},
+	{operation: "KeyPut", method: http.MethodPut, route: "/projects/:id/keys/:name", url: "/projects/shop/keys/ci", json: `{"public_key": "-----BEGIN PUBLIC KEY-----"}`},
+	{operation: "AliasPromote", method: http.MethodPut, route: "/projects/:id/aliases/:name", url: "/projects/shop/aliases/prod", json: `{"version_id": "v1"}`},
+	{operation: "ProjectBuildPut", method: http.MethodPut, route: "/projects/:id/build", url: "/projects/shop/build", json: `{"base_image": ""}`},
+	{operation: "RolePut", method: http.MethodPut, route: "/projects/:id/roles/:subject_type/:subject_id", url: "/projects/shop/roles/user/ann", json: `{"role": "deployer"}`},
+	{operation: "ProjectRetentionPut", method: http.MethodPut, route: "/projects/:id/retention", url: "/projects/shop/retention", json: `{"retain_last": 5, "retain_unused_days": 0}`},
+	{operation: "VersionCreate", method: http.MethodPost, route: "/versions", json: `{"id": "v2", "project_id": "shop", "image": "registry.example.com/shop:v2"}`},
+	{operation: "VersionCreate", method: http.MethodPost, route: "/versions", form: map[string]string{"id": "v2", "project_id": "shop", "import": "true"}, files: map[string][][2]string{"image_tar": {{"shop.tar", "tar"}}, "signature": {{"shop.tar.sig", "sig"}}}},
+	{operation: "ProjectDelete", method: http.MethodDelete, route: "/projects/:id", url: "/projects/shop?force=true"},
+	{operation: "VersionDelete", method: http.MethodDelete, route: "/versions/:project_id/:version_id", url: "/versions/shop/v1?force=true"},
+	{operation: "VersionCompare", method: http.MethodGet, route: "/versions/:project_id/compare", url: "/versions/shop/compare?from=v1&to=prod"},
+	{operation: "VersionExport", method: http.MethodGet, route: "/versions/:project_id/:version_id/image", url: "/versions/shop/v1/image?gzip=true"},
+	{operation: "JobCreate", method: http.MethodPost, route: "/jobs", json: `{"project_id": "shop", "version_id": "prod", "spider": "items", "uniqueness": "", "args": {"page": "2"}, "env": {"LOG_LEVEL": "INFO"}, "inputs": ["urls"]}`},
+	{operation: "JobCreate", method: http.MethodPost, route: "/jobs", form: map[string]string{"project_id": "shop", "version_id": "v1", "spider": "items", "uniqueness": "queue"}, files: map[string][][2]string{"input_files": {{"urls.txt", "https://example.com"}}}},
+	{operation: "JobUpdate", method: http.MethodPatch, route: "/jobs", json: `{"id": "j1", "status": "cancel"}`},
+	{operation: "JobLogStream", method: http.MethodGet, route: "/jobs/:id/logs", url: "/jobs/j1/logs?follow=false"},
+	{operation: "JobBatchCreate", method: http.MethodPost, route: "/jobs/batch", json: `{"jobs": [{"project_id": "shop", "version_id": "v1", "spider": "items"}, {"project_id": "shop", "version_id": "v1", "spider": "items", "uniqueness": "reject"}]}`},
+	{operation: "JobBulkUpdate", method: http.MethodPost, route: "/jobs/bulk", json: `{"action": "delete", "filter": {"project_id": "shop", "status": ["finished", "failed"], "older_than_days": 7}}`},
+	{operation: "InputCreate", method: http.MethodPost, route: "/inputs", form: map[string]string{"project_id": "shop"}, files: map[string][][2]string{"file": {{"urls.txt", "https://example.com"}}}},
+	{operation: "TokenCreate", method: http.MethodPost, route: "/tokens", json: `{"name": "ci", "scopes": ["deploy", "schedule"], "project_ids": ["shop"]}`},
+	{operation: "UserCreate", method: http.MethodPost, route: "/users", json: `{"name": "ann", "password": "correct horse"}`},
+	{operation: "TeamCreate", method: http.MethodPost, route: "/teams", json: `{"name": "crawlers"}`},
+	{operation: "AuditList", method: http.MethodGet, route: "/audit", url: "/audit?outcome=&since=2026-01-01T00:00:00Z&limit=10&before_id=40"},
+	{operation: "AuditExport", method: http.MethodGet, route: "/audit/export", url: "/audit/export?outcome=denied&project_id=shop"},
+	{operation: "ScrapydListVersions", method: http.MethodGet, route: "/listversions.json", url: "/listversions.json?project=shop"},
+	{operation: "ScrapydListSpiders", method: http.MethodGet, route: "/listspiders.json", url: "/listspiders.json?project=shop&_version=v1"},
+	{operation: "ScrapydListJobs", method: http.MethodGet, route: "/listjobs.json", url: "/listjobs.json"},
+	{operation: "ScrapydAddVersion", method: http.MethodPost, route: "/addversion.json", form: map[string]string{"project": "shop", "version": "r42"}, files: map[string][][2]string{"egg": {{"shop.egg", "egg"}}}},
+	{operation: "ScrapydSchedule", method: http.MethodPost, route: "/schedule.json", form: map[string]string{"project": "shop", "spider": "items", "setting": "DOWNLOAD_DELAY=2", "page": "2"}},
+	{operation: "ScrapydCancel", method: http.MethodPost, route: "/cancel.json", form: map[string]string{"project": "shop", "job": "j1"}},
+	{operation: "ScrapydDelVersion", method: http.MethodPost, route: "/delversion.json", form: map[string]string{"project": "shop", "version": "v1"}},
+	{operation: "ScrapydDelProject", method: http.MethodPost, route: "/delproject.json", form: map[string]string{"project": "shop"}},
+}
+
+// validationRouter documents the routes of the requests and answers 204 to the requests that
+// pass ValidateRequest, without running the handlers.
+func validationRouter(t *testing.T, requests []apiRequest) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Next()
+		var validationErr *openapi.ValidationError
+		if len(c.Errors) > 0 && errors.As(c.Errors.Last().Err, &validationErr) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.Response{Status: "error", Details: validationErr.Details})
+		}
+	}, ValidateRequest(), func(c *gin.Context) {
+		c.AbortWithStatus(http.StatusNoContent)
+	})
+
+	handlers := map[string]gin.HandlerFunc{
+		"ProjectCreate": ProjectCreate, "EnvPut": EnvPut, "SecretPut": SecretPut, "PolicyPut": PolicyPut,
+		"RegistryPut": RegistryPut, "KeyPut": KeyPut, "AliasPromote": AliasPromote, "ProjectBuildPut": ProjectBuildPut,
+		"RolePut": RolePut, "ProjectRetentionPut": ProjectRetentionPut, "VersionCreate": VersionCreate,
+		"ProjectDelete": ProjectDelete, "VersionDelete": VersionDelete, "VersionCompare": VersionCompare, "VersionExport": VersionExport,
+		"JobCreate": JobCreate, "JobUpdate": JobUpdate, "JobLogStream": JobLogStream, "JobBatchCreate": JobBatchCreate,
+		"JobBulkUpdate": JobBulkUpdate, "InputCreate": InputCreate, "TokenCreate": TokenCreate, "UserCreate": UserCreate,
+		"TeamCreate": TeamCreate, "AuditList": AuditList, "AuditExport": AuditExport,
+		"ScrapydListVersions": ScrapydListVersions, "ScrapydListSpiders": ScrapydListSpiders, "ScrapydListJobs": ScrapydListJobs,
+		"ScrapydAddVersion": ScrapydAddVersion, "ScrapydSchedule": ScrapydSchedule, "ScrapydCancel": ScrapydCancel,
+		"ScrapydDelVersion": ScrapydDelVersion, "ScrapydDelProject": ScrapydDelProject,
+	}
+	registered := make(map[string]bool)
+	for _, request := range requests {
+		key := request.method + " " + request.route
+		if registered[key] {
+			continue
+		}
+		handler, ok := handlers[request.operation]
+		if !ok {
+			t.Fatalf("no handler for %s", request.operation)
+		}
+		router.Handle(request.method, request.route, handler)
+		registered[key] = true
+	}
+	OpenAPIInit(router.Routes())
+	return router
+}
+
+func sendRequest(t *testing.T, router *gin.Engine, request apiRequest) (*httptest.ResponseRecorder, types.Response) {
+	t.Helper()
+	url := request.url
+	if url == "" {
+		url = request.route
+	}
+	var contentType string
+	var body io.Reader
+	switch {
+	case request.files != nil:
+		contentType, body = multipartBody(t, request.form, request.files)
+	case request.form != nil:
+		values := make([]string, 0, len(request.form))
+		for name, value := range request.form {
+			values = append(values, name+"="+value)
+		}
+		contentType, body = "application/x-www-form-urlencoded", strings.NewReader(strings.Join(values, "&"))
+	case request.json != "":
+		contentType, body = "application/json", strings.NewReader(request.json)
+	}
+	return serve(t, router, request.method, url, contentType, body)
+}
+
+func TestValidateRequestAcceptsValidRequests(t *testing.T) {
+	covered := make(map[string]bool)
+	for _, request := range validRequests {
+		covered[request.operation] = true
+	}
+	for name, spec := range operations {
+		if (spec.body != nil || spec.query != nil) && !covered[name] {
+			t.Errorf("no valid request for %s", name)
+		}
+	}
+
+	router := validationRouter(t, validRequests)
+	for _, request := range validRequests {
+		t.Run(request.operation, func(t *testing.T) {
+			if w, _ := sendRequest(t, router, request); w.Code != http.StatusNoContent {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestValidateRequestRejectsInvalidRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		request apiRequest
+		field   string
+	}{
+		{
+			name:    "optional enum",
+			request: apiRequest{operation: "JobCreate", method: http.MethodPost, route: "/jobs", json: `{"project_id": "shop", "version_id": "v1", "spider": "items", "uniqueness": "sometimes"}`},
+			field:   "uniqueness",
+		},
+		{
+			name:    "optional enum in the query",
+			request: apiRequest{operation: "AuditList", method: http.MethodGet, route: "/audit", url: "/audit?outcome=maybe"},
+			field:   "outcome",
+		},
+		{
+			name:    "required enum left empty",
+			request: apiRequest{operation: "PolicyPut", method: http.MethodPut, route: "/projects/:id/policies/:spider", url: "/projects/shop/policies/items", json: `{"uniqueness": ""}`},
+			field:   "uniqueness",
+		},
+		{
+			name:    "enum items",
+			request: apiRequest{operation: "TokenCreate", method: http.MethodPost, route: "/tokens", json: `{"name": "ci", "scopes": ["deploy", "root"]}`},
+			field:   "scopes[1]",
+		},
+		{
+			name:    "path in an ID",
+			request: apiRequest{operation: "ScrapydAddVersion", method: http.MethodPost, route: "/addversion.json", form: map[string]string{"project": "shop", "version": "../r42"}, files: map[string][][2]string{"egg": {{"shop.egg", "egg"}}}},
+			field:   "version",
+		},
+		{
+			name:    "missing file",
+			request: apiRequest{operation: "InputCreate", method: http.MethodPost, route: "/inputs", form: map[string]string{"project_id": "shop"}, files: map[string][][2]string{}},
+			field:   "file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := validationRouter(t, []apiRequest{tt.request})
+			w, response := sendRequest(t, router, tt.request)
+			if w.Code != http.StatusBadRequest || !slices.ContainsFunc(response.Details, func(detail types.FieldError) bool { return detail.Field == tt.field }) {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
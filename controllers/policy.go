@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"scrapyd/api/errs"
+	"scrapyd/api/types"
+	"scrapyd/models"
+)
+
+func PolicyList(c *gin.Context) {
+	var policies []models.SpiderPolicy
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "read", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	models.DB.Find(&policies, "project_id = ?", projectID)
+	c.JSON(http.StatusOK, types.Response{
+		Status: "success",
+		Data:   policies,
+	})
+}
+
+func PolicyPut(c *gin.Context) {
+	var request types.SpiderPolicyRequest
+
+	if err := c.ShouldBindWith(&request, binding.JSON); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "admin", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	policy := models.SpiderPolicy{
+		ProjectID:    projectID,
+		Spider:       c.Params.ByName("spider"),
+		Uniqueness:   request.Uniqueness,
+		UniqueByArgs: request.UniqueByArgs,
+	}
+	audit(c, "policy", policy.Spider, projectID, auditBefore[models.SpiderPolicy]("project_id = ? AND spider = ?", projectID, policy.Spider), &policy)
+	if err := models.DB.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"uniqueness", "unique_by_args", "updated_at"}),
+	}).Create(&policy).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "updated",
+	})
+}
+
+func PolicyDelete(c *gin.Context) {
+	var policy models.SpiderPolicy
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "admin", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	spider := c.Params.ByName("spider")
+	if err := models.DB.First(&policy, "project_id = ? AND spider = ?", projectID, spider).Error; err != nil {
+		c.Error(errs.ErrPolicyNotFound)
+		return
+	}
+
+	audit(c, "policy", spider, projectID, policy, nil)
+	if err := models.DB.Delete(&policy).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "deleted",
+	})
+}
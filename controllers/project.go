@@ -1,8 +1,10 @@
 package controllers
 
 import (
+	"github.com/distribution/reference"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
 	"net/http"
 	"scrapyd/api/errs"
 	"scrapyd/api/types"
@@ -14,14 +16,29 @@ func ProjectCreate(c *gin.Context) {
 	var request types.ProjectRequest
 	var project models.Project
 
-	if err := c.MustBindWith(&request, binding.JSON); err != nil {
+	if err := c.ShouldBindWith(&request, binding.JSON); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	if !principal(c).CanCreateProject(request.ID) {
+		c.Error(errs.ErrForbidden)
 		return
 	}
 	project.ID = request.ID
-	if rows := models.DB.Create(&project).RowsAffected; rows == 0 {
-		c.Error(errs.ErrProjectConflict)
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if rows := tx.Create(&project).RowsAffected; rows == 0 {
+			return errs.ErrProjectConflict
+		}
+		// the creating user owns the project
+		if userID := principal(c).UserID; userID != "" {
+			return tx.Create(&models.ProjectRole{ProjectID: project.ID, SubjectType: "user", SubjectID: userID, Role: "owner"}).Error
+		}
+		return nil
+	}); err != nil {
+		c.Error(err)
 		return
 	}
+	audit(c, "project", project.ID, project.ID, nil, &project)
 
 	c.JSON(http.StatusCreated, types.Response{
 		Status:  "success",
@@ -32,7 +49,7 @@ func ProjectCreate(c *gin.Context) {
 func ProjectList(c *gin.Context) {
 	var projects []models.Project
 
-	models.DB.Preload("Versions").Find(&projects)
+	visible(c, models.DB, "id", "read").Preload("Versions").Find(&projects)
 	c.JSON(http.StatusOK, types.Response{
 		Status: "success",
 		Data:   projects,
@@ -40,24 +57,143 @@ func ProjectList(c *gin.Context) {
 }
 
 func ProjectDelete(c *gin.Context) {
+	var request types.ProjectDeleteRequest
+
+	if err := c.ShouldBindWith(&request, binding.Query); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	id := c.Params.ByName("id")
+	if err := authorize(c, "admin", id); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := projectDelete(c, id, request.Force); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "deleted",
+	})
+}
+
+// projectDelete removes the project along with its versions and jobs, active jobs stop it without force.
+func projectDelete(c *gin.Context, id string, force bool) error {
 	var project models.Project
 
+	if err := models.DB.Preload("Versions").Preload("Inputs").First(&project, "id = ?", id).Error; err != nil {
+		return errs.ErrProjectNotFound
+	}
+	audit(c, "project", id, id, project, nil)
+
+	// cleanup related stuff like version
+	if err := services.ProjectCleanup(&project, force); err != nil {
+		return err
+	}
+
+	return models.DB.Delete(&project, "id = ?", id).Error
+}
+
+func ProjectRetentionPut(c *gin.Context) {
+	var request types.RetentionRequest
+	var project models.Project
+
+	if err := c.ShouldBindWith(&request, binding.JSON); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
 	id := c.Params.ByName("id")
-	if err := models.DB.Preload("Versions").First(&project, "id = ?", id).Error; err != nil {
+	if err := authorize(c, "admin", id); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&project, "id = ?", id).Error; err != nil {
 		c.Error(errs.ErrProjectNotFound)
 		return
 	}
 
-	// cleanup related stuff like version
-	err := services.ProjectCleanup(&project)
-	if err != nil {
+	before := project
+	project.RetainLast = request.RetainLast
+	project.RetainUnusedDays = request.RetainUnusedDays
+	audit(c, "project", id, id, before, &project)
+	if err := models.DB.Save(&project).Error; err != nil {
 		c.Error(err)
 		return
 	}
 
-	models.DB.Delete(&project, "id = ?", id)
 	c.JSON(http.StatusOK, types.Response{
 		Status:  "success",
-		Message: "deleted",
+		Message: "updated",
+	})
+}
+
+// ProjectBuildPut sets the base image source and egg builds of the project start from.
+func ProjectBuildPut(c *gin.Context) {
+	var request types.BuildRequest
+	var project models.Project
+
+	if err := c.ShouldBindWith(&request, binding.JSON); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	id := c.Params.ByName("id")
+	if err := authorize(c, "admin", id); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&project, "id = ?", id).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	if request.BaseImage != "" {
+		if _, err := reference.ParseNormalizedNamed(request.BaseImage); err != nil {
+			c.Error(errs.ErrVersionImageInvalid)
+			return
+		}
+	}
+
+	before := project
+	project.BaseImage = request.BaseImage
+	audit(c, "project", id, id, before, &project)
+	if err := models.DB.Model(&project).Update("base_image", request.BaseImage).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "updated",
+	})
+}
+
+// ProjectRetentionReport is the dry run of the retention policy.
+func ProjectRetentionReport(c *gin.Context) {
+	var project models.Project
+
+	id := c.Params.ByName("id")
+	if err := authorize(c, "read", id); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&project, "id = ?", id).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	report, err := services.RetentionPlan(&project)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status: "success",
+		Data:   report,
 	})
 }
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"net/http"
+	"scrapyd/api/errs"
+	"scrapyd/models"
+	"scrapyd/services"
+	"scrapyd/testutil"
+	"testing"
+)
+
+func TestProjectCreatePermission(t *testing.T) {
+	tests := []struct {
+		name   string
+		caller *services.Principal
+		status int
+		owner  string
+	}{
+		{name: "admin token", caller: admin, status: http.StatusCreated},
+		{name: "user without roles", caller: &services.Principal{Name: "ann", UserID: "ann"}, status: http.StatusCreated, owner: "ann"},
+		{name: "admin token of a user", caller: &services.Principal{Name: "ann", UserID: "ann", Scopes: []string{"admin"}}, status: http.StatusCreated, owner: "ann"},
+		{name: "deploy token", caller: &services.Principal{Name: "ci", Scopes: []string{"deploy"}}, status: http.StatusForbidden},
+		{name: "token of another project", caller: &services.Principal{Name: "ci", Scopes: []string{"admin"}, ProjectIDs: []string{"shop"}}, status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.Setup(t)
+			router := newRouter(tt.caller, http.MethodPost, "/projects", ProjectCreate)
+
+			w, _ := serveJSON(t, router, http.MethodPost, "/projects", map[string]any{"id": "blog"})
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			want := int64(0)
+			if tt.status == http.StatusCreated {
+				want = 1
+			}
+			if n := testutil.Count[models.Project](t, "id = ?", "blog"); n != want {
+				t.Fatalf("%d projects, want %d", n, want)
+			}
+			if tt.owner != "" {
+				if n := testutil.Count[models.ProjectRole](t, "project_id = ? AND subject_type = ? AND subject_id = ? AND role = ?", "blog", "user", tt.owner, "owner"); n != 1 {
+					t.Fatal("the user doesn't own the project")
+				}
+			}
+		})
+	}
+}
+
+func TestProjectCreateRollsBackWithoutOwner(t *testing.T) {
+	testutil.Setup(t)
+	models.DB.Callback().Create().Before("gorm:create").Register("test:fail_roles", func(db *gorm.DB) {
+		if db.Statement.Table == "project_roles" {
+			db.AddError(errors.New("disk I/O error"))
+		}
+	})
+	router := newRouter(&services.Principal{Name: "ann", UserID: "ann"}, http.MethodPost, "/projects", ProjectCreate)
+
+	w, _ := serveJSON(t, router, http.MethodPost, "/projects", map[string]any{"id": "blog"})
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if n := testutil.Count[models.Project](t, "id = ?", "blog"); n != 0 {
+		t.Fatal("the project was created without its owner")
+	}
+}
+
+func TestProjectCreateConflict(t *testing.T) {
+	testutil.Setup(t)
+	testutil.Create(t, &models.Project{ID: "blog"})
+	router := newRouter(admin, http.MethodPost, "/projects", ProjectCreate)
+
+	if w, response := serveJSON(t, router, http.MethodPost, "/projects", map[string]any{"id": "blog"}); w.Code != http.StatusConflict || response.Code != "PROJECT_CONFLICT" {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestProjectDeleteActiveJobs(t *testing.T) {
+	for _, status := range []string{"pending", "running", "queued"} {
+		t.Run(status, func(t *testing.T) {
+			setupJobs(t)
+			testutil.Create(t, &models.Job{ID: "j1", ProjectID: "shop", VersionID: "v1", Spider: "items", Status: status})
+
+			router := newRouter(admin, http.MethodDelete, "/projects/:id", ProjectDelete)
+			w, response := serve(t, router, http.MethodDelete, "/projects/shop", "", nil)
+			if w.Code != http.StatusConflict || response.Code != "PROJECT_IN_USE" {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+
+			// scrapyd clients can't force it either
+			router = newRouter(admin, http.MethodPost, "/delproject.json", ScrapydDelProject)
+			contentType, body := multipartBody(t, map[string]string{"project": "shop"}, nil)
+			w, response = serve(t, router, http.MethodPost, "/delproject.json", contentType, body)
+			if response.Status != "error" || response.Message != errs.ErrProjectInUse.Error() {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+
+			if testutil.Count[models.Project](t, "id = ?", "shop") != 1 || testutil.Count[models.Job](t, "id = ? AND status = ?", "j1", status) != 1 {
+				t.Fatal("the project or its job went")
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"scrapyd/api/errs"
+	"scrapyd/api/types"
+	"scrapyd/models"
+	"scrapyd/services"
+)
+
+// RegistryList only exposes usernames, passwords are write-only.
+func RegistryList(c *gin.Context) {
+	var credentials []models.RegistryCredential
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "read", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	models.DB.Find(&credentials, "project_id = ?", projectID)
+	c.JSON(http.StatusOK, types.Response{
+		Status: "success",
+		Data:   credentials,
+	})
+}
+
+func RegistryPut(c *gin.Context) {
+	var request types.RegistryRequest
+
+	if err := c.ShouldBindWith(&request, binding.JSON); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "admin", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	sealed, err := services.SecretSeal(request.Password)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	credential := models.RegistryCredential{
+		ProjectID: projectID,
+		Registry:  c.Params.ByName("registry"),
+		Username:  request.Username,
+		Password:  sealed,
+	}
+	audit(c, "registry", credential.Registry, projectID, auditBefore[models.RegistryCredential]("project_id = ? AND registry = ?", projectID, credential.Registry), &credential)
+	if err := models.DB.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"username", "password", "updated_at"}),
+	}).Create(&credential).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "updated",
+	})
+}
+
+func RegistryDelete(c *gin.Context) {
+	var credential models.RegistryCredential
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "admin", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	registry := c.Params.ByName("registry")
+	if err := models.DB.First(&credential, "project_id = ? AND registry = ?", projectID, registry).Error; err != nil {
+		c.Error(errs.ErrRegistryNotFound)
+		return
+	}
+
+	audit(c, "registry", registry, projectID, credential, nil)
+	if err := models.DB.Delete(&credential).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "deleted",
+	})
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"scrapyd/api/errs"
+	"scrapyd/api/types"
+	"scrapyd/models"
+)
+
+func RoleList(c *gin.Context) {
+	var roles []models.ProjectRole
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "read", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	models.DB.Find(&roles, "project_id = ?", projectID)
+	c.JSON(http.StatusOK, types.Response{
+		Status: "success",
+		Data:   roles,
+	})
+}
+
+// RolePut grants the user or team a role on the project, owners manage the roles of their project.
+func RolePut(c *gin.Context) {
+	var request types.RoleRequest
+
+	if err := c.ShouldBindWith(&request, binding.JSON); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "admin", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	role := models.ProjectRole{
+		ProjectID:   projectID,
+		SubjectType: c.Params.ByName("subject_type"),
+		SubjectID:   c.Params.ByName("subject_id"),
+		Role:        request.Role,
+	}
+	switch role.SubjectType {
+	case "user":
+		if err := models.DB.First(&models.User{}, "id = ?", role.SubjectID).Error; err != nil {
+			c.Error(errs.ErrRoleSubject)
+			return
+		}
+	case "team":
+		if err := models.DB.First(&models.Team{}, "name = ?", role.SubjectID).Error; err != nil {
+			c.Error(errs.ErrRoleSubject)
+			return
+		}
+	default:
+		c.Error(errs.ErrRoleSubject)
+		return
+	}
+
+	audit(c, "role", role.SubjectType+":"+role.SubjectID, projectID, auditBefore[models.ProjectRole]("project_id = ? AND subject_type = ? AND subject_id = ?", projectID, role.SubjectType, role.SubjectID), &role)
+	if err := models.DB.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"role", "updated_at"}),
+	}).Create(&role).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "updated",
+	})
+}
+
+func RoleDelete(c *gin.Context) {
+	var role models.ProjectRole
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "admin", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	subjectType := c.Params.ByName("subject_type")
+	subjectID := c.Params.ByName("subject_id")
+	if err := models.DB.First(&role, "project_id = ? AND subject_type = ? AND subject_id = ?", projectID, subjectType, subjectID).Error; err != nil {
+		c.Error(errs.ErrRoleNotFound)
+		return
+	}
+
+	audit(c, "role", subjectType+":"+subjectID, projectID, role, nil)
+	if err := models.DB.Delete(&role).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "deleted",
+	})
+}
@@ -0,0 +1,477 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+	"net/http"
+	"os"
+	"scrapyd/api/errs"
+	"scrapyd/api/types"
+	"scrapyd/config"
+	"scrapyd/models"
+	"scrapyd/services"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The classic scrapyd JSON API, served next to the REST endpoints so that scrapyd-client,
+// ScrapydWeb and friends keep working. Errors keep the {"status": "error", "message": ...} shape.
+
+// scrapydTimeFormat is how the original formats job times
+const scrapydTimeFormat = "2006-01-02 15:04:05.000000"
+
+// addVersionWaitMax caps SCRAPYD_ADDVERSION_WAIT below common proxy and client timeouts
+const addVersionWaitMax = 50 * time.Second
+
+// scheduleReserved are the schedule.json parameters that aren't spider arguments
+var scheduleReserved = []string{"project", "spider", "jobid", "_version", "setting", "priority"}
+
+// scrapydPaths are the routes of the classic API
+var scrapydPaths = []string{
+	"/daemonstatus.json", "/listprojects.json", "/listversions.json", "/listspiders.json", "/listjobs.json",
+	"/addversion.json", "/schedule.json", "/cancel.json", "/delversion.json", "/delproject.json",
+}
+
+// IsScrapyd tells whether the request is served by the classic scrapyd API.
+func IsScrapyd(c *gin.Context) bool {
+	return slices.Contains(scrapydPaths, c.FullPath())
+}
+
+// ScrapydError answers the error response the way scrapyd does, with 200 and the message only.
+// Its clients tell failures apart by the status field, not by the HTTP status.
+func ScrapydError(c *gin.Context, response types.Response) {
+	message := response.Message
+	if len(response.Details) > 0 {
+		details := make([]string, 0, len(response.Details))
+		for _, detail := range response.Details {
+			details = append(details, detail.Message)
+		}
+		message += ": " + strings.Join(details, "; ")
+	}
+	c.AbortWithStatusJSON(http.StatusOK, gin.H{
+		"node_name": config.NodeName,
+		"status":    "error",
+		"message":   message,
+	})
+}
+
+func scrapydOK(c *gin.Context, data gin.H) {
+	data["node_name"] = config.NodeName
+	data["status"] = "ok"
+	c.JSON(http.StatusOK, data)
+}
+
+// latestVersion is the version scrapyd falls back to when none is given
+func latestVersion(projectID string) (*models.Version, error) {
+	var version models.Version
+	if err := models.DB.Order("created_at DESC").First(&version, "project_id = ? AND status = ?", projectID, "ready").Error; err != nil {
+		return nil, errs.ErrVersionNotFound
+	}
+	return &version, nil
+}
+
+func ScrapydDaemonStatus(c *gin.Context) {
+	var pending, running, finished int64
+
+	if err := authorize(c, "read", ""); err != nil {
+		c.Error(err)
+		return
+	}
+
+	models.DB.Model(&models.Job{}).Where("status IN ?", []string{"pending", "queued"}).Count(&pending)
+	models.DB.Model(&models.Job{}).Where("status = ?", "running").Count(&running)
+	models.DB.Model(&models.Job{}).Where("status IN ?", []string{"finished", "cancelled", "failed"}).Count(&finished)
+
+	scrapydOK(c, gin.H{
+		"pending":  pending,
+		"running":  running,
+		"finished": finished,
+	})
+}
+
+func ScrapydListProjects(c *gin.Context) {
+	var projects []string
+
+	visible(c, models.DB.Model(&models.Project{}), "id", "read").Order("id").Pluck("id", &projects)
+	scrapydOK(c, gin.H{"projects": projects})
+}
+
+func ScrapydListVersions(c *gin.Context) {
+	var request types.ScrapydProjectRequest
+	var versions []string
+
+	if err := c.ShouldBindWith(&request, binding.Form); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	if err := authorize(c, "read", request.Project); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", request.Project).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	// oldest first, the last one is what schedule.json runs by default
+	models.DB.Model(&models.Version{}).Where("project_id = ?", request.Project).Order("created_at").Pluck("id", &versions)
+	scrapydOK(c, gin.H{"versions": versions})
+}
+
+func ScrapydListSpiders(c *gin.Context) {
+	var request types.ScrapydSpidersRequest
+
+	if err := c.ShouldBindWith(&request, binding.Form); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	if err := authorize(c, "read", request.Project); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", request.Project).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	var version *models.Version
+	var err error
+	if request.Version == "" {
+		version, err = latestVersion(request.Project)
+	} else {
+		version = &models.Version{}
+		if models.DB.First(version, "id = ? AND project_id = ?", request.Version, request.Project).Error != nil {
+			version, err = services.AliasResolve(request.Project, request.Version)
+		}
+	}
+	if err != nil {
+		c.Error(errs.ErrVersionNotFound)
+		return
+	}
+
+	spiders := version.Spiders
+	if spiders == nil {
+		spiders = []string{}
+	}
+	scrapydOK(c, gin.H{"spiders": spiders})
+}
+
+func ScrapydListJobs(c *gin.Context) {
+	var request types.ScrapydJobsRequest
+	var jobs []models.Job
+
+	if err := c.ShouldBindWith(&request, binding.Form); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	if err := authorize(c, "read", request.Project); err != nil {
+		c.Error(err)
+		return
+	}
+
+	query := visible(c, models.DB, "project_id", "read").Order("created_at")
+	if request.Project != "" {
+		query = query.Where("project_id = ?", request.Project)
+	}
+	query.Find(&jobs)
+
+	pending, running, finished := []gin.H{}, []gin.H{}, []gin.H{}
+	for _, job := range jobs {
+		entry := gin.H{
+			"id":      job.ID,
+			"project": job.ProjectID,
+			"spider":  job.Spider,
+			"version": job.VersionID,
+		}
+		switch job.Status {
+		case "pending", "queued":
+			pending = append(pending, entry)
+		case "running":
+			entry["start_time"] = job.CreatedAt.Format(scrapydTimeFormat)
+			entry["log_url"] = "/jobs/" + job.ID + "/logs"
+			running = append(running, entry)
+		case "finished", "cancelled", "failed":
+			entry["start_time"] = job.CreatedAt.Format(scrapydTimeFormat)
+			entry["end_time"] = job.UpdatedAt.Format(scrapydTimeFormat)
+			entry["log_url"] = "/jobs/" + job.ID + "/logs"
+			finished = append(finished, entry)
+		}
+	}
+
+	scrapydOK(c, gin.H{
+		"pending":  pending,
+		"running":  running,
+		"finished": finished,
+	})
+}
+
+// ScrapydAddVersion wraps the egg uploaded by scrapyd-deploy into an image. Like the original it
+// answers with the spider count, so it waits for the build and inspection, up to SCRAPYD_ADDVERSION_WAIT.
+func ScrapydAddVersion(c *gin.Context) {
+	var request types.ScrapydAddVersionRequest
+	var version models.Version
+
+	if err := c.ShouldBindWith(&request, binding.FormMultipart); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	// scrapyd creates projects on their first deploy, whoever may create the project may deploy it
+	newProject := models.DB.First(&models.Project{}, "id = ?", request.Project).Error != nil
+	if newProject && !principal(c).CanCreateProject(request.Project) {
+		c.Error(errs.ErrForbidden)
+		return
+	}
+	if !newProject {
+		if err := authorize(c, "deploy", request.Project); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	if err := models.DB.Unscoped().First(&version, "id = ?", request.Version).Error; err == nil {
+		c.Error(errs.ErrVersionConflict)
+		return
+	}
+	if err := versionAliasCheck(request.Project, request.Version); err != nil {
+		c.Error(err)
+		return
+	}
+
+	eggFile, err := c.FormFile("egg")
+	if err != nil {
+		c.Error(errs.ErrVersionEggInvalid)
+		return
+	}
+	file, err := eggFile.Open()
+	if err != nil {
+		c.Error(errs.ErrVersionEggInvalid)
+		return
+	}
+	defer file.Close()
+
+	version.ID = request.Version
+	version.ProjectID = request.Project
+	signature, err := formSignature(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// the row holds on to the ID while the egg is stored, a new project comes to be along with it
+	// and its creator owns it like with ProjectCreate
+	project := models.Project{ID: request.Project}
+	version.Source = "egg"
+	version.Status = "uploading"
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if newProject {
+			if rows := tx.Create(&project).RowsAffected; rows == 0 {
+				return errs.ErrProjectConflict
+			}
+			if userID := principal(c).UserID; userID != "" {
+				if err := tx.Create(&models.ProjectRole{ProjectID: project.ID, SubjectType: "user", SubjectID: userID, Role: "owner"}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if rows := tx.Create(&version).RowsAffected; rows == 0 {
+			return errs.ErrVersionConflict
+		}
+		return nil
+	}); err != nil {
+		c.Error(err)
+		return
+	}
+
+	// rejected eggs leave neither the version nor the project they'd have created
+	reject := func(err error) {
+		os.Remove(services.BuildEggPath(version.ID))
+		models.DB.Unscoped().Delete(&version)
+		if newProject {
+			models.DB.Delete(&project)
+		}
+		c.Error(err)
+	}
+	digest, err := services.BuildEggStore(version.ID, file)
+	if err == nil {
+		err = services.VersionSignatureVerify(&version, services.BuildEggPath(version.ID), digest, signature)
+	}
+	if err != nil {
+		reject(err)
+		return
+	}
+
+	if newProject {
+		audit(c, "project", project.ID, project.ID, nil, &project)
+	}
+	audit(c, "version", version.ID, version.ProjectID, nil, &version)
+	version.Image = services.BuildImageTag(&version)
+	version.Status = "building"
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := versionSave(tx, &version); err != nil {
+			return err
+		}
+		return services.OutboxAdd(tx, "build:version", version.ID)
+	}); err != nil {
+		reject(err)
+		return
+	}
+
+	// proxies and clients give up on requests long before builds are done
+	timeout := time.After(min(config.AddVersionWait, addVersionWaitMax))
+	for version.Status != "ready" && version.Status != "failed" {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-timeout:
+			// the build goes on, the version shows up in listversions.json once ready
+			c.Error(errs.ErrVersionBusy)
+			return
+		case <-time.After(time.Second):
+		}
+		if err := models.DB.First(&version, "id = ?", version.ID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				err = errs.ErrVersionNotFound
+			}
+			c.Error(err)
+			return
+		}
+	}
+	if version.Status == "failed" {
+		c.Error(errs.ErrVersionFailed)
+		return
+	}
+
+	scrapydOK(c, gin.H{
+		"project": version.ProjectID,
+		"version": version.ID,
+		"spiders": len(version.Spiders),
+	})
+}
+
+func ScrapydSchedule(c *gin.Context) {
+	var request types.ScrapydScheduleRequest
+
+	if err := c.ShouldBindWith(&request, binding.Form); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	if err := authorize(c, "schedule", request.Project); err != nil {
+		c.Error(err)
+		return
+	}
+
+	if request.Version == "" {
+		version, err := latestVersion(request.Project)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		request.Version = version.ID
+	}
+
+	// every other parameter is a spider argument
+	args := make(map[string]string)
+	for key, values := range c.Request.Form {
+		if !slices.Contains(scheduleReserved, key) && len(values) > 0 {
+			args[key] = values[0]
+		}
+	}
+
+	job, err := jobCreate(c, &types.JobRequest{
+		ID:        request.JobID,
+		ProjectID: request.Project,
+		VersionID: request.Version,
+		Spider:    request.Spider,
+		Setting:   strings.Join(request.Setting, "\n"),
+		Args:      args,
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	audit(c, "job", job.ID, job.ProjectID, nil, job)
+
+	scrapydOK(c, gin.H{"jobid": job.ID})
+}
+
+func ScrapydCancel(c *gin.Context) {
+	var request types.ScrapydCancelRequest
+	var job models.Job
+
+	if err := c.ShouldBindWith(&request, binding.Form); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	if err := authorize(c, "schedule", request.Project); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&job, "id = ? AND project_id = ?", request.Job, request.Project).Error; err != nil {
+		c.Error(errs.ErrJobNotFound)
+		return
+	}
+	audit(c, "job", job.ID, job.ProjectID, job, nil)
+
+	prevState := job.Status
+	if prevState == "queued" {
+		prevState = "pending"
+	}
+	if job.Status == "pending" || job.Status == "queued" || job.Status == "running" {
+		if err := jobAction(&job, "cancel"); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	scrapydOK(c, gin.H{"prevstate": prevState})
+}
+
+func ScrapydDelVersion(c *gin.Context) {
+	var request types.ScrapydVersionRequest
+	var version models.Version
+
+	if err := c.ShouldBindWith(&request, binding.Form); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	if err := authorize(c, "deploy", request.Project); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&version, "id = ? AND project_id = ?", request.Version, request.Project).Error; err != nil {
+		c.Error(errs.ErrVersionNotFound)
+		return
+	}
+	audit(c, "version", version.ID, version.ProjectID, version, nil)
+
+	if err := services.VersionRemove(&version, false); err != nil {
+		c.Error(err)
+		return
+	}
+
+	scrapydOK(c, gin.H{})
+}
+
+func ScrapydDelProject(c *gin.Context) {
+	var request types.ScrapydProjectRequest
+
+	if err := c.ShouldBindWith(&request, binding.Form); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	if err := authorize(c, "admin", request.Project); err != nil {
+		c.Error(err)
+		return
+	}
+
+	// like delversion.json, scrapyd clients can't force it
+	if err := projectDelete(c, request.Project, false); err != nil {
+		c.Error(err)
+		return
+	}
+
+	scrapydOK(c, gin.H{})
+}
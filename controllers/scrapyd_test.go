@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"scrapyd/api/errs"
+	"scrapyd/api/types"
+	"scrapyd/config"
+	"scrapyd/models"
+	"scrapyd/services"
+	"scrapyd/testutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScrapydErrorsAnswerOK(t *testing.T) {
+	tests := []struct {
+		name    string
+		caller  *services.Principal
+		path    string
+		handler func(*gin.Context)
+		form    url.Values
+		message string
+	}{
+		{
+			name:    "validation",
+			caller:  admin,
+			path:    "/schedule.json",
+			handler: ScrapydSchedule,
+			form:    url.Values{"project": {"shop"}},
+			message: "validation",
+		},
+		{
+			name:    "not found",
+			caller:  admin,
+			path:    "/cancel.json",
+			handler: ScrapydCancel,
+			form:    url.Values{"project": {"shop"}, "job": {"missing"}},
+			message: "job",
+		},
+		{
+			name:    "forbidden",
+			caller:  &services.Principal{Name: "reader", Scopes: []string{"read"}},
+			path:    "/delversion.json",
+			handler: ScrapydDelVersion,
+			form:    url.Values{"project": {"shop"}, "version": {"v1"}},
+			message: "permission",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupJobs(t)
+			router := newRouter(tt.caller, http.MethodPost, tt.path, tt.handler)
+
+			w, response := serve(t, router, http.MethodPost, tt.path, "application/x-www-form-urlencoded", strings.NewReader(tt.form.Encode()))
+			if w.Code != http.StatusOK || response.Status != "error" || response.Message == "" {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			if !strings.Contains(strings.ToLower(response.Message), tt.message) {
+				t.Fatalf("message %q, want it to mention %q", response.Message, tt.message)
+			}
+		})
+	}
+}
+
+// addVersion uploads a valid egg for the version of the project shop.
+func addVersion(t *testing.T, version string) (*httptest.ResponseRecorder, types.Response) {
+	t.Helper()
+	egg := zipArchive(t, map[string]string{"EGG-INFO/entry_points.txt": "[scrapy]\nsettings = shop.settings\n"})
+	return addVersionAs(t, admin, "shop", version, egg)
+}
+
+func addVersionAs(t *testing.T, caller *services.Principal, project string, version string, egg string) (*httptest.ResponseRecorder, types.Response) {
+	t.Helper()
+	router := newRouter(caller, http.MethodPost, "/addversion.json", ScrapydAddVersion)
+	contentType, body := multipartBody(t,
+		map[string]string{"project": project, "version": version},
+		map[string][][2]string{"egg": {{project + ".egg", egg}}},
+	)
+	return serve(t, router, http.MethodPost, "/addversion.json", contentType, body)
+}
+
+func withAddVersionWait(t *testing.T, wait time.Duration) {
+	original := config.AddVersionWait
+	config.AddVersionWait = wait
+	t.Cleanup(func() { config.AddVersionWait = original })
+}
+
+func TestScrapydAddVersionRejectsPathIDs(t *testing.T) {
+	for _, id := range []string{"../../escape", "a/b", ".."} {
+		t.Run(id, func(t *testing.T) {
+			setupJobs(t)
+			w, response := addVersion(t, id)
+			if w.Code != http.StatusOK || response.Status != "error" {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			if _, err := os.Stat(config.DataDir); !os.IsNotExist(err) {
+				t.Fatal("the egg was stored")
+			}
+			if n := testutil.Count[models.Version](t, "id = ?", id); n != 0 {
+				t.Fatal("the version was created")
+			}
+		})
+	}
+}
+
+func TestScrapydAddVersionTimeout(t *testing.T) {
+	setupJobs(t)
+	withAddVersionWait(t, time.Millisecond)
+
+	w, response := addVersion(t, "v2")
+	if w.Code != http.StatusOK || response.Status != "error" || response.Message != errs.ErrVersionBusy.Error() {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	// the build goes on
+	if n := testutil.Count[models.Version](t, "id = ? AND status = ?", "v2", "building"); n != 1 {
+		t.Fatal("the version is not building")
+	}
+}
+
+func TestScrapydAddVersionDeletedWhileBuilding(t *testing.T) {
+	setupJobs(t)
+	withAddVersionWait(t, time.Minute)
+
+	// deleted as soon as it is created
+	go func() {
+		for {
+			if result := models.DB.Delete(&models.Version{ID: "v2"}); result.Error != nil || result.RowsAffected > 0 {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	w, response := addVersion(t, "v2")
+	if w.Code != http.StatusOK || response.Status != "error" || response.Message != errs.ErrVersionNotFound.Error() {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestScrapydAddVersionAliasNameTaken(t *testing.T) {
+	setupJobs(t)
+	testutil.Create(t, &models.Alias{ProjectID: "shop", Name: "live", VersionID: "v1"})
+
+	w, response := addVersion(t, "live")
+	if w.Code != http.StatusOK || response.Message != errs.ErrAliasNameTaken.Error() {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if _, err := os.Stat(config.DataDir); !os.IsNotExist(err) {
+		t.Fatal("the egg was stored")
+	}
+}
+
+func TestScrapydAddVersionInvalidEggCreatesNoProject(t *testing.T) {
+	setupJobs(t)
+
+	w, response := addVersionAs(t, admin, "blog", "b1", "not a zip")
+	if w.Code != http.StatusOK || response.Message != errs.ErrVersionEggInvalid.Error() {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if n := testutil.Count[models.Project](t, "id = ?", "blog"); n != 0 {
+		t.Fatal("the project was created")
+	}
+	if n := testutil.Count[models.AuditEntry](t, "target_type = ?", "project"); n != 0 {
+		t.Fatal("the project creation was audited")
+	}
+	// the row reserving the ID went along with the egg
+	var n int64
+	models.DB.Unscoped().Model(&models.Version{}).Where("id = ?", "b1").Count(&n)
+	if _, err := os.Stat(services.BuildEggPath("b1")); n != 0 || !os.IsNotExist(err) {
+		t.Fatalf("%d versions, egg stored: %v", n, err)
+	}
+}
+
+func TestScrapydAddVersionNewProject(t *testing.T) {
+	setupJobs(t)
+	withAddVersionWait(t, time.Millisecond)
+	testutil.Create(t, &models.User{ID: "u1", Name: "ann", PasswordHash: []byte("x")})
+	user := &services.Principal{Name: "ann", UserID: "u1", Roles: map[string]string{}}
+	egg := zipArchive(t, map[string]string{"EGG-INFO/entry_points.txt": "[scrapy]\nsettings = blog.settings\n"})
+
+	w, response := addVersionAs(t, user, "blog", "b1", egg)
+	if w.Code != http.StatusOK || response.Message != errs.ErrVersionBusy.Error() {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if n := testutil.Count[models.ProjectRole](t, "project_id = ? AND subject_id = ? AND role = ?", "blog", "u1", "owner"); n != 1 {
+		t.Fatal("the deployer doesn't own the project")
+	}
+	if n := testutil.Count[models.Outbox](t, "1 = 1"); n != 1 {
+		t.Fatalf("%d outbox entries", n)
+	}
+	for _, kind := range []string{"project", "version"} {
+		if n := testutil.Count[models.AuditEntry](t, "target_type = ? AND project_id = ?", kind, "blog"); n != 1 {
+			t.Fatalf("%d audit entries for the %s", n, kind)
+		}
+	}
+
+	// a token restricted to other projects can't create it
+	token := &services.Principal{Name: "ci", TokenID: "t1", Scopes: []string{"deploy"}, ProjectIDs: []string{"shop"}}
+	w, response = addVersionAs(t, token, "news", "n1", egg)
+	if response.Status != "error" || testutil.Count[models.Project](t, "id = ?", "news") != 0 {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"scrapyd/api/errs"
+	"scrapyd/api/types"
+	"scrapyd/models"
+	"scrapyd/services"
+)
+
+// SecretList only exposes secret names, values are write-only.
+func SecretList(c *gin.Context) {
+	var secrets []models.Secret
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "read", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	models.DB.Find(&secrets, "project_id = ?", projectID)
+	c.JSON(http.StatusOK, types.Response{
+		Status: "success",
+		Data:   secrets,
+	})
+}
+
+func SecretPut(c *gin.Context) {
+	var request types.SecretRequest
+
+	if err := c.ShouldBindWith(&request, binding.JSON); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "admin", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	name := c.Params.ByName("name")
+	if !services.EnvNameValid(name) {
+		c.Error(errs.ErrEnvInvalid)
+		return
+	}
+
+	sealed, err := services.SecretSeal(request.Value)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	secret := models.Secret{
+		ProjectID: projectID,
+		Name:      name,
+		Value:     sealed,
+	}
+	audit(c, "secret", name, projectID, auditBefore[models.Secret]("project_id = ? AND name = ?", projectID, name), &secret)
+	if err := models.DB.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&secret).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "updated",
+	})
+}
+
+func SecretDelete(c *gin.Context) {
+	var secret models.Secret
+
+	projectID := c.Params.ByName("id")
+	if err := authorize(c, "admin", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	name := c.Params.ByName("name")
+	if err := models.DB.First(&secret, "project_id = ? AND name = ?", projectID, name).Error; err != nil {
+		c.Error(errs.ErrSecretNotFound)
+		return
+	}
+
+	audit(c, "secret", name, projectID, secret, nil)
+	if err := models.DB.Delete(&secret).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "deleted",
+	})
+}
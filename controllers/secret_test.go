@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"scrapyd/models"
+	"scrapyd/testutil"
+	"strings"
+	"testing"
+)
+
+func TestSecretValuesNeverLeave(t *testing.T) {
+	setupJobs(t)
+	testutil.MasterKey(t, "test")
+	const value = "s3cr3t-proxy-password"
+
+	put := newRouter(admin, http.MethodPut, "/projects/:id/secrets/:name", SecretPut)
+	for _, v := range []string{value + "-old", value} {
+		if w, _ := serveJSON(t, put, http.MethodPut, "/projects/shop/secrets/PROXY_PASSWORD", map[string]any{"value": v}); w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+	}
+	var secret models.Secret
+	models.DB.First(&secret, "project_id = ? AND name = ?", "shop", "PROXY_PASSWORD")
+	if strings.Contains(string(secret.Value), value) {
+		t.Fatal("secret stored in the clear")
+	}
+
+	create := newRouter(admin, http.MethodPost, "/jobs", JobCreate)
+	if w, _ := serveJSON(t, create, http.MethodPost, "/jobs", map[string]any{
+		"project_id": "shop", "version_id": "v1", "spider": "items", "secrets": []string{"PROXY_PASSWORD"},
+	}); w.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	var entries []models.AuditEntry
+	models.DB.Find(&entries, "target_type = ?", "secret")
+	if len(entries) != 2 || entries[1].Before == nil || entries[1].After == nil {
+		t.Fatalf("audit entries %+v", entries)
+	}
+	audit, _ := json.Marshal(entries)
+
+	responses := map[string]string{"audit": string(audit)}
+	list := newRouter(admin, http.MethodGet, "/projects/:id/secrets", SecretList)
+	w, _ := serve(t, list, http.MethodGet, "/projects/shop/secrets", "", nil)
+	responses["SecretList"] = w.Body.String()
+	jobs := newRouter(admin, http.MethodGet, "/jobs", JobList)
+	w, _ = serve(t, jobs, http.MethodGet, "/jobs", "", nil)
+	responses["JobList"] = w.Body.String()
+
+	for name, body := range responses {
+		if strings.Contains(body, value) {
+			t.Errorf("%s exposes the secret: %s", name, body)
+		}
+	}
+	if !strings.Contains(responses["SecretList"], "PROXY_PASSWORD") || !strings.Contains(responses["JobList"], "PROXY_PASSWORD") {
+		t.Fatalf("secret names missing: %v", responses)
+	}
+}
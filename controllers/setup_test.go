@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"scrapyd/api/types"
+	"scrapyd/services"
+	"testing"
+)
+
+// admin may do anything
+var admin = &services.Principal{Name: "test", Scopes: []string{"admin"}}
+
+// newRouter serves the handlers as the caller, answering errors the way the daemon does.
+func newRouter(caller *services.Principal, method string, path string, handlers ...gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	SetupValidator()
+	router := gin.New()
+	router.Use(RequestID(), AuditLog(), ErrorResponse(), func(c *gin.Context) {
+		if caller != nil {
+			c.Set(principalKey, caller)
+		}
+	})
+	router.Handle(method, path, handlers...)
+	return router
+}
+
+// serve sends the request to the router and decodes the response envelope.
+func serve(t *testing.T, router *gin.Engine, method string, path string, contentType string, body io.Reader) (*httptest.ResponseRecorder, types.Response) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, body)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return decodeResponse(t, w)
+}
+
+// decodeResponse decodes the response envelope of JSON answers.
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder) (*httptest.ResponseRecorder, types.Response) {
+	t.Helper()
+	var response types.Response
+	if w.Header().Get("Content-Type") == "application/json; charset=utf-8" {
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decode %s: %v", w.Body.String(), err)
+		}
+	}
+	return w, response
+}
+
+func serveJSON(t *testing.T, router *gin.Engine, method string, path string, body any) (*httptest.ResponseRecorder, types.Response) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serve(t, router, method, path, "application/json", bytes.NewReader(data))
+}
+
+// multipartBody encodes the fields and files, files maps the field name to file name and content.
+func multipartBody(t *testing.T, fields map[string]string, files map[string][][2]string) (string, io.Reader) {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, list := range files {
+		for _, file := range list {
+			part, err := writer.CreateFormFile(name, file[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			part.Write([]byte(file[1]))
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return writer.FormDataContentType(), &buf
+}
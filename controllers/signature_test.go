@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"scrapyd/models"
+	"scrapyd/services"
+	"scrapyd/testutil"
+	"testing"
+	"time"
+)
+
+// trustKey makes the project shop trust a fresh key and returns it for signing.
+func trustKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.Create(t, &models.TrustedKey{
+		ProjectID: "shop",
+		Name:      "ci",
+		PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	})
+	return private
+}
+
+func sign(key ed25519.PrivateKey, content string) string {
+	digest := sha256.Sum256([]byte(content))
+	return string(ed25519.Sign(key, digest[:]))
+}
+
+func zipArchive(t *testing.T, files map[string]string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestVersionCreatePullUnsigned(t *testing.T) {
+	setupJobs(t)
+	trustKey(t)
+	router := newRouter(admin, http.MethodPost, "/versions", VersionCreate)
+
+	w, response := serveJSON(t, router, http.MethodPost, "/versions", map[string]any{"id": "v2", "project_id": "shop", "image": "registry.example.com/shop:v2"})
+	if w.Code != http.StatusUnprocessableEntity || response.Code != "VERSION_UNSIGNED" {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if n := testutil.Count[models.Version](t, "id = ?", "v2"); n != 0 {
+		t.Fatal("the version was created")
+	}
+	if n := testutil.Count[models.Outbox](t, "1 = 1"); n != 0 {
+		t.Fatal("the pull was queued")
+	}
+}
+
+func TestVersionCreateSourceSignature(t *testing.T) {
+	source := zipArchive(t, map[string]string{"scrapy.cfg": "[settings]\ndefault = shop.settings\n"})
+
+	tests := []struct {
+		name      string
+		signature func(key ed25519.PrivateKey) string
+		status    int
+		code      string
+	}{
+		{name: "unsigned", status: http.StatusUnprocessableEntity, code: "VERSION_UNSIGNED"},
+		{
+			name:      "untrusted key",
+			signature: func(ed25519.PrivateKey) string { _, key, _ := ed25519.GenerateKey(nil); return sign(key, source) },
+			status:    http.StatusUnprocessableEntity,
+			code:      "VERSION_SIGNATURE_INVALID",
+		},
+		{
+			name:      "trusted key",
+			signature: func(key ed25519.PrivateKey) string { return sign(key, source) },
+			status:    http.StatusAccepted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupJobs(t)
+			key := trustKey(t)
+			router := newRouter(admin, http.MethodPost, "/versions", VersionCreate)
+
+			files := map[string][][2]string{"source_zip": {{"shop.zip", source}}}
+			if tt.signature != nil {
+				files["signature"] = [][2]string{{"shop.zip.sig", tt.signature(key)}}
+			}
+			contentType, body := multipartBody(t, map[string]string{"id": "v2", "project_id": "shop"}, files)
+			w, response := serve(t, router, http.MethodPost, "/versions", contentType, body)
+			if w.Code != tt.status || response.Code != tt.code {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+
+			_, err := os.Stat(services.BuildSourcePath("v2"))
+			if tt.status != http.StatusAccepted {
+				if !os.IsNotExist(err) {
+					t.Fatal("the rejected source was kept")
+				}
+				if n := testutil.Count[models.Version](t, "id = ?", "v2"); n != 0 {
+					t.Fatal("the version was created")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var version models.Version
+			models.DB.First(&version, "id = ?", "v2")
+			if version.Status != "building" || version.SignedBy != "ci" {
+				t.Fatalf("version %s signed by %q", version.Status, version.SignedBy)
+			}
+		})
+	}
+}
+
+func TestVersionCreateImportUnsigned(t *testing.T) {
+	setupJobs(t)
+	trustKey(t)
+	router := newRouter(admin, http.MethodPost, "/versions", VersionCreate)
+
+	contentType, body := multipartBody(t,
+		map[string]string{"id": "v2", "project_id": "shop", "import": "true"},
+		map[string][][2]string{"image_tar": {{"shop.tar", "exported version"}}},
+	)
+	w, response := serve(t, router, http.MethodPost, "/versions", contentType, body)
+	if w.Code != http.StatusUnprocessableEntity || response.Code != "VERSION_UNSIGNED" {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if n := testutil.Count[models.Version](t, "id = ?", "v2"); n != 0 {
+		t.Fatal("the version was created")
+	}
+	if _, err := os.Stat(services.VersionUploadPath("v2")); !os.IsNotExist(err) {
+		t.Fatal("the rejected image tar was kept")
+	}
+}
+
+func TestScrapydAddVersionSignature(t *testing.T) {
+	egg := zipArchive(t, map[string]string{"EGG-INFO/entry_points.txt": "[scrapy]\nsettings = shop.settings\n"})
+	withAddVersionWait(t, time.Millisecond)
+
+	for _, signed := range []bool{false, true} {
+		setupJobs(t)
+		key := trustKey(t)
+		router := newRouter(admin, http.MethodPost, "/addversion.json", ScrapydAddVersion)
+
+		files := map[string][][2]string{"egg": {{"shop.egg", egg}}}
+		if signed {
+			files["signature"] = [][2]string{{"shop.egg.sig", sign(key, egg)}}
+		}
+		contentType, body := multipartBody(t, map[string]string{"project": "shop", "version": "v2"}, files)
+		w, _ := serve(t, router, http.MethodPost, "/addversion.json", contentType, body)
+
+		var version models.Version
+		err := models.DB.First(&version, "id = ?", "v2").Error
+		if !signed {
+			if err == nil {
+				t.Fatalf("unsigned egg was accepted: %s", w.Body)
+			}
+			if _, err := os.Stat(services.BuildEggPath("v2")); !os.IsNotExist(err) {
+				t.Fatal("the rejected egg was kept")
+			}
+			continue
+		}
+		if err != nil || version.SignedBy != "ci" {
+			t.Fatalf("signed egg: %v %q: %s", err, version.SignedBy, w.Body)
+		}
+	}
+}
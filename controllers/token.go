@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"net/http"
+	"scrapyd/api/errs"
+	"scrapyd/api/types"
+	"scrapyd/models"
+	"scrapyd/services"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TokenCreate answers with the token secret, it can't be retrieved later. Users issue tokens
+// for themselves, never with more than the token they are using.
+func TokenCreate(c *gin.Context) {
+	var request types.TokenRequest
+
+	if err := c.ShouldBindWith(&request, binding.JSON); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	p := principal(c)
+	if p.IsAdmin() {
+		if request.UserID != "" {
+			if err := models.DB.First(&models.User{}, "id = ?", request.UserID).Error; err != nil {
+				c.Error(errs.ErrUserNotFound)
+				return
+			}
+		}
+	} else {
+		if p.UserID == "" || (request.UserID != "" && request.UserID != p.UserID) {
+			c.Error(errs.ErrForbidden)
+			return
+		}
+		request.UserID = p.UserID
+		for _, scope := range request.Scopes {
+			if !p.HasScope(scope) {
+				c.Error(errs.ErrForbidden)
+				return
+			}
+		}
+		if len(p.ProjectIDs) > 0 {
+			if len(request.ProjectIDs) == 0 {
+				request.ProjectIDs = p.ProjectIDs
+			}
+			for _, projectID := range request.ProjectIDs {
+				if !slices.Contains(p.ProjectIDs, projectID) {
+					c.Error(errs.ErrForbidden)
+					return
+				}
+			}
+		}
+	}
+
+	secret, hash, err := services.TokenGenerate()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	reqID, _ := uuid.NewUUID()
+	token := models.Token{
+		ID:         strings.ReplaceAll(reqID.String(), "-", ""),
+		Name:       request.Name,
+		UserID:     request.UserID,
+		Hash:       hash,
+		Scopes:     request.Scopes,
+		ProjectIDs: request.ProjectIDs,
+	}
+	audit(c, "token", token.ID, "", nil, &token)
+	if err := models.DB.Create(&token).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, types.Response{
+		Status:  "success",
+		Message: "created",
+		Data: types.TokenCreated{
+			Token:  secret,
+			Detail: token,
+		},
+	})
+}
+
+// TokenList shows admins every token, users only their own.
+func TokenList(c *gin.Context) {
+	var tokens []models.Token
+
+	query, err := ownTokens(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	query.Order("created_at").Find(&tokens)
+	c.JSON(http.StatusOK, types.Response{
+		Status: "success",
+		Data:   tokens,
+	})
+}
+
+// TokenRevoke keeps the token around, revoked, to know who held it.
+func TokenRevoke(c *gin.Context) {
+	var token models.Token
+
+	query, err := ownTokens(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	id := c.Params.ByName("id")
+	if err := query.First(&token, "id = ? AND revoked_at IS NULL", id).Error; err != nil {
+		c.Error(errs.ErrTokenNotFound)
+		return
+	}
+
+	audit(c, "token", token.ID, "", token, &token)
+	if err := models.DB.Model(&token).Update("revoked_at", time.Now()).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "revoked",
+	})
+}
+
+func ownTokens(c *gin.Context) (*gorm.DB, error) {
+	p := principal(c)
+	if p.IsAdmin() {
+		return models.DB, nil
+	}
+	if p.UserID == "" {
+		return nil, errs.ErrForbidden
+	}
+	return models.DB.Where("user_id = ?", p.UserID), nil
+}
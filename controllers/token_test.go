@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"net/http"
+	"scrapyd/models"
+	"scrapyd/services"
+	"scrapyd/testutil"
+	"slices"
+	"testing"
+)
+
+func TestTokenCreate(t *testing.T) {
+	user := &services.Principal{Name: "ann", UserID: "u1", Roles: map[string]string{"shop": "deployer"}}
+	userToken := &services.Principal{Name: "ann", TokenID: "t1", Scopes: []string{"schedule"}, ProjectIDs: []string{"shop"}, UserID: "u1", Roles: map[string]string{"shop": "deployer", "blog": "deployer"}}
+	tests := []struct {
+		name         string
+		caller       *services.Principal
+		request      map[string]any
+		status       int
+		wantUser     string
+		wantProjects []string
+	}{
+		{name: "admin", caller: admin, request: map[string]any{"name": "ci", "scopes": []string{"admin"}}, status: http.StatusCreated},
+		{name: "admin for user", caller: admin, request: map[string]any{"name": "ci", "scopes": []string{"read"}, "user_id": "u1"}, status: http.StatusCreated, wantUser: "u1"},
+		{name: "admin for unknown user", caller: admin, request: map[string]any{"name": "ci", "scopes": []string{"read"}, "user_id": "u9"}, status: http.StatusNotFound},
+		{name: "user within role", caller: user, request: map[string]any{"name": "ci", "scopes": []string{"deploy"}}, status: http.StatusCreated, wantUser: "u1"},
+		{name: "user beyond role", caller: user, request: map[string]any{"name": "ci", "scopes": []string{"admin"}}, status: http.StatusForbidden},
+		{name: "user for other user", caller: user, request: map[string]any{"name": "ci", "scopes": []string{"read"}, "user_id": "u2"}, status: http.StatusForbidden},
+		{name: "token within scopes", caller: userToken, request: map[string]any{"name": "ci", "scopes": []string{"schedule"}}, status: http.StatusCreated, wantUser: "u1", wantProjects: []string{"shop"}},
+		{name: "token broader scope", caller: userToken, request: map[string]any{"name": "ci", "scopes": []string{"deploy"}}, status: http.StatusForbidden},
+		{name: "token broader projects", caller: userToken, request: map[string]any{"name": "ci", "scopes": []string{"read"}, "project_ids": []string{"shop", "blog"}}, status: http.StatusForbidden},
+		{name: "token without user", caller: &services.Principal{Name: "ci", TokenID: "t2", Scopes: []string{"deploy"}}, request: map[string]any{"name": "ci", "scopes": []string{"read"}}, status: http.StatusForbidden},
+		{name: "unknown scope", caller: admin, request: map[string]any{"name": "ci", "scopes": []string{"root"}}, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.Setup(t)
+			testutil.Create(t,
+				&models.User{ID: "u1", Name: "ann", PasswordHash: []byte("x")},
+				&models.User{ID: "u2", Name: "bob", PasswordHash: []byte("x")},
+			)
+
+			router := newRouter(tt.caller, http.MethodPost, "/tokens", TokenCreate)
+			w, response := serveJSON(t, router, http.MethodPost, "/tokens", tt.request)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status != http.StatusCreated {
+				if n := testutil.Count[models.Token](t, "1 = 1"); n != 0 {
+					t.Fatal("the token was created")
+				}
+				return
+			}
+			data := response.Data.(map[string]any)
+			var token models.Token
+			if err := models.DB.First(&token, "id = ?", data["detail"].(map[string]any)["id"]).Error; err != nil {
+				t.Fatal(err)
+			}
+			if token.UserID != tt.wantUser || !slices.Equal(token.ProjectIDs, tt.wantProjects) {
+				t.Fatalf("token of %q on %v, want %q on %v", token.UserID, token.ProjectIDs, tt.wantUser, tt.wantProjects)
+			}
+			// the secret is shown once and only its hash is stored
+			if secret, _ := data["token"].(string); secret == "" || token.Hash != services.TokenHash(secret) {
+				t.Fatalf("secret %q doesn't match the stored hash", data["token"])
+			}
+		})
+	}
+}
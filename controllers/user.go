@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"net/http"
+	"scrapyd/api/errs"
+	"scrapyd/api/types"
+	"scrapyd/models"
+	"scrapyd/services"
+	"strings"
+	"time"
+)
+
+func UserCreate(c *gin.Context) {
+	var request types.UserRequest
+
+	if err := c.ShouldBindWith(&request, binding.JSON); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	if !principal(c).IsAdmin() {
+		c.Error(errs.ErrForbidden)
+		return
+	}
+	if err := models.DB.First(&models.User{}, "name = ?", request.Name).Error; err == nil {
+		c.Error(errs.ErrUserConflict)
+		return
+	}
+
+	hash, err := services.PasswordHash(request.Password)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	reqID, _ := uuid.NewUUID()
+	user := models.User{
+		ID:           strings.ReplaceAll(reqID.String(), "-", ""),
+		Name:         request.Name,
+		PasswordHash: hash,
+		Admin:        request.Admin,
+	}
+	audit(c, "user", user.ID, "", nil, &user)
+	if err := models.DB.Create(&user).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, types.Response{
+		Status:  "success",
+		Message: "created",
+		Data:    user,
+	})
+}
+
+func UserList(c *gin.Context) {
+	var users []models.User
+
+	if !principal(c).IsAdmin() {
+		c.Error(errs.ErrForbidden)
+		return
+	}
+
+	models.DB.Order("name").Find(&users)
+	c.JSON(http.StatusOK, types.Response{
+		Status: "success",
+		Data:   users,
+	})
+}
+
+// UserDelete drops the memberships and roles of the user and revokes its tokens.
+func UserDelete(c *gin.Context) {
+	var user models.User
+
+	if !principal(c).IsAdmin() {
+		c.Error(errs.ErrForbidden)
+		return
+	}
+
+	id := c.Params.ByName("id")
+	if err := models.DB.First(&user, "id = ?", id).Error; err != nil {
+		c.Error(errs.ErrUserNotFound)
+		return
+	}
+	audit(c, "user", user.ID, "", user, nil)
+
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.TeamMember{}, "user_id = ?", user.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.ProjectRole{}, "subject_type = ? AND subject_id = ?", "user", user.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Token{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&user).Error
+	}); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "deleted",
+	})
+}
+
+func TeamCreate(c *gin.Context) {
+	var request types.TeamRequest
+
+	if err := c.ShouldBindWith(&request, binding.JSON); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	if !principal(c).IsAdmin() {
+		c.Error(errs.ErrForbidden)
+		return
+	}
+
+	team := models.Team{Name: request.Name}
+	if rows := models.DB.Create(&team).RowsAffected; rows == 0 {
+		c.Error(errs.ErrTeamConflict)
+		return
+	}
+	audit(c, "team", team.Name, "", nil, &team)
+
+	c.JSON(http.StatusCreated, types.Response{
+		Status:  "success",
+		Message: "created",
+	})
+}
+
+func TeamList(c *gin.Context) {
+	var teams []models.Team
+
+	if !principal(c).IsAdmin() {
+		c.Error(errs.ErrForbidden)
+		return
+	}
+
+	models.DB.Preload("Members").Order("name").Find(&teams)
+	c.JSON(http.StatusOK, types.Response{
+		Status: "success",
+		Data:   teams,
+	})
+}
+
+func TeamDelete(c *gin.Context) {
+	var team models.Team
+
+	if !principal(c).IsAdmin() {
+		c.Error(errs.ErrForbidden)
+		return
+	}
+
+	name := c.Params.ByName("name")
+	if err := models.DB.First(&team, "name = ?", name).Error; err != nil {
+		c.Error(errs.ErrTeamNotFound)
+		return
+	}
+	audit(c, "team", team.Name, "", team, nil)
+
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.ProjectRole{}, "subject_type = ? AND subject_id = ?", "team", team.Name).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&team).Error
+	}); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "deleted",
+	})
+}
+
+func TeamMemberPut(c *gin.Context) {
+	if !principal(c).IsAdmin() {
+		c.Error(errs.ErrForbidden)
+		return
+	}
+
+	name := c.Params.ByName("name")
+	if err := models.DB.First(&models.Team{}, "name = ?", name).Error; err != nil {
+		c.Error(errs.ErrTeamNotFound)
+		return
+	}
+	userID := c.Params.ByName("user_id")
+	if err := models.DB.First(&models.User{}, "id = ?", userID).Error; err != nil {
+		c.Error(errs.ErrUserNotFound)
+		return
+	}
+
+	member := models.TeamMember{TeamName: name, UserID: userID}
+	audit(c, "team", name, "", auditBefore[models.TeamMember]("team_name = ? AND user_id = ?", name, userID), &member)
+	if err := models.DB.FirstOrCreate(&member).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "updated",
+	})
+}
+
+func TeamMemberDelete(c *gin.Context) {
+	var member models.TeamMember
+
+	if !principal(c).IsAdmin() {
+		c.Error(errs.ErrForbidden)
+		return
+	}
+
+	name := c.Params.ByName("name")
+	userID := c.Params.ByName("user_id")
+	if err := models.DB.First(&member, "team_name = ? AND user_id = ?", name, userID).Error; err != nil {
+		c.Error(errs.ErrUserNotFound)
+		return
+	}
+
+	audit(c, "team", name, "", member, nil)
+	if err := models.DB.Delete(&member).Error; err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "deleted",
+	})
+}
@@ -1,13 +1,20 @@
 package controllers
 
 import (
+	"compress/gzip"
+	"fmt"
+	"github.com/distribution/reference"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+	"io"
 	"net/http"
+	"os"
 	"scrapyd/api/errs"
 	"scrapyd/api/types"
 	"scrapyd/models"
 	"scrapyd/services"
-	"scrapyd/tasks"
+	"time"
 )
 
 func VersionCreate(c *gin.Context) {
@@ -15,16 +22,120 @@ func VersionCreate(c *gin.Context) {
 	var version models.Version
 
 	if err := c.ShouldBind(&request); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	if err := authorize(c, "deploy", request.ProjectID); err != nil {
+		c.Error(err)
 		return
 	}
 	if err := models.DB.First(&models.Project{}, "id = ?", request.ProjectID).Error; err != nil {
 		c.Error(errs.ErrProjectNotFound)
 		return
 	}
-	if err := models.DB.First(&version, "id = ? AND project_id = ?", request.ID, request.ProjectID).Error; err == nil {
+	// IDs of deleted versions stay taken, their jobs still refer to them
+	if err := models.DB.Unscoped().First(&version, "id = ?", request.ID).Error; err == nil {
 		c.Error(errs.ErrVersionConflict)
 		return
 	}
+	if err := versionAliasCheck(request.ProjectID, request.ID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	version.ID = request.ID
+	version.ProjectID = request.ProjectID
+	audit(c, "version", version.ID, version.ProjectID, nil, &version)
+
+	if request.Image != "" {
+		named, err := reference.ParseNormalizedNamed(request.Image)
+		if err != nil {
+			c.Error(errs.ErrVersionImageInvalid)
+			return
+		}
+
+		version.Source = "registry"
+		version.Reference = named.String()
+		version.Image = version.Reference
+		version.Status = "pulling"
+		// pulled images carry no signature, projects with trusted keys only take signed uploads
+		if err := services.VersionSignatureVerify(&version, "", nil, nil); err != nil {
+			c.Error(err)
+			return
+		}
+
+		// the daemon pulls in the background, the version becomes ready once pinned and inspected
+		if err := models.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&version).Error; err != nil {
+				return err
+			}
+			return services.OutboxAdd(tx, "pull:version", version.ID)
+		}); err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(http.StatusAccepted, types.Response{
+			Status:  "success",
+			Message: "created",
+			Data:    version,
+		})
+		return
+	}
+
+	if sourceZip, err := c.FormFile("source_zip"); err == nil {
+		file, err := sourceZip.Open()
+		if err != nil {
+			c.Error(errs.ErrVersionSourceInvalid)
+			return
+		}
+		defer file.Close()
+
+		signature, err := formSignature(c)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		version.Source = "source"
+		version.Status = "uploading"
+		if err := versionReserve(&version); err != nil {
+			c.Error(err)
+			return
+		}
+		// rejected sources are removed, the ID can be used again
+		digest, err := services.BuildSourceStore(version.ID, file)
+		if err != nil {
+			models.DB.Unscoped().Delete(&version)
+			c.Error(err)
+			return
+		}
+		if err := services.VersionSignatureVerify(&version, services.BuildSourcePath(version.ID), digest, signature); err != nil {
+			models.DB.Unscoped().Delete(&version)
+			c.Error(err)
+			return
+		}
+
+		version.Image = services.BuildImageTag(&version)
+		version.Status = "building"
+
+		if err := models.DB.Transaction(func(tx *gorm.DB) error {
+			if err := versionSave(tx, &version); err != nil {
+				return err
+			}
+			return services.OutboxAdd(tx, "build:version", version.ID)
+		}); err != nil {
+			os.Remove(services.BuildSourcePath(version.ID))
+			c.Error(err)
+			return
+		}
+
+		c.JSON(http.StatusAccepted, types.Response{
+			Status:  "success",
+			Message: "created",
+			Data:    version,
+		})
+		return
+	}
 
 	imageTar, err := c.FormFile("image_tar")
 	if err != nil {
@@ -39,32 +150,116 @@ func VersionCreate(c *gin.Context) {
 	}
 	defer file.Close()
 
-	imageName := services.VersionInit(file)
-	if imageName == "" {
-		c.Error(errs.ErrVersionImageTarInvalid)
+	signature, err := formSignature(c)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	version.ID = request.ID
-	version.ProjectID = request.ProjectID
-	version.Image = imageName
+	version.Source = "tar"
+	version.Status = "uploading"
+	if err := versionReserve(&version); err != nil {
+		c.Error(err)
+		return
+	}
+
+	// nothing was loaded for uploads that fail to store or verify, the ID can be used again
+	digest, err := services.VersionUploadStore(version.ID, file)
+	if err != nil {
+		models.DB.Unscoped().Delete(&version)
+		c.Error(err)
+		return
+	}
+	if err := services.VersionUploadVerify(&version, digest, request.SHA256, signature); err != nil {
+		models.DB.Unscoped().Delete(&version)
+		c.Error(err)
+		return
+	}
 
-	if err := tasks.NewTask("inspect:version", version.ID); err != nil {
+	if request.Import {
+		if err := services.VersionImport(&version); err != nil {
+			os.Remove(services.VersionUploadPath(version.ID))
+			models.DB.Unscoped().Delete(&version)
+			c.Error(err)
+			return
+		}
+	}
+
+	// loading and inspecting the image happens in the background, the version reports its progress
+	version.Status = "loading"
+	version.Progress = 0
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := versionSave(tx, &version); err != nil {
+			return err
+		}
+		return services.OutboxAdd(tx, "load:version", version.ID)
+	}); err != nil {
+		os.Remove(services.VersionUploadPath(version.ID))
 		c.Error(err)
 		return
 	}
 
-	models.DB.Create(&version)
-	c.JSON(http.StatusCreated, types.Response{
+	c.JSON(http.StatusAccepted, types.Response{
 		Status:  "success",
 		Message: "created",
+		Data:    version,
 	})
 }
 
+// versionReserve creates the row holding on to the ID while the upload is stored, so that
+// concurrent uploads of the same ID don't overwrite each other's files.
+func versionReserve(version *models.Version) error {
+	if rows := models.DB.Create(version).RowsAffected; rows == 0 {
+		return errs.ErrVersionConflict
+	}
+	return nil
+}
+
+// versionAliasCheck refuses version IDs that name an alias of the project, job creation would
+// take the version and the alias would never be used.
+func versionAliasCheck(projectID string, versionID string) error {
+	if err := models.DB.First(&models.Alias{}, "project_id = ? AND name = ?", projectID, versionID).Error; err == nil {
+		return errs.ErrAliasNameTaken
+	}
+	return nil
+}
+
+// versionSave writes back the reserved version. Unlike Save it doesn't bring back a version
+// deleted meanwhile, that one is not found.
+func versionSave(tx *gorm.DB, version *models.Version) error {
+	result := tx.Model(version).Select("*").Updates(version)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return errs.ErrVersionNotFound
+	}
+	return result.Error
+}
+
+// formSignature reads the optional detached signature uploaded next to the version.
+func formSignature(c *gin.Context) ([]byte, error) {
+	signatureFile, err := c.FormFile("signature")
+	if err != nil {
+		return nil, nil
+	}
+	reader, err := signatureFile.Open()
+	if err != nil {
+		return nil, errs.ErrVersionSignatureInvalid
+	}
+	defer reader.Close()
+	signature, err := io.ReadAll(io.LimitReader(reader, 64*1024))
+	if err != nil {
+		return nil, errs.ErrVersionSignatureInvalid
+	}
+	return signature, nil
+}
+
 func VersionList(c *gin.Context) {
 	var versions []models.Version
 
 	projectID := c.Params.ByName("project_id")
+	if err := authorize(c, "read", projectID); err != nil {
+		c.Error(err)
+		return
+	}
 	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
 		c.Error(errs.ErrProjectNotFound)
 		return
@@ -77,10 +272,54 @@ func VersionList(c *gin.Context) {
 	})
 }
 
+func VersionCompare(c *gin.Context) {
+	var request types.VersionCompareRequest
+	var from, to models.Version
+
+	if err := c.ShouldBindWith(&request, binding.Query); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	projectID := c.Params.ByName("project_id")
+	if err := authorize(c, "read", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		c.Error(errs.ErrProjectNotFound)
+		return
+	}
+
+	if err := models.DB.First(&from, "id = ? AND project_id = ?", request.From, projectID).Error; err != nil {
+		c.Error(errs.ErrVersionNotFound)
+		return
+	}
+	if err := models.DB.First(&to, "id = ? AND project_id = ?", request.To, projectID).Error; err != nil {
+		c.Error(errs.ErrVersionNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Status: "success",
+		Data:   services.VersionCompare(&from, &to),
+	})
+}
+
 func VersionDelete(c *gin.Context) {
+	var request types.VersionDeleteRequest
 	var version models.Version
 
+	if err := c.ShouldBindWith(&request, binding.Query); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
 	projectID := c.Params.ByName("project_id")
+	if err := authorize(c, "deploy", projectID); err != nil {
+		c.Error(err)
+		return
+	}
 	if err := models.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
 		c.Error(errs.ErrProjectNotFound)
 		return
@@ -91,20 +330,152 @@ func VersionDelete(c *gin.Context) {
 		c.Error(errs.ErrVersionNotFound)
 		return
 	}
+	audit(c, "version", version.ID, projectID, version, nil)
 
-	// cleanup the related stuff like image
-	if err := services.VersionCleanup(&version); err != nil {
+	if err := services.VersionRemove(&version, request.Force); err != nil {
 		c.Error(err)
 		return
 	}
 
-	if err := models.DB.Delete(&version).Error; err != nil {
+	c.JSON(http.StatusOK, types.Response{
+		Status:  "success",
+		Message: "deleted",
+	})
+}
+
+func VersionInspect(c *gin.Context) {
+	var version models.Version
+
+	projectID := c.Params.ByName("project_id")
+	if err := authorize(c, "deploy", projectID); err != nil {
 		c.Error(err)
 		return
 	}
+	id := c.Params.ByName("version_id")
+	if err := models.DB.First(&version, "id = ? AND project_id = ?", id, projectID).Error; err != nil {
+		c.Error(errs.ErrVersionNotFound)
+		return
+	}
 
-	c.JSON(http.StatusOK, types.Response{
+	audit(c, "version", version.ID, projectID, version, nil)
+
+	// only versions with an image in place can be inspected again, each attempt is a task of its own
+	if version.Image == "" {
+		c.Error(errs.ErrVersionBusy)
+		return
+	}
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Version{}).
+			Where("id = ? AND status IN ?", version.ID, []string{"ready", "failed"}).
+			Updates(map[string]any{"status": "inspecting", "progress": 0})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errs.ErrVersionBusy
+		}
+		return services.OutboxAdd(tx, "inspect:version", version.ID)
+	}); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, types.Response{
 		Status:  "success",
-		Message: "deleted",
+		Message: "inspecting",
 	})
 }
+
+// VersionExport streams the version image as a `docker save` tarball, importable again with import=true.
+func VersionExport(c *gin.Context) {
+	var request types.VersionExportRequest
+	var version models.Version
+
+	if err := c.ShouldBindWith(&request, binding.Query); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	projectID := c.Params.ByName("project_id")
+	if err := authorize(c, "read", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	id := c.Params.ByName("version_id")
+	if err := models.DB.First(&version, "id = ? AND project_id = ?", id, projectID).Error; err != nil {
+		c.Error(errs.ErrVersionNotFound)
+		return
+	}
+	if version.Status != "ready" {
+		c.Error(errs.ErrVersionNotReady)
+		return
+	}
+
+	reader, err := services.VersionExport(&version)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	defer reader.Close()
+
+	filename := fmt.Sprintf("%s_%s.tar", version.ProjectID, version.ID)
+	var writer io.Writer = c.Writer
+	if request.Gzip {
+		gz := gzip.NewWriter(c.Writer)
+		defer gz.Close()
+		writer = gz
+		filename += ".gz"
+		c.Header("Content-Type", "application/gzip")
+	} else {
+		c.Header("Content-Type", "application/x-tar")
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	io.Copy(writer, reader)
+}
+
+func VersionBuildLogs(c *gin.Context) {
+	var version models.Version
+
+	projectID := c.Params.ByName("project_id")
+	if err := authorize(c, "read", projectID); err != nil {
+		c.Error(err)
+		return
+	}
+	id := c.Params.ByName("version_id")
+	if err := models.DB.First(&version, "id = ? AND project_id = ?", id, projectID).Error; err != nil {
+		c.Error(errs.ErrVersionNotFound)
+		return
+	}
+
+	file, err := os.Open(services.BuildLogPath(version.ID))
+	if err != nil {
+		c.Error(errs.ErrVersionBuildLogNotFound)
+		return
+	}
+	defer file.Close()
+
+	flusher, _ := c.Writer.(http.Flusher)
+	fw := &flushingWriter{writer: c.Writer, flusher: flusher}
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+
+	// follow the log until the build is over or the client goes away
+	reqCtx := c.Request.Context()
+	for {
+		if _, err := io.Copy(fw, file); err != nil {
+			return
+		}
+		models.DB.First(&version, "id = ?", version.ID)
+		if version.Status != "building" {
+			io.Copy(fw, file)
+			return
+		}
+
+		select {
+		case <-reqCtx.Done():
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
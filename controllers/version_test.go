@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"scrapyd/api/errs"
+	"scrapyd/config"
+	"scrapyd/models"
+	"scrapyd/testutil"
+	"testing"
+)
+
+func TestVersionCreateRejectsPathIDs(t *testing.T) {
+	for _, upload := range []string{"source_zip", "image_tar"} {
+		for _, id := range []string{"../../escape", "a/b", "..", "v1..zip"} {
+			t.Run(upload+" "+id, func(t *testing.T) {
+				testVersionCreateRejected(t, upload, id)
+			})
+		}
+	}
+}
+
+func testVersionCreateRejected(t *testing.T, upload string, id string) {
+	setupJobs(t)
+	router := newRouter(admin, http.MethodPost, "/versions", VersionCreate)
+
+	contentType, body := multipartBody(t,
+		map[string]string{"id": id, "project_id": "shop"},
+		map[string][][2]string{upload: {{"upload", "PK"}}},
+	)
+	w, response := serve(t, router, http.MethodPost, "/versions", contentType, body)
+	if w.Code != http.StatusBadRequest || response.Code != "VALIDATION_FAILED" {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if _, err := os.Stat(config.DataDir); !os.IsNotExist(err) {
+		t.Fatal("the upload was stored")
+	}
+	if n := testutil.Count[models.Version](t, "id = ?", id); n != 0 {
+		t.Fatal("the version was created")
+	}
+}
+
+func TestVersionInspectAgain(t *testing.T) {
+	setupJobs(t)
+	testutil.Create(t, &models.Version{ID: "v2", ProjectID: "shop", Image: "shop:v2", Status: "failed", Error: "scrapy list exited with 1"})
+	router := newRouter(admin, http.MethodPost, "/versions/:project_id/:version_id/inspect", VersionInspect)
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		w, _ := serve(t, router, http.MethodPost, "/versions/shop/v2/inspect", "", nil)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("attempt %d: status %d: %s", attempt, w.Code, w.Body)
+		}
+		if n := testutil.Count[models.Outbox](t, "type = ? AND task_id = ?", "inspect:version", "v2"); n != int64(attempt) {
+			t.Fatalf("attempt %d: %d inspect tasks", attempt, n)
+		}
+
+		// still inspecting
+		if w, _ := serve(t, router, http.MethodPost, "/versions/shop/v2/inspect", "", nil); w.Code != http.StatusConflict {
+			t.Fatalf("attempt %d: inspecting twice: status %d", attempt, w.Code)
+		}
+		models.DB.Model(&models.Version{}).Where("id = ?", "v2").Update("status", "failed")
+	}
+}
+
+func TestVersionCreateStoreFailureFreesID(t *testing.T) {
+	setupJobs(t)
+	router := newRouter(admin, http.MethodPost, "/versions", VersionCreate)
+	upload := func() *httptest.ResponseRecorder {
+		contentType, body := multipartBody(t,
+			map[string]string{"id": "v2", "project_id": "shop"},
+			map[string][][2]string{"image_tar": {{"image.tar", "tar"}}},
+		)
+		w, _ := serve(t, router, http.MethodPost, "/versions", contentType, body)
+		return w
+	}
+
+	// the uploads dir can't be created
+	if err := os.MkdirAll(config.DataDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(config.DataDir, "uploads"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if w := upload(); w.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var n int64
+	models.DB.Unscoped().Model(&models.Version{}).Where("id = ?", "v2").Count(&n)
+	if n != 0 {
+		t.Fatal("the failed version was kept")
+	}
+
+	os.Remove(filepath.Join(config.DataDir, "uploads"))
+	if w := upload(); w.Code != http.StatusAccepted {
+		t.Fatalf("retry: status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestVersionCreateSourceReservesID(t *testing.T) {
+	setupJobs(t)
+	router := newRouter(admin, http.MethodPost, "/versions", VersionCreate)
+
+	// rejected sources free the ID
+	contentType, body := multipartBody(t,
+		map[string]string{"id": "v2", "project_id": "shop"},
+		map[string][][2]string{"source_zip": {{"source.zip", "not a zip"}}},
+	)
+	if w, response := serve(t, router, http.MethodPost, "/versions", contentType, body); response.Code != "VERSION_SOURCE_INVALID" {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var n int64
+	models.DB.Unscoped().Model(&models.Version{}).Where("id = ?", "v2").Count(&n)
+	if n != 0 {
+		t.Fatal("the rejected version was kept")
+	}
+
+	// an upload holding the ID makes the next one conflict before it stores anything
+	if err := versionReserve(&models.Version{ID: "v2", ProjectID: "shop", Source: "source", Status: "uploading"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := versionReserve(&models.Version{ID: "v2", ProjectID: "shop", Source: "source", Status: "uploading"}); !errors.Is(err, errs.ErrVersionConflict) {
+		t.Fatalf("second reservation: %v", err)
+	}
+}
+
+func TestVersionCreateAliasNameTaken(t *testing.T) {
+	setupJobs(t)
+	testutil.Create(t, &models.Alias{ProjectID: "shop", Name: "live", VersionID: "v1"})
+	router := newRouter(admin, http.MethodPost, "/versions", VersionCreate)
+
+	for _, upload := range []string{"source_zip", "image_tar"} {
+		contentType, body := multipartBody(t,
+			map[string]string{"id": "live", "project_id": "shop"},
+			map[string][][2]string{upload: {{"upload", "PK"}}},
+		)
+		w, response := serve(t, router, http.MethodPost, "/versions", contentType, body)
+		if w.Code != http.StatusConflict || response.Code != "ALIAS_NAME_TAKEN" {
+			t.Fatalf("%s: status %d: %s", upload, w.Code, w.Body)
+		}
+	}
+	if n := testutil.Count[models.Version](t, "id = ?", "live"); n != 0 {
+		t.Fatal("the version was created")
+	}
+}
@@ -0,0 +1,13 @@
+// Package dashboard embeds the web UI, served by the daemon under /ui/.
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed static
+var static embed.FS
+
+// FS holds index.html and its assets at its root
+var FS, _ = fs.Sub(static, "static")
@@ -0,0 +1,440 @@
+// The dashboard is a plain client of the REST API, it sends the token the user signs in with
+// and polls for changes. Everything coming from the API is inserted as text, never as HTML.
+"use strict";
+
+const tokenKey = "scrapyd-token";
+const refreshInterval = 3000;
+const activeStatuses = ["pending", "queued", "running"];
+
+const state = {
+  token: sessionStorage.getItem(tokenKey) || "",
+  projects: [],
+  project: "",
+  versions: [],
+  aliases: [],
+  version: "",
+  jobs: [],
+  logs: null, // AbortController of the log tail
+};
+
+const $ = (selector) => document.querySelector(selector);
+const enc = encodeURIComponent;
+
+function el(tag, attrs = {}, ...children) {
+  const node = document.createElement(tag);
+  for (const [key, value] of Object.entries(attrs)) {
+    if (key.startsWith("on")) {
+      node.addEventListener(key.slice(2), value);
+    } else if (key === "class") {
+      node.className = value;
+    } else {
+      node.setAttribute(key, value);
+    }
+  }
+  node.append(...children.filter((child) => child !== null && child !== undefined));
+  return node;
+}
+
+class APIError extends Error {
+  constructor(status, payload) {
+    super(payload.message || `HTTP ${status}`);
+    this.status = status;
+    this.details = payload.details || [];
+    this.requestID = payload.request_id;
+  }
+}
+
+function headers() {
+  return { Authorization: `Bearer ${state.token}` };
+}
+
+async function api(method, path, body) {
+  const options = { method, headers: headers() };
+  if (body !== undefined) {
+    options.headers["Content-Type"] = "application/json";
+    options.body = JSON.stringify(body);
+  }
+  const response = await fetch(path, options);
+  const payload = await response.json().catch(() => ({}));
+  if (!response.ok) {
+    throw new APIError(response.status, payload);
+  }
+  return payload.data;
+}
+
+function showError(error) {
+  if (error.name === "AbortError") {
+    return;
+  }
+  if (error.status === 401) {
+    signIn();
+    return;
+  }
+  let message = error.message;
+  if (error.details && error.details.length) {
+    message += ": " + error.details.map((detail) => detail.message).join("; ");
+  }
+  if (error.requestID) {
+    message += ` (request ${error.requestID})`;
+  }
+  $("#error").textContent = message;
+  $("#error").hidden = false;
+}
+
+function clearError() {
+  $("#error").hidden = true;
+}
+
+function formatTime(value) {
+  const time = new Date(value);
+  return isNaN(time) || time.getFullYear() < 2000 ? "-" : time.toLocaleString();
+}
+
+function statusCell(status) {
+  return el("td", {}, el("span", { class: `status status-${status}` }, status));
+}
+
+// sign in
+
+function signIn() {
+  if (!$("#login").open) {
+    $("#login").showModal();
+  }
+}
+
+$("#login-form").addEventListener("submit", () => {
+  state.token = new FormData($("#login-form")).get("token").trim();
+  sessionStorage.setItem(tokenKey, state.token);
+  $("#login-form").reset();
+  clearError();
+  loadProjects().catch(showError);
+  refresh();
+});
+
+$("#signout").addEventListener("click", () => {
+  sessionStorage.removeItem(tokenKey);
+  state.token = "";
+  closeLogs();
+  signIn();
+});
+
+// projects, versions and spiders
+
+async function loadProjects() {
+  state.projects = (await api("GET", "/projects")) || [];
+  state.projects.sort((a, b) => a.id.localeCompare(b.id));
+  renderProjects();
+
+  const select = $("#schedule [name=project_id]");
+  select.replaceChildren(...state.projects.map((project) => el("option", { value: project.id }, project.id)));
+  if (!state.projects.some((project) => project.id === state.project)) {
+    state.project = "";
+  }
+  if (!state.project && state.projects.length) {
+    await selectProject(state.projects[0].id);
+  }
+}
+
+function renderProjects() {
+  $("#projects").replaceChildren(
+    ...state.projects.map((project) =>
+      el("li", {
+        class: project.id === state.project ? "selected" : "",
+        onclick: () => selectProject(project.id).catch(showError),
+      }, project.id)),
+  );
+}
+
+async function selectProject(id) {
+  state.project = id;
+  state.version = "";
+  renderProjects();
+  $("#versions-project").textContent = id;
+  $("#schedule [name=project_id]").value = id;
+  await loadVersions();
+
+  const ready = state.versions.find((version) => version.status === "ready");
+  selectVersion(ready ? ready.id : "");
+  renderJobs();
+}
+
+async function loadVersions() {
+  if (!state.project) {
+    return;
+  }
+  const [versions, aliases] = await Promise.all([
+    api("GET", `/versions/${enc(state.project)}`),
+    api("GET", `/projects/${enc(state.project)}/aliases`).catch(() => []),
+  ]);
+  state.versions = (versions || []).sort((a, b) => Date.parse(b.created_at) - Date.parse(a.created_at));
+  state.aliases = aliases || [];
+  renderVersions();
+  renderVersionOptions();
+}
+
+function renderVersions() {
+  $("#versions tbody").replaceChildren(
+    ...state.versions.map((version) => {
+      const status = version.status !== "ready" && version.status !== "failed" && version.progress > 0
+        ? `${version.status} ${version.progress}%`
+        : version.status;
+      return el("tr", {
+        class: version.id === state.version ? "selected" : "",
+        title: version.error || "",
+        onclick: () => selectVersion(version.id),
+      },
+      el("td", {}, version.id),
+      statusCell(status),
+      el("td", {}, version.source || "-"),
+      el("td", {}, formatTime(version.created_at)));
+    }),
+  );
+}
+
+function selectVersion(id) {
+  state.version = id;
+  renderVersions();
+  $("#spiders-version").textContent = id;
+
+  const version = state.versions.find((version) => version.id === id);
+  const spiders = version ? version.spiders || [] : [];
+  $("#spiders").replaceChildren(
+    ...spiders.map((spider) =>
+      el("li", { title: "schedule this spider", onclick: () => prefill(id, spider) }, spider)),
+  );
+  if (version && version.status === "ready") {
+    $("#schedule [name=version_id]").value = id;
+    renderSpiderOptions();
+  }
+}
+
+// schedule form
+
+function resolveVersion(value) {
+  const alias = state.aliases.find((alias) => alias.name === value);
+  return state.versions.find((version) => version.id === (alias ? alias.version_id : value));
+}
+
+function renderVersionOptions() {
+  const select = $("#schedule [name=version_id]");
+  const current = select.value;
+  const options = state.aliases.map((alias) => el("option", { value: alias.name }, `${alias.name} → ${alias.version_id}`));
+  for (const version of state.versions) {
+    if (version.status === "ready") {
+      options.push(el("option", { value: version.id }, version.id));
+    }
+  }
+  select.replaceChildren(...options);
+  if ([...select.options].some((option) => option.value === current)) {
+    select.value = current;
+  }
+  renderSpiderOptions();
+}
+
+function renderSpiderOptions() {
+  const select = $("#schedule [name=spider]");
+  const current = select.value;
+  const version = resolveVersion($("#schedule [name=version_id]").value);
+  const spiders = version ? version.spiders || [] : [];
+  select.replaceChildren(...spiders.map((spider) => el("option", { value: spider }, spider)));
+  if (spiders.includes(current)) {
+    select.value = current;
+  }
+}
+
+function prefill(versionID, spider) {
+  $("#schedule [name=version_id]").value = versionID;
+  renderSpiderOptions();
+  $("#schedule [name=spider]").value = spider;
+  $("#schedule [name=args]").focus();
+}
+
+// lines parses KEY=VALUE lines, blank lines are skipped
+function lines(text, what) {
+  const result = [];
+  for (const line of text.split("\n").map((line) => line.trim())) {
+    if (!line) {
+      continue;
+    }
+    if (line.indexOf("=") < 1) {
+      throw new Error(`${what} "${line}": expected KEY=VALUE`);
+    }
+    result.push(line);
+  }
+  return result;
+}
+
+$("#schedule [name=project_id]").addEventListener("change", (event) => {
+  selectProject(event.target.value).catch(showError);
+});
+
+$("#schedule [name=version_id]").addEventListener("change", renderSpiderOptions);
+
+$("#schedule").addEventListener("submit", async (event) => {
+  event.preventDefault();
+  clearError();
+  const form = new FormData(event.target);
+  try {
+    const args = {};
+    for (const line of lines(form.get("args"), "argument")) {
+      const index = line.indexOf("=");
+      args[line.slice(0, index)] = line.slice(index + 1);
+    }
+    await api("POST", "/jobs", {
+      project_id: form.get("project_id"),
+      version_id: form.get("version_id"),
+      spider: form.get("spider"),
+      args,
+      setting: lines(form.get("setting"), "setting").join("\n"),
+    });
+    await loadJobs();
+  } catch (error) {
+    showError(error);
+  }
+});
+
+// jobs
+
+async function loadJobs() {
+  state.jobs = (await api("GET", "/jobs")) || [];
+  state.jobs.sort((a, b) => Date.parse(b.created_at) - Date.parse(a.created_at));
+  renderJobs();
+}
+
+function renderJobs() {
+  const jobs = state.jobs.filter((job) => !state.project || job.project_id === state.project).slice(0, 100);
+  $("#jobs tbody").replaceChildren(
+    ...jobs.map((job) => {
+      const active = activeStatuses.includes(job.status);
+      const exit = job.status === "finished" ? String(job.exit_code) : "-";
+      return el("tr", {},
+        el("td", {}, job.id),
+        el("td", {}, job.project_id),
+        el("td", {}, job.alias ? `${job.version_id} (${job.alias})` : job.version_id),
+        el("td", {}, job.spider),
+        statusCell(job.status),
+        el("td", { class: exit !== "-" && exit !== "0" ? "exit-failed" : "" }, exit),
+        el("td", {}, formatTime(job.created_at)),
+        el("td", {},
+          el("button", { type: "button", onclick: () => tailLogs(job.id) }, "Logs"),
+          active
+            ? el("button", { type: "button", onclick: () => updateJob(job.id, "cancel", `Cancel job ${job.id}?`) }, "Cancel")
+            : el("button", { type: "button", onclick: () => updateJob(job.id, "restart") }, "Rerun")));
+    }),
+  );
+}
+
+async function updateJob(id, action, question) {
+  if (question && !confirm(question)) {
+    return;
+  }
+  clearError();
+  try {
+    await api("PATCH", "/jobs", { id, status: action });
+    await loadJobs();
+  } catch (error) {
+    showError(error);
+  }
+}
+
+// logs
+
+function sleep(ms, signal) {
+  return new Promise((resolve, reject) => {
+    const timer = setTimeout(resolve, ms);
+    signal.addEventListener("abort", () => {
+      clearTimeout(timer);
+      reject(signal.reason);
+    }, { once: true });
+  });
+}
+
+function closeLogs() {
+  if (state.logs) {
+    state.logs.abort();
+    state.logs = null;
+  }
+  $("#logs-panel").hidden = true;
+}
+
+// tailLogs streams the logs of the job, waiting for its container to start first
+async function tailLogs(id) {
+  closeLogs();
+  const controller = new AbortController();
+  state.logs = controller;
+  const pre = $("#logs");
+  pre.textContent = "";
+  $("#logs-job").textContent = id;
+  $("#logs-panel").hidden = false;
+
+  try {
+    let job = await api("GET", `/jobs/${enc(id)}`);
+    while (job.status === "pending" || job.status === "queued") {
+      pre.textContent = `job is ${job.status}, waiting for it to start...`;
+      await sleep(refreshInterval, controller.signal);
+      job = await api("GET", `/jobs/${enc(id)}`);
+    }
+    pre.textContent = "";
+
+    const response = await fetch(`/jobs/${enc(id)}/logs?follow=true`, { headers: headers(), signal: controller.signal });
+    if (!response.ok) {
+      throw new APIError(response.status, await response.json().catch(() => ({})));
+    }
+    const reader = response.body.pipeThrough(new TextDecoderStream()).getReader();
+    for (;;) {
+      const { value, done } = await reader.read();
+      if (done) {
+        break;
+      }
+      const atBottom = pre.scrollTop + pre.clientHeight >= pre.scrollHeight - 4;
+      pre.append(value);
+      if (atBottom) {
+        pre.scrollTop = pre.scrollHeight;
+      }
+    }
+  } catch (error) {
+    if (state.logs === controller) {
+      showError(error);
+    }
+  }
+}
+
+$("#logs-close").addEventListener("click", closeLogs);
+
+// polling
+
+async function loadDaemon() {
+  try {
+    const status = await api("GET", "/daemonstatus");
+    $("#daemon").textContent =
+      `${status.node_name} · ${status.pending} pending · ${status.running} running · ${status.finished} finished`;
+  } catch (error) {
+    if (error.status === 401) {
+      throw error;
+    }
+    $("#daemon").textContent = `daemon unavailable: ${error.message}`;
+  }
+}
+
+async function refresh() {
+  if (!state.token) {
+    signIn();
+    return;
+  }
+  try {
+    await Promise.all([loadDaemon(), loadJobs(), loadVersions()]);
+  } catch (error) {
+    showError(error);
+  }
+}
+
+setInterval(() => {
+  if (!document.hidden && !$("#login").open) {
+    refresh();
+  }
+}, refreshInterval);
+
+if (state.token) {
+  loadProjects().catch(showError);
+}
+refresh();
@@ -7,6 +7,8 @@ import (
 	"github.com/rs/zerolog/log"
 	"scrapyd/models"
 	"scrapyd/services"
+	"scrapyd/tasks"
+	"strconv"
 	"strings"
 )
 
@@ -45,11 +47,17 @@ func StartDockerEventListener(ctx context.Context) {
 						Msg("job not found")
 					continue
 				}
-				if job.Status == "cancelled" {
-					continue
+				if job.Status != "cancelled" {
+					job.Status = "finished"
+					job.ExitCode, _ = strconv.Atoi(msg.Actor.Attributes["exitCode"])
+					models.DB.Save(&job)
+				}
+				if err := tasks.ReleaseQueuedJob(job.Fingerprint); err != nil {
+					log.Error().
+						Err(err).
+						Str("job", jobID).
+						Msg("failed to release queued job")
 				}
-				job.Status = "finished"
-				models.DB.Save(&job)
 			}
 
 		case err, ok := <-errChan:
@@ -2,18 +2,16 @@ package main
 
 import (
 	"context"
-	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"net/http"
 	"os"
 	"os/signal"
-	"scrapyd/api/errs"
-	"scrapyd/api/types"
 	"scrapyd/controllers"
 	"scrapyd/listerners"
 	"scrapyd/models"
+	"scrapyd/tasks"
 	"sync"
 	"syscall"
 	"time"
@@ -24,33 +22,9 @@ func ZLogMiddleware() gin.HandlerFunc {
 		startTime := time.Now()
 		c.Next()
 		latency := time.Since(startTime)
-		status := c.Writer.Status()
-
-		if len(c.Errors) != 0 {
-			err := c.Errors.Last().Err
-			//log.Error().Err(err).Msg("")  !!!
-
-			if !c.Writer.Written() {
-				for knownErr, statusCode := range errs.ErrStatusMap {
-					if errors.Is(err, knownErr) {
-						c.AbortWithStatusJSON(statusCode, types.Response{
-							Status:  "error",
-							Message: knownErr.Error(),
-						})
-						break
-					}
-				}
-			}
-			// catch rogue err
-			if !c.Writer.Written() {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, types.Response{
-					Status:  "error",
-					Message: "",
-				})
-			}
-		}
+
 		log.Debug().
-			Int("status", status).
+			Int("status", c.Writer.Status()).
 			Dur("latency", latency).
 			Str("ip", c.ClientIP()).
 			Str("method", c.Request.Method).
@@ -77,8 +51,16 @@ func main() {
 		listerners.StartDockerEventListener(mainCtx)
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		tasks.StartOutboxRelay(mainCtx)
+	}()
+
+	controllers.SetupValidator()
+
 	router := gin.New()
-	router.Use(ZLogMiddleware(), gin.Recovery())
+	router.Use(controllers.RequestID(), controllers.AuditLog(), ZLogMiddleware(), controllers.ErrorResponse(), gin.Recovery(), controllers.Authenticate(), controllers.ValidateRequest())
 	srv := &http.Server{
 		Addr:    ":8081",
 		Handler: router,
@@ -87,11 +69,41 @@ func main() {
 	router.POST("/projects", controllers.ProjectCreate)       // AddVersion
 	router.GET("/projects", controllers.ProjectList)          // ListProjects
 	router.DELETE("/projects/:id", controllers.ProjectDelete) // DelProject
+	router.GET("/projects/:id/env", controllers.EnvList)
+	router.PUT("/projects/:id/env/:name", controllers.EnvPut)
+	router.DELETE("/projects/:id/env/:name", controllers.EnvDelete)
+	router.GET("/projects/:id/secrets", controllers.SecretList)
+	router.PUT("/projects/:id/secrets/:name", controllers.SecretPut)
+	router.DELETE("/projects/:id/secrets/:name", controllers.SecretDelete)
+	router.GET("/projects/:id/policies", controllers.PolicyList)
+	router.PUT("/projects/:id/policies/:spider", controllers.PolicyPut)
+	router.DELETE("/projects/:id/policies/:spider", controllers.PolicyDelete)
+	router.GET("/projects/:id/registries", controllers.RegistryList)
+	router.PUT("/projects/:id/registries/:registry", controllers.RegistryPut)
+	router.DELETE("/projects/:id/registries/:registry", controllers.RegistryDelete)
+	router.GET("/projects/:id/keys", controllers.KeyList)
+	router.PUT("/projects/:id/keys/:name", controllers.KeyPut)
+	router.DELETE("/projects/:id/keys/:name", controllers.KeyDelete)
+	router.GET("/projects/:id/aliases", controllers.AliasList)
+	router.PUT("/projects/:id/aliases/:name", controllers.AliasPromote)
+	router.DELETE("/projects/:id/aliases/:name", controllers.AliasDelete)
+	router.POST("/projects/:id/aliases/:name/rollback", controllers.AliasRollback)
+	router.GET("/projects/:id/aliases/:name/history", controllers.AliasHistory)
+	router.PUT("/projects/:id/build", controllers.ProjectBuildPut)
+	router.GET("/projects/:id/roles", controllers.RoleList)
+	router.PUT("/projects/:id/roles/:subject_type/:subject_id", controllers.RolePut)
+	router.DELETE("/projects/:id/roles/:subject_type/:subject_id", controllers.RoleDelete)
+	router.GET("/projects/:id/retention", controllers.ProjectRetentionReport)
+	router.PUT("/projects/:id/retention", controllers.ProjectRetentionPut)
 
 	// Version
 	router.POST("/versions", controllers.VersionCreate)                           // AddVersion
 	router.GET("/versions/:project_id", controllers.VersionList)                  // ListVersions ListSpiders
 	router.DELETE("/versions/:project_id/:version_id", controllers.VersionDelete) // DelVersion
+	router.GET("/versions/:project_id/compare", controllers.VersionCompare)
+	router.GET("/versions/:project_id/:version_id/image", controllers.VersionExport)
+	router.GET("/versions/:project_id/:version_id/build-logs", controllers.VersionBuildLogs)
+	router.POST("/versions/:project_id/:version_id/inspect", controllers.VersionInspect)
 
 	// Jobs
 	router.POST("/jobs", controllers.JobCreate)  // Schedule
@@ -100,9 +112,51 @@ func main() {
 	router.PATCH("/jobs", controllers.JobUpdate) // Cancel
 	router.DELETE("/jobs/:id", controllers.JobDelete)
 	router.GET("/jobs/:id/logs", controllers.JobLogStream)
+	router.POST("/jobs/batch", controllers.JobBatchCreate)
+	router.POST("/jobs/bulk", controllers.JobBulkUpdate)
+
+	// Inputs
+	router.POST("/inputs", controllers.InputCreate)
+	router.GET("/inputs/:project_id", controllers.InputList)
+	router.DELETE("/inputs/:project_id/:input_id", controllers.InputDelete)
+
+	// Tokens
+	router.POST("/tokens", controllers.TokenCreate)
+	router.GET("/tokens", controllers.TokenList)
+	router.DELETE("/tokens/:id", controllers.TokenRevoke)
+
+	// Users and teams
+	router.POST("/users", controllers.UserCreate)
+	router.GET("/users", controllers.UserList)
+	router.DELETE("/users/:id", controllers.UserDelete)
+	router.POST("/teams", controllers.TeamCreate)
+	router.GET("/teams", controllers.TeamList)
+	router.DELETE("/teams/:name", controllers.TeamDelete)
+	router.PUT("/teams/:name/members/:user_id", controllers.TeamMemberPut)
+	router.DELETE("/teams/:name/members/:user_id", controllers.TeamMemberDelete)
+
+	// Audit
+	router.GET("/audit", controllers.AuditList)
+	router.GET("/audit/export", controllers.AuditExport)
 
 	// miscellaneous
 	router.GET("/daemonstatus", controllers.DaemonStatus) // DaemonStatus
+	router.GET("/openapi.json", controllers.OpenAPISpec)
+	router.GET("/ui/*filepath", controllers.Dashboard)
+
+	// classic scrapyd API
+	router.GET("/daemonstatus.json", controllers.ScrapydDaemonStatus)
+	router.GET("/listprojects.json", controllers.ScrapydListProjects)
+	router.GET("/listversions.json", controllers.ScrapydListVersions)
+	router.GET("/listspiders.json", controllers.ScrapydListSpiders)
+	router.GET("/listjobs.json", controllers.ScrapydListJobs)
+	router.POST("/addversion.json", controllers.ScrapydAddVersion)
+	router.POST("/schedule.json", controllers.ScrapydSchedule)
+	router.POST("/cancel.json", controllers.ScrapydCancel)
+	router.POST("/delversion.json", controllers.ScrapydDelVersion)
+	router.POST("/delproject.json", controllers.ScrapydDelProject)
+
+	controllers.OpenAPIInit(router.Routes())
 
 	wg.Add(1)
 	go func() {
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Alias is a movable name (latest, staging, prod, ...) pointing at a version of the project
+type Alias struct {
+	ProjectID         string    `json:"project_id" gorm:"primaryKey"`
+	Name              string    `json:"name" gorm:"primaryKey"`
+	VersionID         string    `json:"version_id" gorm:"not null"`
+	PreviousVersionID string    `json:"previous_version_id"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// AliasChange records every move of an alias
+type AliasChange struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	ProjectID     string    `json:"project_id" gorm:"not null;index"`
+	Name          string    `json:"name" gorm:"not null"`
+	Action        string    `json:"action" gorm:"not null"` // promote or rollback
+	FromVersionID string    `json:"from_version_id"`
+	ToVersionID   string    `json:"to_version_id" gorm:"not null"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry records a mutating API call, the table is append-only.
+type AuditEntry struct {
+	ID         uint            `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time       `json:"created_at" gorm:"index"`
+	Actor      string          `json:"actor" gorm:"index"` // user or token name, empty when unauthenticated
+	UserID     string          `json:"user_id,omitempty"`
+	TokenID    string          `json:"token_id,omitempty"`
+	IP         string          `json:"ip"`
+	RequestID  string          `json:"request_id" gorm:"index"`
+	Method     string          `json:"method"`
+	Path       string          `json:"path"`
+	Action     string          `json:"action" gorm:"index"` // the controller handling the call, e.g. ProjectDelete
+	ProjectID  string          `json:"project_id,omitempty" gorm:"index"`
+	TargetType string          `json:"target_type,omitempty"`
+	TargetID   string          `json:"target_id,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	Outcome    string          `json:"outcome" gorm:"index"` // success, denied or error
+	StatusCode int             `json:"status_code"`
+	Error      string          `json:"error,omitempty"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type EnvVar struct {
+	ProjectID string    `json:"project_id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"primaryKey"`
+	Value     string    `json:"value"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
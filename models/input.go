@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type InputFile struct {
+	ID        string    `json:"id" gorm:"primaryKey"`
+	ProjectID string    `json:"project_id" gorm:"not null"`
+	Name      string    `json:"name" gorm:"not null"`
+	Hash      string    `json:"hash" gorm:"not null;index"`
+	Size      int64     `json:"size"`
+	Path      string    `json:"-" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
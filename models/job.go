@@ -1,12 +1,27 @@
 package models
 
+import "time"
+
 type Job struct {
-	ID        string `json:"id" gorm:"primaryKey"`
-	ProjectID string `json:"project_id" gorm:"not null"`
-	VersionID string `json:"version_id" gorm:"not null"`
-	Status    string `json:"status" gorm:"not null"`
-	Spider    string `json:"spider" gorm:"not null"`
-	Setting   string `json:"setting"`
+	ID          string            `json:"id" gorm:"primaryKey"`
+	ProjectID   string            `json:"project_id" gorm:"not null"`
+	VersionID   string            `json:"version_id" gorm:"not null"`
+	Alias       string            `json:"alias,omitempty"` // resolved to version_id again at dispatch
+	Status      string            `json:"status" gorm:"not null"`
+	ExitCode    int               `json:"exit_code"`       // of the crawl container, set once it finished
+	Error       string            `json:"error,omitempty"` // why the job failed to start
+	Spider      string            `json:"spider" gorm:"not null"`
+	Setting     string            `json:"setting"`
+	Args        map[string]string `json:"args" gorm:"serializer:json"` // passed to the spider as -a key=value
+	Uniqueness  string            `json:"uniqueness"`
+	Fingerprint string            `json:"fingerprint" gorm:"index"`
+	Inputs      []string          `json:"inputs" gorm:"serializer:json"` // input file IDs mounted into the container
+	InputHash   string            `json:"input_hash"`                    // content hash over all mounted inputs
+	Env         map[string]string `json:"env" gorm:"serializer:json"`
+	Secrets     []string          `json:"secrets" gorm:"serializer:json"` // names only, values are resolved at dispatch
+
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+	UpdatedAt time.Time `json:"updated_at"`
 
 	Project Project `json:"project" gorm:"foreignKey:ProjectID"`
 	Version Version `json:"version" gorm:"foreignKey:VersionID"`
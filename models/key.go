@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// TrustedKey is a public key image tar signatures of the project are checked against.
+type TrustedKey struct {
+	ProjectID string    `json:"project_id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"primaryKey"`
+	PublicKey string    `json:"public_key" gorm:"not null"` // PEM encoded PKIX public key
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
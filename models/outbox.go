@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Outbox holds tasks written in the same transaction as the rows they act on,
+// the relay publishes them to the queue afterwards.
+type Outbox struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	Type      string     `json:"type" gorm:"not null"`
+	TaskID    string     `json:"task_id" gorm:"not null"`
+	Sent      bool       `json:"sent" gorm:"not null;default:false;index"`
+	Attempts  int        `json:"attempts"`
+	LastError string     `json:"last_error"`
+	CreatedAt time.Time  `json:"created_at"`
+	SentAt    *time.Time `json:"sent_at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type SpiderPolicy struct {
+	ProjectID    string    `json:"project_id" gorm:"primaryKey"`
+	Spider       string    `json:"spider" gorm:"primaryKey"`
+	Uniqueness   string    `json:"uniqueness" gorm:"not null"` // allow, reject or queue
+	UniqueByArgs bool      `json:"unique_by_args"`             // tell runs apart by their spider args
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
@@ -7,5 +7,19 @@ type Project struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
-	Versions []Version `json:"versions,omitempty" gorm:"foreignKey:ProjectID;constraint:OnDelete:CASCADE;"`
+	BaseImage string `json:"base_image,omitempty"` // FROM of source and egg builds, defaults to SCRAPYD_BUILD_BASE_IMAGE
+
+	RetainLast       int `json:"retain_last"`        // keep that many of the newest versions, 0 keeps all
+	RetainUnusedDays int `json:"retain_unused_days"` // drop versions unused for that many days, 0 keeps all
+
+	Versions     []Version            `json:"versions,omitempty" gorm:"foreignKey:ProjectID;constraint:OnDelete:CASCADE;"`
+	Inputs       []InputFile          `json:"inputs,omitempty" gorm:"foreignKey:ProjectID;constraint:OnDelete:CASCADE;"`
+	EnvVars      []EnvVar             `json:"env,omitempty" gorm:"foreignKey:ProjectID;constraint:OnDelete:CASCADE;"`
+	Secrets      []Secret             `json:"-" gorm:"foreignKey:ProjectID;constraint:OnDelete:CASCADE;"`
+	Policies     []SpiderPolicy       `json:"policies,omitempty" gorm:"foreignKey:ProjectID;constraint:OnDelete:CASCADE;"`
+	Registries   []RegistryCredential `json:"-" gorm:"foreignKey:ProjectID;constraint:OnDelete:CASCADE;"`
+	Aliases      []Alias              `json:"aliases,omitempty" gorm:"foreignKey:ProjectID;constraint:OnDelete:CASCADE;"`
+	AliasChanges []AliasChange        `json:"-" gorm:"foreignKey:ProjectID;constraint:OnDelete:CASCADE;"`
+	Roles        []ProjectRole        `json:"-" gorm:"foreignKey:ProjectID;constraint:OnDelete:CASCADE;"`
+	TrustedKeys  []TrustedKey         `json:"-" gorm:"foreignKey:ProjectID;constraint:OnDelete:CASCADE;"`
 }
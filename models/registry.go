@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type RegistryCredential struct {
+	ProjectID string    `json:"project_id" gorm:"primaryKey"`
+	Registry  string    `json:"registry" gorm:"primaryKey"` // registry host, e.g. ghcr.io or localhost:5000
+	Username  string    `json:"username" gorm:"not null"`
+	Password  []byte    `json:"-" gorm:"not null"` // sealed with the master key
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type Secret struct {
+	ProjectID string    `json:"project_id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"primaryKey"`
+	Value     []byte    `json:"-" gorm:"not null"` // sealed with the master key, never leaves the daemon
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -1,22 +1,49 @@
 package models
 
 import (
+	"fmt"
 	"github.com/rs/zerolog/log"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"strings"
+	"time"
 )
 
 var DB *gorm.DB
 
 func ConnectDatabase() {
-	dsn := "my_database.db?_foreign_keys=on"
-	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
-	//db, err := gorm.Open(sqlite.Open("test.db"), &gorm.Config{})
+	db, err := Open("my_database.db")
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to connect to database")
 	}
-	if err := db.AutoMigrate(&Project{}, &Version{}, &Job{}); err != nil {
-		log.Fatal().Err(err).Msg("failed to auto migrate")
-	}
 	DB = db
 }
+
+// Open connects to the sqlite database file and migrates it.
+func Open(path string) (*gorm.DB, error) {
+	// transactions take the write lock right away and wait for it, so that what they
+	// check still holds when they write, even with several daemons on the database
+	dsn := path + "?_foreign_keys=on&_txlock=immediate&_busy_timeout=5000"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.AutoMigrate(&Project{}, &Version{}, &PendingImage{}, &Job{}, &InputFile{}, &EnvVar{}, &Secret{}, &SpiderPolicy{}, &Outbox{}, &RegistryCredential{}, &Alias{}, &AliasChange{}, &TrustedKey{}, &Token{}, &User{}, &Team{}, &TeamMember{}, &ProjectRole{}, &AuditEntry{}); err != nil {
+		return nil, fmt.Errorf("auto migrate: %w", err)
+	}
+	// versions from before ingestion got a status were usable right away
+	db.Model(&Version{}).Where("status IS NULL OR status = ''").Update("status", "ready")
+	// jobs from before they got timestamps date from their version, the closest known time
+	if err := db.Exec("UPDATE jobs SET created_at = COALESCE((SELECT created_at FROM versions WHERE versions.id = jobs.version_id), ?), "+
+		"updated_at = COALESCE(updated_at, ?) WHERE created_at IS NULL OR created_at <= ?", time.Now(), time.Now(), time.Time{}).Error; err != nil {
+		return nil, fmt.Errorf("backfill job timestamps: %w", err)
+	}
+	// nobody gets to rewrite history, not even through the database
+	for _, trigger := range []string{"UPDATE", "DELETE"} {
+		if err := db.Exec("CREATE TRIGGER IF NOT EXISTS audit_entries_no_" + strings.ToLower(trigger) +
+			" BEFORE " + trigger + " ON audit_entries BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END").Error; err != nil {
+			return nil, fmt.Errorf("protect the audit log: %w", err)
+		}
+	}
+	return db, nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenBackfillsJobTimestamps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Now().AddDate(0, 0, -30)
+	if err := db.Create(&Project{ID: "shop"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&Version{ID: "v1", ProjectID: "shop", Image: "shop:v1", CreatedAt: created}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// a row written before jobs had timestamps
+	if err := db.Exec("INSERT INTO jobs (id, project_id, version_id, status, spider) VALUES ('legacy', 'shop', 'v1', 'finished', 'items')").Error; err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+
+	if db, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	}()
+
+	var legacy Job
+	db.First(&legacy, "id = ?", "legacy")
+	if !legacy.CreatedAt.Equal(created) {
+		t.Fatalf("legacy job created at %s, want the version time %s", legacy.CreatedAt, created)
+	}
+	if legacy.UpdatedAt.IsZero() {
+		t.Fatal("legacy job has no update time")
+	}
+}
+
+func TestAuditEntriesAppendOnly(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+	entry := AuditEntry{Actor: "ann", Action: "ProjectDelete", Outcome: "success"}
+	if err := db.Create(&entry).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Model(&entry).Update("outcome", "error").Error; err == nil {
+		t.Fatal("the entry was updated")
+	}
+	if err := db.Exec("UPDATE audit_entries SET actor = 'bob'").Error; err == nil {
+		t.Fatal("the entries were updated")
+	}
+	if err := db.Delete(&entry).Error; err == nil {
+		t.Fatal("the entry was deleted")
+	}
+	if err := db.Exec("DELETE FROM audit_entries").Error; err == nil {
+		t.Fatal("the entries were deleted")
+	}
+
+	var stored AuditEntry
+	if err := db.First(&stored, entry.ID).Error; err != nil || stored.Actor != "ann" || stored.Outcome != "success" {
+		t.Fatalf("entry %+v, %v", stored, err)
+	}
+	// new entries still go in
+	if err := db.Create(&AuditEntry{Actor: "bob", Outcome: "denied"}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Token is an API token, only the hash of the secret is stored.
+type Token struct {
+	ID         string     `json:"id" gorm:"primaryKey"`
+	Name       string     `json:"name" gorm:"not null"`
+	UserID     string     `json:"user_id,omitempty" gorm:"index"` // owner, the token never exceeds the roles of its user
+	Hash       string     `json:"-" gorm:"uniqueIndex;not null"`
+	Scopes     []string   `json:"scopes" gorm:"serializer:json"`      // read, schedule, deploy or admin
+	ProjectIDs []string   `json:"project_ids" gorm:"serializer:json"` // projects the token is restricted to, empty for all
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
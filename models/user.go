@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+type User struct {
+	ID           string    `json:"id" gorm:"primaryKey"`
+	Name         string    `json:"name" gorm:"uniqueIndex;not null"`
+	PasswordHash []byte    `json:"-" gorm:"not null"` // bcrypt
+	Admin        bool      `json:"admin"`             // admin of the whole daemon, bypasses project roles
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type Team struct {
+	Name      string    `json:"name" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Members []TeamMember `json:"members" gorm:"foreignKey:TeamName;constraint:OnDelete:CASCADE;"`
+}
+
+type TeamMember struct {
+	TeamName  string    `json:"team_name" gorm:"primaryKey"`
+	UserID    string    `json:"user_id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ProjectRole grants a user, or every member of a team, a role on the project
+type ProjectRole struct {
+	ProjectID   string    `json:"project_id" gorm:"primaryKey"`
+	SubjectType string    `json:"subject_type" gorm:"primaryKey"` // user or team
+	SubjectID   string    `json:"subject_id" gorm:"primaryKey"`   // user ID or team name
+	Role        string    `json:"role" gorm:"not null"`           // viewer, operator, deployer or owner
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -1,14 +1,51 @@
 package models
 
-import "time"
+import (
+	"gorm.io/gorm"
+	"time"
+)
 
 type Version struct {
-	ID        string    `json:"id" gorm:"primaryKey"`
-	Image     string    `json:"image" gorm:"not null"`
-	Spiders   []string  `json:"spiders" gorm:"serializer:json"`
-	ProjectID string    `json:"project_id" gorm:"not null"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              string                `json:"id" gorm:"primaryKey"`
+	Image           string                `json:"image" gorm:"not null"`
+	Spiders         []string              `json:"spiders" gorm:"serializer:json"`
+	ProjectID       string                `json:"project_id" gorm:"not null"`
+	Source          string                `json:"source"`                          // tar, registry, source or egg, imports keep the source of the original
+	Reference       string                `json:"reference,omitempty"`             // image reference the version was pulled from
+	Digest          string                `json:"digest,omitempty"`                // digest the reference resolved to
+	UploadDigest    string                `json:"upload_digest,omitempty"`         // sha256 of the uploaded image tar, checked before loading
+	SignedBy        string                `json:"signed_by,omitempty"`             // trusted key the image tar signature was verified with
+	ImportedFrom    string                `json:"imported_from,omitempty"`         // node the version was exported from, source, reference and digest describe the original there
+	ImportedID      string                `json:"imported_id,omitempty"`           // ID of the version on that node
+	ImportedSigner  string                `json:"imported_signer,omitempty"`       // signer of the original as the export claims it, unverified here
+	ImageID         string                `json:"image_id,omitempty" gorm:"index"` // content addressed image ID, shared images are reference counted on it
+	Status          string                `json:"status"`                          // uploading, loading, pulling, building, inspecting, ready or failed
+	Progress        int                   `json:"progress"`                        // percent of the current status done
+	Error           string                `json:"error,omitempty"`
+	InspectExitCode int64                 `json:"inspect_exit_code"`
+	InspectLog      string                `json:"inspect_log,omitempty"` // stderr of the last inspection
+	ScrapyVersion   string                `json:"scrapy_version,omitempty"`
+	PythonVersion   string                `json:"python_version,omitempty"`
+	Settings        map[string]any        `json:"settings,omitempty" gorm:"serializer:json"` // resolved values of the key project settings
+	SpiderMeta      map[string]SpiderMeta `json:"spider_meta,omitempty" gorm:"serializer:json"`
+	Dependencies    []string              `json:"dependencies,omitempty" gorm:"serializer:json"` // pip freeze of the image
+	CreatedAt       time.Time             `json:"created_at"`
+	UpdatedAt       time.Time             `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt        `json:"deleted_at,omitempty" gorm:"index"` // deleted versions stay for the job history
 
 	Jobs []Job `json:"jobs,omitempty" gorm:"foreignKey:VersionID;constraint:OnDelete:CASCADE;"`
 }
+
+// PendingImage is the image of a deleted version that job containers still used, retention
+// removes it once they're gone. It isn't tied to the version so that it outlives its project.
+type PendingImage struct {
+	Image     string    `json:"image" gorm:"primaryKey"`
+	ImageID   string    `json:"image_id,omitempty"`
+	VersionID string    `json:"version_id"` // the deleted version that left it behind
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type SpiderMeta struct {
+	CustomSettings map[string]any `json:"custom_settings,omitempty"`
+	AllowedDomains []string       `json:"allowed_domains,omitempty"`
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"scrapyd/api/errs"
+	"scrapyd/models"
+)
+
+// AliasMove points the alias at the version and records the change, all in one transaction.
+// Rollbacks undo the latest promotion not undone yet, so that repeated rollbacks walk back
+// through the history of the alias.
+func AliasMove(projectID string, name string, versionID string, action string) (*models.Alias, error) {
+	var alias models.Alias
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.First(&alias, "project_id = ? AND name = ?", projectID, name).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if action == "rollback" {
+				return errs.ErrAliasNotFound
+			}
+			// job creation takes the version of that ID, the alias would never be used
+			if err := tx.First(&models.Version{}, "id = ? AND project_id = ?", name, projectID).Error; err == nil {
+				return errs.ErrAliasNameTaken
+			}
+			alias = models.Alias{ProjectID: projectID, Name: name}
+		} else if err != nil {
+			return err
+		}
+
+		if action == "rollback" {
+			previous, err := aliasRollbackTarget(tx, projectID, name)
+			if err != nil {
+				return err
+			}
+			versionID = previous
+		}
+
+		var version models.Version
+		if err := tx.First(&version, "id = ? AND project_id = ?", versionID, projectID).Error; err != nil {
+			return errs.ErrVersionNotFound
+		}
+		if version.Status != "ready" {
+			return errs.ErrVersionNotReady
+		}
+
+		change := models.AliasChange{
+			ProjectID:     projectID,
+			Name:          name,
+			Action:        action,
+			FromVersionID: alias.VersionID,
+			ToVersionID:   versionID,
+		}
+		alias.PreviousVersionID = alias.VersionID
+		alias.VersionID = versionID
+
+		if err := tx.Save(&alias).Error; err != nil {
+			return err
+		}
+		return tx.Create(&change).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &alias, nil
+}
+
+// aliasRollbackTarget finds the version the alias pointed at before its latest promotion
+// that no rollback undid yet. Every rollback undoes one promotion, newest first.
+func aliasRollbackTarget(tx *gorm.DB, projectID string, name string) (string, error) {
+	var changes []models.AliasChange
+	if err := tx.Order("id DESC").Find(&changes, "project_id = ? AND name = ?", projectID, name).Error; err != nil {
+		return "", err
+	}
+
+	undone := 0
+	for _, change := range changes {
+		if change.Action == "rollback" {
+			undone++
+			continue
+		}
+		if undone > 0 {
+			undone--
+			continue
+		}
+		if change.FromVersionID == "" {
+			break
+		}
+		return change.FromVersionID, nil
+	}
+	return "", errs.ErrAliasNoPrevious
+}
+
+// AliasResolve returns the version the alias currently points at.
+func AliasResolve(projectID string, name string) (*models.Version, error) {
+	var alias models.Alias
+	var version models.Version
+
+	if err := models.DB.First(&alias, "project_id = ? AND name = ?", projectID, name).Error; err != nil {
+		return nil, errs.ErrAliasNotFound
+	}
+	if err := models.DB.First(&version, "id = ?", alias.VersionID).Error; err != nil {
+		return nil, errs.ErrVersionNotFound
+	}
+
+	return &version, nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"errors"
+	"scrapyd/api/errs"
+	"scrapyd/models"
+	"scrapyd/testutil"
+	"testing"
+)
+
+func setupAliases(t *testing.T) {
+	t.Helper()
+	testutil.Setup(t)
+	testutil.Create(t, &models.Project{ID: "shop"}, &models.Project{ID: "blog"})
+	for _, id := range []string{"v1", "v2", "v3", "v4"} {
+		testutil.Create(t, &models.Version{ID: id, ProjectID: "shop", Image: "shop:" + id, Status: "ready"})
+	}
+	testutil.Create(t,
+		&models.Version{ID: "v5", ProjectID: "shop", Image: "shop:v5", Status: "building"},
+		&models.Version{ID: "b1", ProjectID: "blog", Image: "blog:b1", Status: "ready"},
+	)
+}
+
+func TestAliasMove(t *testing.T) {
+	setupAliases(t)
+
+	steps := []struct {
+		action    string
+		versionID string
+		want      string
+		err       error
+	}{
+		{action: "rollback", err: errs.ErrAliasNotFound},
+		{action: "promote", versionID: "v1", want: "v1"},
+		{action: "rollback", err: errs.ErrAliasNoPrevious},
+		{action: "promote", versionID: "v2", want: "v2"},
+		{action: "promote", versionID: "v3", want: "v3"},
+		{action: "rollback", want: "v2"},
+		// rolling back again keeps going back instead of undoing the rollback
+		{action: "rollback", want: "v1"},
+		{action: "rollback", err: errs.ErrAliasNoPrevious},
+		{action: "promote", versionID: "v4", want: "v4"},
+		{action: "rollback", want: "v1"},
+		{action: "promote", versionID: "v5", err: errs.ErrVersionNotReady},
+		{action: "promote", versionID: "b1", err: errs.ErrVersionNotFound},
+		{action: "promote", versionID: "missing", err: errs.ErrVersionNotFound},
+	}
+	for i, step := range steps {
+		alias, err := AliasMove("shop", "prod", step.versionID, step.action)
+		if !errors.Is(err, step.err) {
+			t.Fatalf("step %d %s %s: err %v, want %v", i, step.action, step.versionID, err, step.err)
+		}
+		if err == nil && alias.VersionID != step.want {
+			t.Fatalf("step %d %s %s: alias at %s, want %s", i, step.action, step.versionID, alias.VersionID, step.want)
+		}
+	}
+
+	var changes []models.AliasChange
+	models.DB.Order("id").Find(&changes, "project_id = ? AND name = ?", "shop", "prod")
+	want := []struct{ action, from, to string }{
+		{"promote", "", "v1"}, {"promote", "v1", "v2"}, {"promote", "v2", "v3"},
+		{"rollback", "v3", "v2"}, {"rollback", "v2", "v1"}, {"promote", "v1", "v4"}, {"rollback", "v4", "v1"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("%d changes recorded, want %d", len(changes), len(want))
+	}
+	for i, change := range changes {
+		if change.Action != want[i].action || change.FromVersionID != want[i].from || change.ToVersionID != want[i].to {
+			t.Errorf("change %d: %s %s -> %s, want %v", i, change.Action, change.FromVersionID, change.ToVersionID, want[i])
+		}
+	}
+}
+
+func TestAliasMoveNameTaken(t *testing.T) {
+	setupAliases(t)
+
+	if _, err := AliasMove("shop", "v2", "v1", "promote"); !errors.Is(err, errs.ErrAliasNameTaken) {
+		t.Fatalf("err %v", err)
+	}
+	// versions of other projects don't shadow the alias
+	if _, err := AliasMove("shop", "b1", "v1", "promote"); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := AliasResolve("shop", "b1"); err != nil || version.ID != "v1" {
+		t.Fatalf("resolved %v, %v", version, err)
+	}
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"golang.org/x/crypto/bcrypt"
+	"scrapyd/api/errs"
+	"scrapyd/config"
+	"scrapyd/models"
+	"slices"
+	"time"
+)
+
+// Scopes from least to most privileged. Every scope implies read and admin implies all of them.
+var Scopes = []string{"read", "schedule", "deploy", "admin"}
+
+// RoleScopes are the scopes each project role grants, owners may do anything to their project.
+var RoleScopes = map[string][]string{
+	"viewer":   {"read"},
+	"operator": {"read", "schedule"},
+	"deployer": {"read", "schedule", "deploy"},
+	"owner":    {"read", "schedule", "deploy", "admin"},
+}
+
+// Principal is the authenticated caller of a request: a token, a user, or a token of a user,
+// in which case both the token scopes and the user roles have to allow an action.
+type Principal struct {
+	Name       string
+	TokenID    string
+	Scopes     []string // nil for users logged in with their password
+	ProjectIDs []string // projects the token is restricted to, empty for all
+
+	UserID string
+	Admin  bool              // the user is an admin of the whole daemon
+	Roles  map[string]string // project ID to the role of the user, through the user or its teams
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	if p.Scopes == nil {
+		return p.userAllows(scope, "")
+	}
+	if !slices.Contains(p.Scopes, "admin") && !slices.Contains(p.Scopes, scope) && (scope != "read" || len(p.Scopes) == 0) {
+		return false
+	}
+	return p.userAllows(scope, "")
+}
+
+// Allows checks the scope on the project, an empty project only checks the scope.
+func (p *Principal) Allows(scope string, projectID string) bool {
+	if !p.HasScope(scope) {
+		return false
+	}
+	if projectID != "" && len(p.ProjectIDs) > 0 && !slices.Contains(p.ProjectIDs, projectID) {
+		return false
+	}
+	return p.userAllows(scope, projectID)
+}
+
+// userAllows checks the roles of the user, an empty project checks for the scope on any project.
+func (p *Principal) userAllows(scope string, projectID string) bool {
+	if p.UserID == "" || p.Admin {
+		return true
+	}
+	if projectID != "" {
+		return slices.Contains(RoleScopes[p.Roles[projectID]], scope)
+	}
+	for _, role := range p.Roles {
+		if slices.Contains(RoleScopes[role], scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanCreateProject checks whether the principal may create the project. Nobody holds a role on
+// a project that doesn't exist yet, users may create projects they then own, tokens need admin.
+func (p *Principal) CanCreateProject(projectID string) bool {
+	if p.Scopes != nil && !slices.Contains(p.Scopes, "admin") {
+		return false
+	}
+	return len(p.ProjectIDs) == 0 || slices.Contains(p.ProjectIDs, projectID)
+}
+
+// IsAdmin is an admin of the whole daemon, not only of some projects.
+func (p *Principal) IsAdmin() bool {
+	return p.HasScope("admin") && len(p.ProjectIDs) == 0 && (p.UserID == "" || p.Admin)
+}
+
+// Projects lists the projects the principal holds the scope on, unless it holds it on all of them.
+func (p *Principal) Projects(scope string) ([]string, bool) {
+	if !p.HasScope(scope) {
+		return []string{}, false
+	}
+	if p.UserID == "" || p.Admin {
+		return p.ProjectIDs, len(p.ProjectIDs) == 0
+	}
+
+	projectIDs := []string{}
+	for projectID, role := range p.Roles {
+		if !slices.Contains(RoleScopes[role], scope) {
+			continue
+		}
+		if len(p.ProjectIDs) == 0 || slices.Contains(p.ProjectIDs, projectID) {
+			projectIDs = append(projectIDs, projectID)
+		}
+	}
+	slices.Sort(projectIDs)
+	return projectIDs, false
+}
+
+func TokenHash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenGenerate returns a new token secret, shown once to its creator, along with its hash.
+func TokenGenerate() (string, string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	secret := "scrapyd_" + hex.EncodeToString(raw)
+	return secret, TokenHash(secret), nil
+}
+
+func PasswordHash(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+// UserRoles collects the project roles of the user, given directly or through its teams,
+// keeping the highest one per project.
+func UserRoles(userID string) map[string]string {
+	var teams []string
+	models.DB.Model(&models.TeamMember{}).Where("user_id = ?", userID).Pluck("team_name", &teams)
+
+	var grants []models.ProjectRole
+	models.DB.Where("subject_type = ? AND subject_id = ?", "user", userID).
+		Or("subject_type = ? AND subject_id IN ?", "team", teams).
+		Find(&grants)
+
+	roles := make(map[string]string)
+	for _, grant := range grants {
+		if len(RoleScopes[grant.Role]) > len(RoleScopes[roles[grant.ProjectID]]) {
+			roles[grant.ProjectID] = grant.Role
+		}
+	}
+	return roles
+}
+
+func userPrincipal(user *models.User, principal *Principal) *Principal {
+	principal.UserID = user.ID
+	principal.Admin = user.Admin
+	principal.Roles = UserRoles(user.ID)
+	return principal
+}
+
+// Authenticate resolves the token secret into its principal. The bootstrap admin token from
+// SCRAPYD_ADMIN_TOKEN is not stored and always has full access.
+func Authenticate(secret string) (*Principal, error) {
+	if secret == "" {
+		return nil, errs.ErrUnauthorized
+	}
+	if config.AdminToken != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(config.AdminToken)) == 1 {
+		return &Principal{Name: "bootstrap", Scopes: []string{"admin"}}, nil
+	}
+
+	var token models.Token
+	if err := models.DB.First(&token, "hash = ? AND revoked_at IS NULL", TokenHash(secret)).Error; err != nil {
+		return nil, errs.ErrUnauthorized
+	}
+	models.DB.Model(&token).UpdateColumn("last_used_at", time.Now())
+
+	principal := &Principal{
+		Name:       token.Name,
+		TokenID:    token.ID,
+		Scopes:     token.Scopes,
+		ProjectIDs: token.ProjectIDs,
+	}
+	if token.UserID == "" {
+		return principal, nil
+	}
+
+	var user models.User
+	if err := models.DB.First(&user, "id = ?", token.UserID).Error; err != nil {
+		return nil, errs.ErrUnauthorized
+	}
+	return userPrincipal(&user, principal), nil
+}
+
+// AuthenticatePassword logs the user in, the roles of the user apply unrestricted by scopes.
+func AuthenticatePassword(name string, password string) (*Principal, error) {
+	var user models.User
+	if err := models.DB.First(&user, "name = ?", name).Error; err != nil {
+		return nil, errs.ErrUnauthorized
+	}
+	if bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(password)) != nil {
+		return nil, errs.ErrUnauthorized
+	}
+
+	return userPrincipal(&user, &Principal{Name: user.Name}), nil
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"errors"
+	"scrapyd/api/errs"
+	"scrapyd/config"
+	"scrapyd/models"
+	"scrapyd/testutil"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPrincipalAllows(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal Principal
+		scope     string
+		projectID string
+		want      bool
+	}{
+		{name: "admin token", principal: Principal{Scopes: []string{"admin"}}, scope: "deploy", projectID: "shop", want: true},
+		{name: "scope held", principal: Principal{Scopes: []string{"schedule"}}, scope: "schedule", projectID: "shop", want: true},
+		{name: "scope missing", principal: Principal{Scopes: []string{"schedule"}}, scope: "deploy", projectID: "shop"},
+		{name: "any scope reads", principal: Principal{Scopes: []string{"deploy"}}, scope: "read", want: true},
+		{name: "no scope", principal: Principal{Scopes: []string{}}, scope: "read"},
+		{name: "restricted project", principal: Principal{Scopes: []string{"admin"}, ProjectIDs: []string{"shop"}}, scope: "read", projectID: "shop", want: true},
+		{name: "other project", principal: Principal{Scopes: []string{"admin"}, ProjectIDs: []string{"shop"}}, scope: "read", projectID: "blog"},
+		{name: "restricted without project", principal: Principal{Scopes: []string{"admin"}, ProjectIDs: []string{"shop"}}, scope: "read", want: true},
+		{name: "user role", principal: Principal{UserID: "u1", Roles: map[string]string{"shop": "deployer"}}, scope: "deploy", projectID: "shop", want: true},
+		{name: "user role too low", principal: Principal{UserID: "u1", Roles: map[string]string{"shop": "viewer"}}, scope: "deploy", projectID: "shop"},
+		{name: "user without role", principal: Principal{UserID: "u1", Roles: map[string]string{"shop": "owner"}}, scope: "read", projectID: "blog"},
+		{name: "user admin", principal: Principal{UserID: "u1", Admin: true}, scope: "admin", projectID: "blog", want: true},
+		{name: "user token narrower than role", principal: Principal{Scopes: []string{"read"}, UserID: "u1", Roles: map[string]string{"shop": "owner"}}, scope: "deploy", projectID: "shop"},
+		{name: "user token broader than role", principal: Principal{Scopes: []string{"admin"}, UserID: "u1", Roles: map[string]string{"shop": "operator"}}, scope: "deploy", projectID: "shop"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.principal.Allows(tt.scope, tt.projectID); got != tt.want {
+				t.Fatalf("Allows(%q, %q) = %v, want %v", tt.scope, tt.projectID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrincipalHasScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal Principal
+		scope     string
+		want      bool
+	}{
+		{name: "token scope", principal: Principal{Scopes: []string{"deploy"}}, scope: "deploy", want: true},
+		{name: "admin token", principal: Principal{Scopes: []string{"admin"}}, scope: "schedule", want: true},
+		{name: "token without scope", principal: Principal{Scopes: []string{"read"}}, scope: "schedule"},
+		{name: "user role on some project", principal: Principal{UserID: "u1", Roles: map[string]string{"shop": "viewer", "blog": "operator"}}, scope: "schedule", want: true},
+		{name: "user role on no project", principal: Principal{UserID: "u1", Roles: map[string]string{"shop": "viewer"}}, scope: "schedule"},
+		{name: "user without roles", principal: Principal{UserID: "u1", Roles: map[string]string{}}, scope: "read"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.principal.HasScope(tt.scope); got != tt.want {
+				t.Fatalf("HasScope(%q) = %v, want %v", tt.scope, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrincipalProjects(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal Principal
+		scope     string
+		want      []string
+		wantAll   bool
+	}{
+		{name: "admin token", principal: Principal{Scopes: []string{"admin"}}, scope: "read", want: nil, wantAll: true},
+		{name: "restricted token", principal: Principal{Scopes: []string{"read"}, ProjectIDs: []string{"shop"}}, scope: "read", want: []string{"shop"}},
+		{name: "token without scope", principal: Principal{Scopes: []string{"read"}}, scope: "deploy", want: []string{}},
+		{name: "user roles", principal: Principal{UserID: "u1", Roles: map[string]string{"shop": "deployer", "blog": "viewer", "news": "owner"}}, scope: "deploy", want: []string{"news", "shop"}},
+		{name: "user token restricted", principal: Principal{Scopes: []string{"read"}, ProjectIDs: []string{"blog"}, UserID: "u1", Roles: map[string]string{"shop": "owner", "blog": "viewer"}}, scope: "read", want: []string{"blog"}},
+		{name: "user admin", principal: Principal{UserID: "u1", Admin: true}, scope: "admin", want: nil, wantAll: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, all := tt.principal.Projects(tt.scope)
+			if !slices.Equal(got, tt.want) || all != tt.wantAll {
+				t.Fatalf("Projects(%q) = %v, %v, want %v, %v", tt.scope, got, all, tt.want, tt.wantAll)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	testutil.Setup(t)
+	adminToken := config.AdminToken
+	config.AdminToken = "bootstrap-secret"
+	t.Cleanup(func() { config.AdminToken = adminToken })
+
+	revokedAt := time.Now()
+	testutil.Create(t,
+		&models.Project{ID: "shop"},
+		&models.User{ID: "u1", Name: "ann", PasswordHash: []byte("x")},
+		&models.ProjectRole{ProjectID: "shop", SubjectType: "user", SubjectID: "u1", Role: "operator"},
+		&models.Token{ID: "t1", Name: "ci", Hash: TokenHash("valid"), Scopes: []string{"deploy"}, ProjectIDs: []string{"shop"}},
+		&models.Token{ID: "t2", Name: "old", Hash: TokenHash("revoked"), Scopes: []string{"admin"}, RevokedAt: &revokedAt},
+		&models.Token{ID: "t3", Name: "ann", Hash: TokenHash("user"), Scopes: []string{"schedule"}, UserID: "u1"},
+	)
+
+	tests := []struct {
+		name   string
+		secret string
+		want   *Principal
+	}{
+		{name: "bootstrap", secret: "bootstrap-secret", want: &Principal{Name: "bootstrap", Scopes: []string{"admin"}}},
+		{name: "token", secret: "valid", want: &Principal{Name: "ci", TokenID: "t1", Scopes: []string{"deploy"}, ProjectIDs: []string{"shop"}}},
+		{name: "token of user", secret: "user", want: &Principal{Name: "ann", TokenID: "t3", Scopes: []string{"schedule"}, UserID: "u1", Roles: map[string]string{"shop": "operator"}}},
+		{name: "revoked", secret: "revoked"},
+		{name: "unknown", secret: "guess"},
+		{name: "empty", secret: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Authenticate(tt.secret)
+			if tt.want == nil {
+				if !errors.Is(err, errs.ErrUnauthorized) {
+					t.Fatalf("got %+v, %v, want ErrUnauthorized", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != tt.want.Name || got.TokenID != tt.want.TokenID || got.UserID != tt.want.UserID ||
+				!slices.Equal(got.Scopes, tt.want.Scopes) || !slices.Equal(got.ProjectIDs, tt.want.ProjectIDs) ||
+				got.Roles["shop"] != tt.want.Roles["shop"] {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if n := testutil.Count[models.Token](t, "id = ? AND last_used_at IS NOT NULL", "t1"); n != 1 {
+		t.Fatal("the use of the token was not recorded")
+	}
+}
+
+func TestAuthenticatePassword(t *testing.T) {
+	testutil.Setup(t)
+	hash, err := PasswordHash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.Create(t, &models.User{ID: "u1", Name: "ann", PasswordHash: hash})
+
+	p, err := AuthenticatePassword("ann", "secret")
+	if err != nil || p.UserID != "u1" || p.Scopes != nil {
+		t.Fatalf("got %+v, %v", p, err)
+	}
+	for _, credentials := range [][2]string{{"ann", "wrong"}, {"bob", "secret"}} {
+		if _, err := AuthenticatePassword(credentials[0], credentials[1]); !errors.Is(err, errs.ErrUnauthorized) {
+			t.Fatalf("%v: %v, want ErrUnauthorized", credentials, err)
+		}
+	}
+}
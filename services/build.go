@@ -0,0 +1,255 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"scrapyd/api/errs"
+	"scrapyd/config"
+	"scrapyd/models"
+	"strings"
+	"text/template"
+)
+
+// defaultDockerfile is used unless SCRAPYD_BUILD_DOCKERFILE points at a template of its own.
+const defaultDockerfile = `FROM {{.BaseImage}}
+WORKDIR /app
+COPY requirements.txt* ./
+RUN if [ -f requirements.txt ]; then pip install --no-cache-dir -r requirements.txt; fi
+RUN pip install --no-cache-dir scrapy
+COPY . .
+`
+
+var imageTagInvalid = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// BuildImageTag names the image built for a version. Image names are lowercase, so the tag ends
+// in a hash of the IDs as given, which tells apart IDs differing only in case or replaced characters.
+func BuildImageTag(version *models.Version) string {
+	repo := imageTagInvalid.ReplaceAllString(strings.ToLower(version.ProjectID), "-")
+	tag := imageTagInvalid.ReplaceAllString(strings.ToLower(version.ID), "-")
+	// tags are at most 128 characters
+	if len(tag) > 100 {
+		tag = tag[:100]
+	}
+	sum := sha256.Sum256([]byte(version.ProjectID + "\n" + version.ID))
+	tag = strings.TrimLeft(tag+"-"+hex.EncodeToString(sum[:6]), "-.")
+	return fmt.Sprintf("scrapyd/%s:%s", strings.Trim(repo, "-._"), tag)
+}
+
+func buildDir() (string, error) {
+	dir := filepath.Join(config.DataDir, "builds")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func BuildSourcePath(versionID string) string {
+	return filepath.Join(config.DataDir, "builds", versionID+".zip")
+}
+
+func BuildLogPath(versionID string) string {
+	return filepath.Join(config.DataDir, "builds", versionID+".log")
+}
+
+// BuildSourceStore validates the uploaded scrapy project and keeps it until the build task runs.
+func BuildSourceStore(versionID string, reader io.Reader) ([]byte, error) {
+	dir, err := buildDir()
+	if err != nil {
+		return nil, err
+	}
+
+	dest := filepath.Join(dir, versionID+".zip")
+	file, err := os.Create(dest)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, hasher), reader); err != nil {
+		os.Remove(dest)
+		return nil, err
+	}
+
+	archive, err := zip.OpenReader(dest)
+	if err != nil {
+		os.Remove(dest)
+		return nil, errs.ErrVersionSourceInvalid
+	}
+	defer archive.Close()
+
+	if _, ok := sourceRoot(&archive.Reader); !ok {
+		os.Remove(dest)
+		return nil, errs.ErrVersionSourceInvalid
+	}
+
+	return hasher.Sum(nil), nil
+}
+
+// sourceRoot finds the directory holding scrapy.cfg, zips often wrap the project in a folder.
+func sourceRoot(archive *zip.Reader) (string, bool) {
+	root, found := "", false
+	for _, file := range archive.File {
+		name := path.Clean(file.Name)
+		if path.Base(name) != "scrapy.cfg" {
+			continue
+		}
+		dir := path.Dir(name)
+		if dir == "." {
+			return "", true
+		}
+		if !found || len(dir) < len(root) {
+			root, found = dir+"/", true
+		}
+	}
+	return root, found
+}
+
+func buildDockerfile(baseImage string) ([]byte, error) {
+	text := defaultDockerfile
+	if config.BuildDockerfile != "" {
+		content, err := os.ReadFile(config.BuildDockerfile)
+		if err != nil {
+			return nil, err
+		}
+		text = string(content)
+	}
+
+	tmpl, err := template.New("Dockerfile").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, map[string]string{"BaseImage": baseImage}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// buildContext turns the project zip into a docker build context with the rendered Dockerfile.
+// The context is written as the build reads it, closing it stops the writing.
+func buildContext(zipPath string, dockerfile []byte) (io.ReadCloser, error) {
+	archive, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, errs.ErrVersionSourceInvalid
+	}
+
+	root, ok := sourceRoot(&archive.Reader)
+	if !ok {
+		archive.Close()
+		return nil, errs.ErrVersionSourceInvalid
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer archive.Close()
+		pw.CloseWithError(writeBuildContext(pw, &archive.Reader, root, dockerfile))
+	}()
+	return pr, nil
+}
+
+func writeBuildContext(w io.Writer, archive *zip.Reader, root string, dockerfile []byte) error {
+	tw := tar.NewWriter(w)
+	for _, file := range archive.File {
+		name := path.Clean(file.Name)
+		if !strings.HasPrefix(name, root) || file.FileInfo().IsDir() || name == root+"Dockerfile" {
+			continue
+		}
+		name = strings.TrimPrefix(name, root)
+		if strings.HasPrefix(name, "../") {
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = tw.WriteHeader(&tar.Header{
+			Name: name,
+			Mode: int64(file.Mode().Perm()),
+			Size: int64(file.UncompressedSize64),
+		})
+		if err == nil {
+			_, err = io.Copy(tw, reader)
+		}
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tw.WriteHeader(&tar.Header{Name: "Dockerfile", Mode: 0o644, Size: int64(len(dockerfile))}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(dockerfile); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// VersionBuild builds the version image from its uploaded source or egg, the build output goes to the build log.
+func VersionBuild(version *models.Version) error {
+	d, err := NewDaemon()
+	if err != nil {
+		return err
+	}
+	defer d.Client.Close()
+
+	if _, err := buildDir(); err != nil {
+		return err
+	}
+	logFile, err := os.Create(BuildLogPath(version.ID))
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	baseImage := config.BuildBaseImage
+	var project models.Project
+	if err := models.DB.First(&project, "id = ?", version.ProjectID).Error; err == nil && project.BaseImage != "" {
+		baseImage = project.BaseImage
+	}
+
+	sourcePath := BuildSourcePath(version.ID)
+	var buildCtx io.ReadCloser
+	if version.Source == "egg" {
+		sourcePath = BuildEggPath(version.ID)
+		var eggCtx io.Reader
+		eggCtx, err = eggContext(sourcePath, baseImage)
+		buildCtx = io.NopCloser(eggCtx)
+	} else {
+		var dockerfile []byte
+		dockerfile, err = buildDockerfile(baseImage)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("version", version.ID).
+				Msg("failed to render dockerfile")
+			return err
+		}
+		buildCtx, err = buildContext(sourcePath, dockerfile)
+	}
+	if err != nil {
+		return err
+	}
+	defer buildCtx.Close()
+
+	if err := d.ImageBuild(buildCtx, version.Image, logFile); err != nil {
+		fmt.Fprintf(logFile, "\nbuild failed: %s\n", err)
+		return err
+	}
+
+	os.Remove(sourcePath)
+	return nil
+}
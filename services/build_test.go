@@ -0,0 +1,90 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"github.com/distribution/reference"
+	"io"
+	"os"
+	"path/filepath"
+	"scrapyd/models"
+	"strings"
+	"testing"
+)
+
+func TestBuildImageTag(t *testing.T) {
+	versions := []models.Version{
+		{ProjectID: "shop", ID: "v1"},
+		{ProjectID: "shop", ID: "V1"},
+		{ProjectID: "Shop", ID: "v1"},
+		{ProjectID: "shop", ID: "v_1"},
+		{ProjectID: "shop", ID: "v.1"},
+		{ProjectID: "shop", ID: "-v1"},
+		{ProjectID: "shop", ID: strings.Repeat("v", 200)},
+	}
+	seen := map[string]string{}
+	for _, version := range versions {
+		tag := BuildImageTag(&version)
+		if _, err := reference.ParseNormalizedNamed(tag); err != nil {
+			t.Errorf("%s/%s: %q is not an image reference: %v", version.ProjectID, version.ID, tag, err)
+		}
+		if other, ok := seen[tag]; ok {
+			t.Errorf("%s/%s gets the tag %q of %s", version.ProjectID, version.ID, tag, other)
+		}
+		seen[tag] = version.ProjectID + "/" + version.ID
+		if again := BuildImageTag(&version); again != tag {
+			t.Errorf("tag %q changed to %q", tag, again)
+		}
+	}
+}
+
+func TestBuildContext(t *testing.T) {
+	zipPath := filepath.Join(t.TempDir(), "source.zip")
+	file, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := zip.NewWriter(file)
+	for name, content := range map[string]string{
+		"shop/scrapy.cfg":            "[settings]\ndefault = shop.settings\n",
+		"shop/shop/spiders/items.py": "import scrapy\n",
+		"shop/Dockerfile":            "FROM evil\n",
+		"other/readme.txt":           "outside the project\n",
+	} {
+		w, _ := archive.Create(name)
+		io.WriteString(w, content)
+	}
+	archive.Close()
+	file.Close()
+
+	buildCtx, err := buildContext(zipPath, []byte("FROM python\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buildCtx.Close()
+
+	files := map[string]string{}
+	tr := tar.NewReader(buildCtx)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(tr)
+		files[header.Name] = string(content)
+	}
+	if len(files) != 3 || files["Dockerfile"] != "FROM python\n" || files["shop/spiders/items.py"] == "" || files["scrapy.cfg"] == "" {
+		t.Fatalf("context files %v", files)
+	}
+}
+
+func TestBuildContextInvalid(t *testing.T) {
+	zipPath := filepath.Join(t.TempDir(), "source.zip")
+	os.WriteFile(zipPath, []byte("not a zip"), 0o644)
+	if _, err := buildContext(zipPath, nil); err == nil {
+		t.Fatal("invalid source accepted")
+	}
+}
@@ -7,11 +7,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/system"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/docker/pkg/namesgenerator"
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/rs/zerolog/log"
@@ -45,7 +50,7 @@ func NewDaemon() (*Daemon, error) {
 	}, nil
 }
 
-func (d *Daemon) ContainerCreate(containerName string, config *container.Config) (string, error) {
+func (d *Daemon) ContainerCreate(containerName string, config *container.Config, mounts []mount.Mount) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 360*time.Second)
 	defer cancel()
 
@@ -54,6 +59,7 @@ func (d *Daemon) ContainerCreate(containerName string, config *container.Config)
 		config,
 		&container.HostConfig{
 			RestartPolicy: container.RestartPolicy{Name: "no"},
+			Mounts:        mounts,
 			LogConfig: container.LogConfig{
 				Type: "json-file",
 				Config: map[string]string{
@@ -95,10 +101,7 @@ func (d *Daemon) ContainerStart(containerID string) error {
 	return nil
 }
 
-func (d *Daemon) ContainerWait(containerID string, cond container.WaitCondition) (int64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
+func (d *Daemon) ContainerWait(ctx context.Context, containerID string, cond container.WaitCondition) (int64, error) {
 	statusChan, errChan := d.Client.ContainerWait(
 		ctx,
 		containerID,
@@ -203,7 +206,7 @@ func (d *Daemon) FindContainerByName(containerName string) (*container.Summary,
 		log.Debug().
 			Str("container", containerName).
 			Msg("no container found")
-		return nil, errors.New("no container found")
+		return nil, errs.ErrContainerNotFound
 	}
 
 	result := containers[0]
@@ -233,16 +236,13 @@ func (d *Daemon) FindContainersByImageName(imageName string) ([]container.Summar
 		log.Debug().
 			Str("image", imageName).
 			Msg("no container found")
-		return nil, errors.New("no container found")
+		return nil, errs.ErrContainerNotFound
 	}
 
 	return containers, nil
 }
 
-func (d *Daemon) ImageLoad(reader io.Reader) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
-
+func (d *Daemon) ImageLoad(ctx context.Context, reader io.Reader) (string, error) {
 	loadResponse, err := d.Client.ImageLoad(ctx, reader)
 	if err != nil {
 		log.Error().
@@ -254,60 +254,233 @@ func (d *Daemon) ImageLoad(reader io.Reader) (string, error) {
 
 	type Line struct {
 		Stream string `json:"stream"` // stream is key in each line from docker response
+		Error  string `json:"error"`
 	}
 
 	scanner := bufio.NewScanner(loadResponse.Body)
 	for scanner.Scan() {
 		var line Line
 		json.Unmarshal(scanner.Bytes(), &line)
+		if line.Error != "" {
+			log.Error().
+				Str("error", line.Error).
+				Msg("failed to load image")
+			return "", errors.New(line.Error)
+		}
 		if strings.HasPrefix(line.Stream, "Loaded image:") {
 			imageName := strings.TrimSpace(strings.TrimPrefix(line.Stream, "Loaded image:"))
 			return imageName, nil
 		}
+		// untagged images are only reported by their ID
+		if strings.HasPrefix(line.Stream, "Loaded image ID:") {
+			imageID := strings.TrimSpace(strings.TrimPrefix(line.Stream, "Loaded image ID:"))
+			return imageID, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
 	}
 
 	return "", errs.ErrVersionImageTarInvalid
 }
 
-func (d *Daemon) ImageRemove(imageName string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+func (d *Daemon) ImagePull(ref string, registryAuth string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
 	defer cancel()
 
-	// find all running containers using image
-	containers, err := d.FindContainersByImageName(imageName)
+	reader, err := d.Client.ImagePull(ctx, ref, image.PullOptions{
+		RegistryAuth: registryAuth,
+	})
 	if err != nil {
+		log.Error().
+			Err(err).
+			Str("image", ref).
+			Msg("failed to pull image")
 		return err
 	}
-
-	for _, con := range containers {
-		if err := d.ContainerStop(con.ID); err != nil {
+	defer reader.Close()
+
+	// the pull only completes once the progress stream is drained, failures show up inside it
+	decoder := json.NewDecoder(reader)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := decoder.Decode(&msg); err == io.EOF {
+			break
+		} else if err != nil {
 			return err
 		}
-		if err := d.ContainerRemove(con.ID); err != nil {
-			return err
+		if msg.Error != nil {
+			log.Error().
+				Str("image", ref).
+				Str("error", msg.Error.Message).
+				Msg("failed to pull image")
+			return msg.Error
 		}
 	}
 
-	_, err = d.Client.ImageRemove(ctx, imageName, image.RemoveOptions{
-		Force:         true,
-		PruneChildren: true,
+	return nil
+}
+
+// ImageDigest resolves the repo digest the daemon recorded for the image reference.
+func (d *Daemon) ImageDigest(ref string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", err
+	}
+
+	inspect, err := d.Client.ImageInspect(ctx, ref)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("image", ref).
+			Msg("failed to inspect image")
+		return "", err
+	}
+
+	for _, repoDigest := range inspect.RepoDigests {
+		digested, err := reference.ParseNormalizedNamed(repoDigest)
+		if err != nil {
+			continue
+		}
+		if canonical, ok := digested.(reference.Canonical); ok && digested.Name() == named.Name() {
+			return canonical.Digest().String(), nil
+		}
+	}
+
+	return "", errors.New("no repo digest found for image")
+}
+
+// ImageBuild builds and tags the image, the build output is written to logs as it arrives.
+func (d *Daemon) ImageBuild(buildContext io.Reader, tag string, logs io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Minute)
+	defer cancel()
+
+	resp, err := d.Client.ImageBuild(ctx, buildContext, types.ImageBuildOptions{
+		Tags:        []string{tag},
+		Dockerfile:  "Dockerfile",
+		Remove:      true,
+		ForceRemove: true,
 	})
 	if err != nil {
+		log.Error().
+			Err(err).
+			Str("image", tag).
+			Msg("failed to build image")
 		return err
 	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := decoder.Decode(&msg); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if msg.Stream != "" {
+			io.WriteString(logs, msg.Stream)
+		} else if msg.Status != "" {
+			fmt.Fprintln(logs, msg.Status)
+		}
+		if msg.Error != nil {
+			log.Error().
+				Str("image", tag).
+				Str("error", msg.Error.Message).
+				Msg("failed to build image")
+			return msg.Error
+		}
+	}
 
 	return nil
 }
 
-func (d *Daemon) SpiderList(imageName string) ([]string, error) {
-	var spiders []string
+// ImageRemove removes the image, one that is already gone counts as removed.
+// An image still used by containers, like the ones kept for job logs, stays with ErrImageInUse.
+func (d *Daemon) ImageRemove(imageName string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	_, err := d.Client.ImageRemove(ctx, imageName, image.RemoveOptions{})
+	if errdefs.IsConflict(err) {
+		log.Warn().
+			Err(err).
+			Str("image", imageName).
+			Msg("image still in use, keeping it")
+		return errs.ErrImageInUse
+	}
+	if err != nil && !client.IsErrNotFound(err) {
+		log.Error().
+			Err(err).
+			Str("image", imageName).
+			Msg("failed to remove image")
+		return err
+	}
+
+	return nil
+}
+
+// ImageID resolves a reference to the content addressed ID of the image.
+func (d *Daemon) ImageID(ref string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	inspect, err := d.Client.ImageInspect(ctx, ref)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("image", ref).
+			Msg("failed to inspect image")
+		return "", err
+	}
+
+	return inspect.ID, nil
+}
+
+// ImageSave streams the image as a `docker save` tarball.
+func (d *Daemon) ImageSave(ctx context.Context, ref string) (io.ReadCloser, error) {
+	reader, err := d.Client.ImageSave(ctx, []string{ref})
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("image", ref).
+			Msg("failed to save image")
+		return nil, err
+	}
 
+	return reader, nil
+}
+
+// ImageSize returns the ID of the image along with its size on disk.
+func (d *Daemon) ImageSize(ref string) (string, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	inspect, err := d.Client.ImageInspect(ctx, ref)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("image", ref).
+			Msg("failed to inspect image")
+		return "", 0, err
+	}
+
+	return inspect.ID, inspect.Size, nil
+}
+
+type ContainerRunResult struct {
+	ExitCode int64
+	Stdout   string
+	Stderr   string
+}
+
+// ContainerRun runs a throwaway container to completion and collects its output.
+func (d *Daemon) ContainerRun(config *container.Config, timeout time.Duration) (*ContainerRunResult, error) {
 	contName := namesgenerator.GetRandomName(1)
-	containerID, err := d.ContainerCreate(contName, &container.Config{
-		Image:      imageName,
-		Entrypoint: []string{"scrapy"},
-		Cmd:        []string{"list"},
-	})
+	containerID, err := d.ContainerCreate(contName, config, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -320,38 +493,63 @@ func (d *Daemon) SpiderList(imageName string) ([]string, error) {
 		return nil, err
 	}
 
-	exitCode, err := d.ContainerWait(containerID, container.WaitConditionNotRunning)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	exitCode, err := d.ContainerWait(ctx, containerID, container.WaitConditionNotRunning)
 	if err != nil {
+		log.Error().
+			Err(err).
+			Str("container", containerID).
+			Msg("failed to wait for container")
 		return nil, err
 	}
-	if exitCode == 0 {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		reader, err := d.ContainerLogs(ctx, containerID, false)
-		defer reader.Close()
 
-		var stdout bytes.Buffer
-		if _, err = stdcopy.StdCopy(&stdout, io.Discard, reader); err != nil {
-			log.Error().
-				Err(err).
-				Str("container", containerID).
-				Msg("failed to read container logs")
-			return nil, err
-		}
-		logs := stdout.String()
+	reader, err := d.ContainerLogs(ctx, containerID, false)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
 
-		if logs == "" {
-			return nil, err
-		}
-		for _, spider := range strings.Split(logs, "\n") {
-			if strings.TrimSpace(spider) != "" {
-				spiders = append(spiders, spider)
-			}
-		}
-		return spiders, nil
+	var stdout, stderr bytes.Buffer
+	if _, err = stdcopy.StdCopy(&stdout, &stderr, reader); err != nil {
+		log.Error().
+			Err(err).
+			Str("container", containerID).
+			Msg("failed to read container logs")
+		return nil, err
+	}
+
+	return &ContainerRunResult{
+		ExitCode: exitCode,
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+	}, nil
+}
+
+// SpiderList runs `scrapy list` in the image. The run result is returned along with
+// errs.ErrVersionInspectFailed when the command exits non-zero.
+func (d *Daemon) SpiderList(imageName string, timeout time.Duration) ([]string, *ContainerRunResult, error) {
+	var spiders []string
+
+	result, err := d.ContainerRun(&container.Config{
+		Image:      imageName,
+		Entrypoint: []string{"scrapy"},
+		Cmd:        []string{"list"},
+	}, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	if result.ExitCode != 0 {
+		return nil, result, errs.ErrVersionInspectFailed
 	}
 
-	return spiders, nil
+	for _, spider := range strings.Split(result.Stdout, "\n") {
+		if strings.TrimSpace(spider) != "" {
+			spiders = append(spiders, strings.TrimSpace(spider))
+		}
+	}
+	return spiders, result, nil
 }
 
 func (d *Daemon) GetSystemInfo() (*system.Info, error) {
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"scrapyd/api/errs"
+	"scrapyd/config"
+	"strings"
+	"text/template"
+)
+
+// eggDockerfile installs the egg requirements and puts the egg on the python path, the
+// generated scrapy.cfg points scrapy at the settings module declared by the egg.
+const eggDockerfile = `FROM {{.BaseImage}}
+WORKDIR /app
+COPY requirements.txt ./
+RUN pip install --no-cache-dir -r requirements.txt scrapy
+COPY project.egg scrapy.cfg ./
+ENV PYTHONPATH=/app/project.egg
+`
+
+func BuildEggPath(versionID string) string {
+	return filepath.Join(config.DataDir, "builds", versionID+".egg")
+}
+
+// BuildEggStore validates the egg uploaded by scrapyd-deploy and keeps it until the build task runs.
+func BuildEggStore(versionID string, reader io.Reader) ([]byte, error) {
+	dir, err := buildDir()
+	if err != nil {
+		return nil, err
+	}
+
+	dest := filepath.Join(dir, versionID+".egg")
+	file, err := os.Create(dest)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, hasher), reader); err != nil {
+		os.Remove(dest)
+		return nil, err
+	}
+
+	archive, err := zip.OpenReader(dest)
+	if err != nil {
+		os.Remove(dest)
+		return nil, errs.ErrVersionEggInvalid
+	}
+	defer archive.Close()
+
+	if _, ok := eggSettingsModule(&archive.Reader); !ok {
+		os.Remove(dest)
+		return nil, errs.ErrVersionEggInvalid
+	}
+
+	return hasher.Sum(nil), nil
+}
+
+func eggFile(archive *zip.Reader, name string) ([]byte, bool) {
+	for _, file := range archive.File {
+		if file.Name != name {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return nil, false
+		}
+		defer reader.Close()
+		content, err := io.ReadAll(reader)
+		return content, err == nil
+	}
+	return nil, false
+}
+
+// eggSettingsModule reads `settings = ...` from the [scrapy] entry point scrapyd-deploy writes.
+func eggSettingsModule(archive *zip.Reader) (string, bool) {
+	content, ok := eggFile(archive, "EGG-INFO/entry_points.txt")
+	if !ok {
+		return "", false
+	}
+
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if section == "scrapy" && found && strings.TrimSpace(key) == "settings" && strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value), true
+		}
+	}
+	return "", false
+}
+
+// eggRequirements keeps the unconditional install_requires of the egg, extras sections are skipped.
+func eggRequirements(archive *zip.Reader) []byte {
+	content, _ := eggFile(archive, "EGG-INFO/requires.txt")
+
+	var buf bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			break
+		}
+		if line != "" {
+			fmt.Fprintln(&buf, line)
+		}
+	}
+	return buf.Bytes()
+}
+
+// eggContext builds the docker build context wrapping the egg.
+func eggContext(eggPath string, baseImage string) (io.Reader, error) {
+	egg, err := os.ReadFile(eggPath)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := zip.NewReader(bytes.NewReader(egg), int64(len(egg)))
+	if err != nil {
+		return nil, errs.ErrVersionEggInvalid
+	}
+	settings, ok := eggSettingsModule(archive)
+	if !ok {
+		return nil, errs.ErrVersionEggInvalid
+	}
+
+	tmpl, err := template.New("Dockerfile").Parse(eggDockerfile)
+	if err != nil {
+		return nil, err
+	}
+	var dockerfile bytes.Buffer
+	if err := tmpl.Execute(&dockerfile, map[string]string{"BaseImage": baseImage}); err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{"Dockerfile", dockerfile.Bytes()},
+		{"requirements.txt", eggRequirements(archive)},
+		{"scrapy.cfg", []byte(fmt.Sprintf("[settings]\ndefault = %s\n", settings))},
+		{"project.egg", egg},
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, file := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0o644, Size: int64(len(file.content))}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(file.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	return &buf, nil
+}
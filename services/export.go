@@ -0,0 +1,154 @@
+package services
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"scrapyd/api/errs"
+	"scrapyd/config"
+	"scrapyd/models"
+	"time"
+)
+
+// ExportMetaName is the file holding the version metadata in exported image tars,
+// `docker load` ignores it so exports stay loadable by hand.
+const ExportMetaName = "scrapyd-version.json"
+
+// exportMeta is the exported version along with the node it was exported from.
+type exportMeta struct {
+	models.Version
+	ExportedBy string `json:"exported_by,omitempty"`
+}
+
+// VersionExport streams the `docker save` output of the version image with the version
+// metadata appended. The save is started before returning, so a missing image is
+// reported before anything is written.
+func VersionExport(version *models.Version) (io.ReadCloser, error) {
+	d, err := NewDaemon()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ImageLoadTimeout)
+	saved, err := d.ImageSave(ctx, version.Image)
+	if err != nil {
+		cancel()
+		d.Client.Close()
+		return nil, err
+	}
+
+	meta, err := json.Marshal(exportMeta{Version: *version, ExportedBy: config.NodeName})
+	if err != nil {
+		cancel()
+		saved.Close()
+		d.Client.Close()
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer d.Client.Close()
+		defer cancel()
+		defer saved.Close()
+
+		err := exportTar(pw, saved, meta)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("version", version.ID).
+				Msg("failed to export version image")
+		}
+		pw.CloseWithError(err)
+	}()
+
+	return pr, nil
+}
+
+func exportTar(w io.Writer, saved io.Reader, meta []byte) error {
+	tr := tar.NewReader(saved)
+	tw := tar.NewWriter(w)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    ExportMetaName,
+		Mode:    0o644,
+		Size:    int64(len(meta)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(meta); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// VersionImport applies where the exported version came from to the version stored for the load task:
+// its source, reference, digest and the node and ID it had there. The ID and project come from the
+// upload, the image and its ID from loading it. The upload digest and signer stay the ones verified
+// on this node, the signer of the original is only kept as the claim of the export. The export can't
+// vouch for the spiders and metadata either, the image is inspected again like any other upload.
+func VersionImport(version *models.Version) error {
+	file, err := os.Open(VersionUploadPath(version.ID))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = bufio.NewReader(file)
+	if magic, _ := reader.(*bufio.Reader).Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return errs.ErrVersionExportInvalid
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			return errs.ErrVersionExportInvalid
+		}
+		if header.Name != ExportMetaName {
+			continue
+		}
+
+		var original exportMeta
+		if err := json.NewDecoder(tr).Decode(&original); err != nil {
+			return errs.ErrVersionExportInvalid
+		}
+
+		if original.Source != "" {
+			version.Source = original.Source
+		}
+		version.Reference = original.Reference
+		version.Digest = original.Digest
+		version.ImportedSigner = original.SignedBy
+		version.ImportedFrom = original.ExportedBy
+		version.ImportedID = original.ID
+		version.CreatedAt = original.CreatedAt
+		return nil
+	}
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"scrapyd/api/errs"
+	"scrapyd/config"
+	"scrapyd/models"
+	"sort"
+	"strings"
+)
+
+// InputMountDir is where input files show up inside job containers,
+// exposed to spiders through the SCRAPYD_INPUT_DIR env var.
+const InputMountDir = "/scrapyd/inputs"
+
+func inputStoreDir() (string, error) {
+	dir, err := filepath.Abs(filepath.Join(config.DataDir, "inputs"))
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// InputName is the file name the input gets mounted under, without any directory.
+func InputName(name string) (string, error) {
+	name = filepath.Base(filepath.Clean("/" + name))
+	if name == "/" || name == "." {
+		return "", errs.ErrInputInvalid
+	}
+	return name, nil
+}
+
+// InputStore saves the content into the content addressed input store and returns
+// the (not yet persisted) input file record pointing at it.
+func InputStore(projectID string, name string, reader io.Reader) (*models.InputFile, error) {
+	name, err := InputName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := inputStoreDir()
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("failed to prepare input store")
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(dir, "upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), reader)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("input", name).
+			Msg("failed to store input file")
+		return nil, err
+	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+
+	dest := filepath.Join(dir, hash)
+	if _, err := os.Stat(dest); os.IsNotExist(err) {
+		// temp files are private, the job containers read the blob as another user
+		if err := tmp.Chmod(0o644); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(tmp.Name(), dest); err != nil {
+			return nil, err
+		}
+	}
+
+	reqID, _ := uuid.NewUUID()
+	return &models.InputFile{
+		ID:        strings.ReplaceAll(reqID.String(), "-", ""),
+		ProjectID: projectID,
+		Name:      name,
+		Hash:      hash,
+		Size:      size,
+		Path:      dest,
+	}, nil
+}
+
+// InputCleanup removes the stored content once no other input file references it.
+func InputCleanup(input *models.InputFile) error {
+	var refs int64
+	models.DB.Model(&models.InputFile{}).Where("hash = ? AND id <> ?", input.Hash, input.ID).Count(&refs)
+
+	return removeInputBlob(input, refs)
+}
+
+func removeInputBlob(input *models.InputFile, refs int64) error {
+	if refs > 0 {
+		return nil
+	}
+
+	if err := os.Remove(input.Path); err != nil && !os.IsNotExist(err) {
+		log.Error().
+			Err(err).
+			Str("input", input.ID).
+			Msg("failed to remove input file")
+		return err
+	}
+
+	return nil
+}
+
+// InputHash fingerprints a set of inputs, independent of their order.
+func InputHash(inputs []models.InputFile) string {
+	if len(inputs) == 0 {
+		return ""
+	}
+
+	lines := make([]string, 0, len(inputs))
+	for _, input := range inputs {
+		lines = append(lines, fmt.Sprintf("%s:%s", input.Name, input.Hash))
+	}
+	sort.Strings(lines)
+
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// InputMounts resolves the job inputs into read-only bind mounts.
+func InputMounts(job *models.Job) ([]mount.Mount, error) {
+	if len(job.Inputs) == 0 {
+		return nil, nil
+	}
+
+	var inputs []models.InputFile
+	if err := models.DB.Find(&inputs, "id IN ? AND project_id = ?", job.Inputs, job.ProjectID).Error; err != nil {
+		return nil, err
+	}
+	if len(inputs) != len(job.Inputs) {
+		return nil, errs.ErrInputNotFound
+	}
+	if hash := InputHash(inputs); hash != job.InputHash {
+		log.Error().
+			Str("job", job.ID).
+			Str("expected", job.InputHash).
+			Str("actual", hash).
+			Msg("job inputs changed since scheduling")
+		return nil, errs.ErrInputInvalid
+	}
+
+	mounts := make([]mount.Mount, 0, len(inputs))
+	for _, input := range inputs {
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   input.Path,
+			Target:   path.Join(InputMountDir, input.Name),
+			ReadOnly: true,
+		})
+	}
+
+	return mounts, nil
+}
@@ -0,0 +1,25 @@
+package services
+
+import (
+	"os"
+	"scrapyd/testutil"
+	"strings"
+	"testing"
+)
+
+func TestInputStoreReadable(t *testing.T) {
+	testutil.Setup(t)
+
+	input, err := InputStore("shop", "urls.txt", strings.NewReader("https://example.com\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(input.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// job containers don't run as the server's user
+	if mode := info.Mode().Perm(); mode != 0o644 {
+		t.Fatalf("mode %o, want 644", mode)
+	}
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"maps"
+	"scrapyd/api/errs"
+	"scrapyd/api/types"
+	"scrapyd/models"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IntrospectSettings are the project settings recorded for every version.
+var IntrospectSettings = []string{
+	"BOT_NAME",
+	"USER_AGENT",
+	"ROBOTSTXT_OBEY",
+	"CONCURRENT_REQUESTS",
+	"CONCURRENT_REQUESTS_PER_DOMAIN",
+	"DOWNLOAD_DELAY",
+	"DOWNLOAD_TIMEOUT",
+	"AUTOTHROTTLE_ENABLED",
+	"HTTPCACHE_ENABLED",
+	"RETRY_TIMES",
+	"LOG_LEVEL",
+	"FEEDS",
+	"ITEM_PIPELINES",
+	"DOWNLOADER_MIDDLEWARES",
+	"SPIDER_MIDDLEWARES",
+	"EXTENSIONS",
+}
+
+// introspectScript prints the project metadata as a single JSON document, the
+// setting names to resolve are passed as arguments.
+const introspectScript = `
+import json, platform, subprocess, sys
+import scrapy
+from scrapy.spiderloader import SpiderLoader
+from scrapy.utils.project import get_project_settings
+
+def plain(value):
+    if hasattr(value, "copy_to_dict"):
+        return value.copy_to_dict()
+    return value
+
+settings = get_project_settings()
+loader = SpiderLoader.from_settings(settings)
+spiders = {}
+for name in loader.list():
+    spider = loader.load(name)
+    spiders[name] = {
+        "custom_settings": dict(getattr(spider, "custom_settings", None) or {}),
+        "allowed_domains": list(getattr(spider, "allowed_domains", None) or []),
+    }
+
+freeze = subprocess.run([sys.executable, "-m", "pip", "freeze"], capture_output=True, text=True)
+print(json.dumps({
+    "scrapy_version": scrapy.__version__,
+    "python_version": platform.python_version(),
+    "settings": {key: plain(settings.get(key)) for key in sys.argv[1:]},
+    "spiders": spiders,
+    "dependencies": freeze.stdout.splitlines(),
+}, default=str))
+`
+
+type Introspection struct {
+	ScrapyVersion string                       `json:"scrapy_version"`
+	PythonVersion string                       `json:"python_version"`
+	Settings      map[string]any               `json:"settings"`
+	Spiders       map[string]models.SpiderMeta `json:"spiders"`
+	Dependencies  []string                     `json:"dependencies"`
+}
+
+// Introspect collects the scrapy and python versions, settings, spider metadata and
+// dependencies of the image. Like SpiderList the run result comes back with
+// errs.ErrVersionInspectFailed when the script exits non-zero.
+func (d *Daemon) Introspect(imageName string, timeout time.Duration) (*Introspection, *ContainerRunResult, error) {
+	result, err := d.ContainerRun(&container.Config{
+		Image:      imageName,
+		Entrypoint: []string{"python", "-c", introspectScript},
+		Cmd:        IntrospectSettings,
+	}, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	if result.ExitCode != 0 {
+		return nil, result, errs.ErrVersionInspectFailed
+	}
+
+	// the project may print on import, the document is the last line
+	lines := strings.Split(strings.TrimSpace(result.Stdout), "\n")
+	var introspection Introspection
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &introspection); err != nil {
+		return nil, result, fmt.Errorf("%w: %v", errs.ErrVersionInspectFailed, err)
+	}
+
+	return &introspection, result, nil
+}
+
+// VersionCompare lists the spider, setting and dependency changes going from one version to the other.
+func VersionCompare(from *models.Version, to *models.Version) *types.VersionDiff {
+	diff := &types.VersionDiff{
+		From:           from.ID,
+		To:             to.ID,
+		Spiders:        setDiff(from.Spiders, to.Spiders),
+		Settings:       mapDiff(from.Settings, to.Settings),
+		SpiderSettings: make(map[string][]types.Change),
+		Dependencies:   mapDiff(requirements(from.Dependencies), requirements(to.Dependencies)),
+	}
+	if from.ScrapyVersion != to.ScrapyVersion {
+		diff.ScrapyVersion = &types.Change{Name: "scrapy", From: from.ScrapyVersion, To: to.ScrapyVersion}
+	}
+	if from.PythonVersion != to.PythonVersion {
+		diff.PythonVersion = &types.Change{Name: "python", From: from.PythonVersion, To: to.PythonVersion}
+	}
+
+	for name, before := range from.SpiderMeta {
+		after, ok := to.SpiderMeta[name]
+		if !ok {
+			continue
+		}
+		changes := mapDiff(before.CustomSettings, after.CustomSettings)
+		if !slices.Equal(sorted(before.AllowedDomains), sorted(after.AllowedDomains)) {
+			changes = append(changes, types.Change{Name: "allowed_domains", From: before.AllowedDomains, To: after.AllowedDomains})
+		}
+		if len(changes) > 0 {
+			diff.SpiderSettings[name] = changes
+		}
+	}
+
+	return diff
+}
+
+func setDiff(from []string, to []string) types.SetDiff {
+	diff := types.SetDiff{Added: []string{}, Removed: []string{}}
+	for _, name := range to {
+		if !slices.Contains(from, name) {
+			diff.Added = append(diff.Added, name)
+		}
+	}
+	for _, name := range from {
+		if !slices.Contains(to, name) {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	return diff
+}
+
+// mapDiff compares the values by their JSON encoding, they come from decoded JSON anyway.
+func mapDiff[V any](from map[string]V, to map[string]V) []types.Change {
+	names := make(map[string]bool)
+	for name := range from {
+		names[name] = true
+	}
+	for name := range to {
+		names[name] = true
+	}
+
+	changes := []types.Change{}
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		before, inFrom := from[name]
+		after, inTo := to[name]
+		change := types.Change{Name: name}
+		if inFrom {
+			change.From = before
+		}
+		if inTo {
+			change.To = after
+		}
+		a, _ := json.Marshal(change.From)
+		b, _ := json.Marshal(change.To)
+		if string(a) != string(b) {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// requirements maps the pip freeze lines to package name and pinned version.
+func requirements(lines []string) map[string]string {
+	result := make(map[string]string)
+	for _, line := range lines {
+		name, version, found := strings.Cut(line, "==")
+		if !found {
+			name, version, _ = strings.Cut(line, " @ ")
+		}
+		result[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(version)
+	}
+	return result
+}
+
+func sorted(values []string) []string {
+	values = slices.Clone(values)
+	sort.Strings(values)
+	return values
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// introspectStubs stands in for scrapy and pip, enough for the introspection script to run.
+var introspectStubs = map[string]string{
+	"scrapy/__init__.py":       `__version__ = "2.11.2"`,
+	"scrapy/spiderloader.py":   "class SpiderLoader:\n    @classmethod\n    def from_settings(cls, settings):\n        return cls()\n    def list(self):\n        return []\n",
+	"scrapy/utils/__init__.py": "",
+	"scrapy/utils/project.py":  "def get_project_settings():\n    return {\"BOT_NAME\": \"shop\"}\n",
+	"pip/__init__.py":          "",
+	"pip/__main__.py":          "print(\"shop @ file:///src/shop spiders\")\nprint(\"scrapy==2.11.2\")\n",
+}
+
+func TestIntrospectScriptDependencies(t *testing.T) {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 is not available")
+	}
+	dir := t.TempDir()
+	for name, content := range introspectStubs {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(python, "-c", introspectScript, "BOT_NAME")
+	cmd.Env = append(os.Environ(), "PYTHONPATH="+dir)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	var introspection Introspection
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &introspection); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"shop @ file:///src/shop spiders", "scrapy==2.11.2"}
+	if !slices.Equal(introspection.Dependencies, want) {
+		t.Fatalf("dependencies %q, want %q", introspection.Dependencies, want)
+	}
+	if deps := requirements(introspection.Dependencies); deps["shop"] != "file:///src/shop spiders" || deps["scrapy"] != "2.11.2" {
+		t.Fatalf("requirements %v", deps)
+	}
+}
@@ -2,11 +2,100 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"gorm.io/gorm"
 	"io"
+	"maps"
+	"scrapyd/api/errs"
 	"scrapyd/models"
+	"slices"
+	"strings"
 )
 
+// JobFingerprint identifies "the same crawl": project + spider, plus the spider args when asked to.
+func JobFingerprint(job *models.Job, byArgs bool) string {
+	parts := []string{job.ProjectID, job.Spider}
+	if byArgs {
+		for _, key := range slices.Sorted(maps.Keys(job.Args)) {
+			parts = append(parts, fmt.Sprintf("%s=%s", key, job.Args[key]))
+		}
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// JobAdmit enforces the uniqueness policy of the job and creates its row along with its
+// execute task. A job that has to wait behind an identical one is created as "queued"
+// instead of "pending" and gets no task yet. Once the job is admitted, prepare runs within
+// the same transaction, before the job row is written. The uniqueness check and the insert
+// are atomic since transactions hold the database write lock from the start.
+func JobAdmit(job *models.Job, prepare func(tx *gorm.DB) error) error {
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := jobAdmit(tx, job); err != nil {
+			return err
+		}
+
+		if prepare != nil {
+			if err := prepare(tx); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(job).Error; err != nil {
+			return err
+		}
+		if job.Status == "pending" {
+			return OutboxAdd(tx, "execute:job", job.ID)
+		}
+		return nil
+	})
+}
+
+// JobReadmit admits a job that ran before once more, under the same policy and with the
+// same outcomes as JobAdmit. The job is saved as pending or queued, its last run forgotten.
+func JobReadmit(job *models.Job) error {
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		job.Status = "pending"
+		job.ExitCode = 0
+		job.Error = ""
+		if err := jobAdmit(tx, job); err != nil {
+			return err
+		}
+
+		if err := tx.Save(job).Error; err != nil {
+			return err
+		}
+		if job.Status == "pending" {
+			return OutboxAdd(tx, "execute:job", job.ID)
+		}
+		return nil
+	})
+}
+
+// jobAdmit queues the job or rejects it when an identical one is pending, running or queued.
+func jobAdmit(tx *gorm.DB, job *models.Job) error {
+	if job.Uniqueness == "allow" {
+		return nil
+	}
+
+	var active int64
+	if err := tx.Model(&models.Job{}).
+		Where("fingerprint = ? AND status IN ? AND id <> ?", job.Fingerprint, []string{"pending", "running", "queued"}, job.ID).
+		Count(&active).Error; err != nil {
+		return err
+	}
+	if active > 0 {
+		if job.Uniqueness == "reject" {
+			return errs.ErrJobDuplicate
+		}
+		job.Status = "queued"
+	}
+	return nil
+}
+
 func JobCleanup(job *models.Job) error {
 	d, err := NewDaemon()
 	if err != nil {
@@ -16,6 +105,10 @@ func JobCleanup(job *models.Job) error {
 
 	contName := fmt.Sprintf("%s_%s_%s_%s", job.ID, job.ProjectID, job.VersionID, job.Spider)
 	cont, err := d.FindContainerByName(contName)
+	if errors.Is(err, errs.ErrContainerNotFound) {
+		// never started, nothing to clean
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -33,7 +126,28 @@ func JobCleanup(job *models.Job) error {
 	return nil
 }
 
-func JobLogReader(reqCtx context.Context, job *models.Job) (io.ReadCloser, error) {
+// jobStop stops the job container but keeps it around for its logs, the job ends up cancelled.
+func jobStop(job *models.Job) error {
+	d, err := NewDaemon()
+	if err != nil {
+		return err
+	}
+	defer d.Client.Close()
+
+	contName := fmt.Sprintf("%s_%s_%s_%s", job.ID, job.ProjectID, job.VersionID, job.Spider)
+	cont, err := d.FindContainerByName(contName)
+	if err == nil {
+		err = d.ContainerStop(cont.ID)
+	}
+	if err != nil && !errors.Is(err, errs.ErrContainerNotFound) {
+		return err
+	}
+
+	job.Status = "cancelled"
+	return models.DB.Save(job).Error
+}
+
+func JobLogReader(reqCtx context.Context, job *models.Job, follow bool) (io.ReadCloser, error) {
 	d, err := NewDaemon()
 	if err != nil {
 		return nil, err
@@ -46,7 +160,7 @@ func JobLogReader(reqCtx context.Context, job *models.Job) (io.ReadCloser, error
 		return nil, err
 	}
 
-	reader, err := d.ContainerLogs(reqCtx, cont.ID, true)
+	reader, err := d.ContainerLogs(reqCtx, cont.ID, follow)
 	if err != nil {
 		return nil, err
 	}
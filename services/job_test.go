@@ -0,0 +1,125 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"scrapyd/api/errs"
+	"scrapyd/models"
+	"scrapyd/testutil"
+	"sync"
+	"testing"
+)
+
+func TestJobAdmitConcurrent(t *testing.T) {
+	tests := []struct {
+		uniqueness string
+		statuses   map[string]int
+	}{
+		{uniqueness: "reject", statuses: map[string]int{"pending": 1}},
+		{uniqueness: "queue", statuses: map[string]int{"pending": 1, "queued": 7}},
+		{uniqueness: "allow", statuses: map[string]int{"pending": 8}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uniqueness, func(t *testing.T) {
+			testutil.Setup(t)
+			testutil.Create(t,
+				&models.Project{ID: "shop"},
+				&models.Version{ID: "v1", ProjectID: "shop", Image: "shop:v1", Status: "ready", Spiders: []string{"items"}},
+			)
+
+			var wg sync.WaitGroup
+			results := make([]error, 8)
+			for i := range results {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					job := &models.Job{ID: fmt.Sprint("job", i), ProjectID: "shop", VersionID: "v1", Spider: "items", Status: "pending", Uniqueness: tt.uniqueness}
+					job.Fingerprint = JobFingerprint(job, false)
+					results[i] = JobAdmit(job, nil)
+				}()
+			}
+			wg.Wait()
+
+			for _, err := range results {
+				if err != nil && !errors.Is(err, errs.ErrJobDuplicate) {
+					t.Fatal(err)
+				}
+			}
+			var jobs []models.Job
+			models.DB.Find(&jobs)
+			statuses := map[string]int{}
+			for _, job := range jobs {
+				statuses[job.Status]++
+			}
+			if fmt.Sprint(statuses) != fmt.Sprint(tt.statuses) {
+				t.Fatalf("statuses %v, want %v", statuses, tt.statuses)
+			}
+
+			var outbox int64
+			models.DB.Model(&models.Outbox{}).Where("type = ?", "execute:job").Count(&outbox)
+			if int(outbox) != tt.statuses["pending"] {
+				t.Fatalf("%d execute tasks for %d pending jobs", outbox, tt.statuses["pending"])
+			}
+		})
+	}
+}
+
+func TestJobAdmitPrepareFailure(t *testing.T) {
+	testutil.Setup(t)
+	testutil.Create(t, &models.Project{ID: "shop"}, &models.Version{ID: "v1", ProjectID: "shop", Image: "shop:v1", Status: "ready"})
+
+	job := &models.Job{ID: "j1", ProjectID: "shop", VersionID: "v1", Spider: "items", Status: "pending", Uniqueness: "allow"}
+	failed := errors.New("disk full")
+	if err := JobAdmit(job, func(tx *gorm.DB) error { return failed }); !errors.Is(err, failed) {
+		t.Fatalf("err %v", err)
+	}
+	var n int64
+	models.DB.Model(&models.Job{}).Count(&n)
+	if n != 0 {
+		t.Fatal("job admitted despite the failure")
+	}
+}
+
+func TestJobReadmit(t *testing.T) {
+	tests := []struct {
+		uniqueness string
+		active     string
+		status     string
+		err        error
+	}{
+		{uniqueness: "reject", status: "pending"},
+		{uniqueness: "reject", active: "running", status: "finished", err: errs.ErrJobDuplicate},
+		{uniqueness: "queue", active: "queued", status: "queued"},
+		{uniqueness: "allow", active: "running", status: "pending"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uniqueness+"/"+tt.active, func(t *testing.T) {
+			testutil.Setup(t)
+			testutil.Create(t,
+				&models.Project{ID: "shop"},
+				&models.Version{ID: "v1", ProjectID: "shop", Image: "shop:v1", Status: "ready", Spiders: []string{"items"}},
+				&models.Job{ID: "j1", ProjectID: "shop", VersionID: "v1", Spider: "items", Status: "finished", ExitCode: 1, Uniqueness: tt.uniqueness, Fingerprint: "fp"},
+			)
+			if tt.active != "" {
+				testutil.Create(t, &models.Job{ID: "j2", ProjectID: "shop", VersionID: "v1", Spider: "items", Status: tt.active, Uniqueness: tt.uniqueness, Fingerprint: "fp"})
+			}
+
+			var job models.Job
+			models.DB.First(&job, "id = ?", "j1")
+			if err := JobReadmit(&job); !errors.Is(err, tt.err) {
+				t.Fatalf("err %v, want %v", err, tt.err)
+			}
+			models.DB.First(&job, "id = ?", "j1")
+			if job.Status != tt.status {
+				t.Fatalf("status %s, want %s", job.Status, tt.status)
+			}
+			if tt.status == "pending" && job.ExitCode != 0 {
+				t.Fatalf("exit code %d of the last run kept", job.ExitCode)
+			}
+			if n := testutil.Count[models.Outbox](t, "type = ? AND task_id = ?", "execute:job", "j1"); (n == 1) != (tt.status == "pending") {
+				t.Fatalf("%d execute tasks for a %s job", n, job.Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package services
+
+import (
+	"gorm.io/gorm"
+	"scrapyd/models"
+)
+
+// OutboxAdd records a task within tx, it only gets published once tx commits.
+func OutboxAdd(tx *gorm.DB, typeName string, ID string) error {
+	return tx.Create(&models.Outbox{
+		Type:   typeName,
+		TaskID: ID,
+	}).Error
+}
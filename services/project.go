@@ -1,16 +1,43 @@
 package services
 
-import "scrapyd/models"
+import (
+	"gorm.io/gorm"
+	"scrapyd/api/errs"
+	"scrapyd/models"
+)
+
+// ProjectCleanup removes what the project leaves on the daemon before its rows go. Active jobs
+// stop it without force, in which case they get cancelled like with VersionRemove.
+func ProjectCleanup(project *models.Project, force bool) error {
+	var jobs []models.Job
+	models.DB.Find(&jobs, "project_id = ? AND status IN ?", project.ID, []string{"pending", "running", "queued"})
+	if len(jobs) > 0 && !force {
+		return errs.ErrProjectInUse
+	}
+	for _, job := range jobs {
+		if err := jobStop(&job); err != nil {
+			return err
+		}
+	}
 
-func ProjectCleanup(project *models.Project) error {
 	d, err := NewDaemon()
 	if err != nil {
 		return err
 	}
 	defer d.Client.Close()
 
+	// images shared with versions of other projects stay around
+	others := models.DB.Where("project_id <> ?", project.ID).Session(&gorm.Session{})
 	for _, v := range project.Versions {
-		if err := VersionCleanup(&v); err != nil {
+		if err := versionCleanup(&v, others); err != nil {
+			return err
+		}
+	}
+	for _, input := range project.Inputs {
+		// blobs shared with inputs of other projects stay around
+		var refs int64
+		models.DB.Model(&models.InputFile{}).Where("hash = ? AND project_id <> ?", input.Hash, project.ID).Count(&refs)
+		if err := removeInputBlob(&input, refs); err != nil {
 			return err
 		}
 	}
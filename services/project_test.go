@@ -0,0 +1,41 @@
+package services
+
+import (
+	"gorm.io/gorm"
+	"scrapyd/models"
+	"scrapyd/testutil"
+	"testing"
+)
+
+func TestImageRefsSharedAcrossProjects(t *testing.T) {
+	testutil.Setup(t)
+	testutil.Create(t,
+		&models.Project{ID: "shop"},
+		&models.Project{ID: "blog"},
+		&models.Version{ID: "s1", ProjectID: "shop", Image: "shop:v1", ImageID: "sha256:aaa"},
+		&models.Version{ID: "s2", ProjectID: "shop", Image: "shared:v1", ImageID: "sha256:bbb"},
+		&models.Version{ID: "b1", ProjectID: "blog", Image: "blog:v1", ImageID: "sha256:bbb"},
+	)
+
+	// the scope is reused for every version of the project, as ProjectCleanup does
+	others := models.DB.Where("project_id <> ?", "shop").Session(&gorm.Session{})
+	want := map[string]int64{"s1": 0, "s2": 1}
+	for _, id := range []string{"s1", "s2", "s1"} {
+		var version models.Version
+		models.DB.First(&version, "id = ?", id)
+		refs, err := imageRefs(&version, others)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if refs != want[id] {
+			t.Errorf("%s: %d references, want %d", id, refs, want[id])
+		}
+	}
+
+	// within the project, removing s2 keeps the image blog still uses
+	var version models.Version
+	models.DB.First(&version, "id = ?", "s2")
+	if refs, _ := imageRefs(&version, models.DB); refs != 1 {
+		t.Errorf("s2: %d references, want 1", refs)
+	}
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"errors"
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/registry"
+	"gorm.io/gorm"
+	"scrapyd/models"
+)
+
+// RegistryAuth returns the encoded credentials the project has for the registry of ref,
+// or an empty string for anonymous pulls.
+func RegistryAuth(projectID string, ref string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", err
+	}
+
+	var credential models.RegistryCredential
+	err = models.DB.First(&credential, "project_id = ? AND registry = ?", projectID, reference.Domain(named)).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	password, err := SecretOpen(credential.Password)
+	if err != nil {
+		return "", err
+	}
+
+	return registry.EncodeAuthConfig(registry.AuthConfig{
+		Username:      credential.Username,
+		Password:      password,
+		ServerAddress: credential.Registry,
+	})
+}
+
+// VersionPull pulls the version image and pins it to the digest the registry resolved.
+func VersionPull(version *models.Version) error {
+	d, err := NewDaemon()
+	if err != nil {
+		return err
+	}
+	defer d.Client.Close()
+
+	auth, err := RegistryAuth(version.ProjectID, version.Reference)
+	if err != nil {
+		return err
+	}
+	if err := d.ImagePull(version.Reference, auth); err != nil {
+		return err
+	}
+
+	digest, err := d.ImageDigest(version.Reference)
+	if err != nil {
+		return err
+	}
+	named, err := reference.ParseNormalizedNamed(version.Reference)
+	if err != nil {
+		return err
+	}
+
+	version.Digest = digest
+	version.Image = reference.FamiliarName(named) + "@" + digest
+	return nil
+}
@@ -0,0 +1,50 @@
+//go:build integration
+
+package services
+
+import (
+	"os"
+	"scrapyd/models"
+	"scrapyd/testutil"
+	"strings"
+	"testing"
+)
+
+// TestVersionPullPrivateRegistry pulls from a registry requiring authentication, e.g.
+//
+//	htpasswd -Bbn ci hunter2 > auth/htpasswd
+//	docker run -d -p 5000:5000 -v $PWD/auth:/auth -e REGISTRY_AUTH=htpasswd \
+//		-e REGISTRY_AUTH_HTPASSWD_REALM=test -e REGISTRY_AUTH_HTPASSWD_PATH=/auth/htpasswd registry:2
+//	docker login localhost:5000 -u ci -p hunter2
+//	docker tag busybox localhost:5000/busybox && docker push localhost:5000/busybox
+//	docker logout localhost:5000
+//	SCRAPYD_TEST_IMAGE=localhost:5000/busybox SCRAPYD_TEST_REGISTRY_USER=ci SCRAPYD_TEST_REGISTRY_PASSWORD=hunter2 \
+//		go test -tags integration -run PrivateRegistry ./services
+func TestVersionPullPrivateRegistry(t *testing.T) {
+	ref := os.Getenv("SCRAPYD_TEST_IMAGE")
+	if ref == "" {
+		t.Skip("SCRAPYD_TEST_IMAGE is not set")
+	}
+	testutil.Setup(t)
+	testutil.MasterKey(t, "test")
+	testutil.Create(t, &models.Project{ID: "shop"})
+
+	version := &models.Version{ID: "v1", ProjectID: "shop", Reference: ref}
+	if err := VersionPull(version); err == nil {
+		t.Fatal("pulled without credentials")
+	}
+
+	password, err := SecretSeal(os.Getenv("SCRAPYD_TEST_REGISTRY_PASSWORD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, _, _ := strings.Cut(ref, "/")
+	testutil.Create(t, &models.RegistryCredential{ProjectID: "shop", Registry: registry, Username: os.Getenv("SCRAPYD_TEST_REGISTRY_USER"), Password: password})
+
+	if err := VersionPull(version); err != nil {
+		t.Fatal(err)
+	}
+	if version.Digest == "" || !strings.Contains(version.Image, "@sha256:") {
+		t.Fatalf("version not pinned: %q %q", version.Image, version.Digest)
+	}
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"scrapyd/models"
+	"scrapyd/testutil"
+	"testing"
+)
+
+func TestRegistryAuth(t *testing.T) {
+	testutil.Setup(t)
+	testutil.MasterKey(t, "test")
+	password, err := SecretSeal("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.Create(t,
+		&models.Project{ID: "shop"},
+		&models.RegistryCredential{ProjectID: "shop", Registry: "localhost:5000", Username: "ci", Password: password},
+	)
+
+	auth, err := RegistryAuth("shop", "localhost:5000/shop/spiders:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := base64.URLEncoding.DecodeString(auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config map[string]string
+	json.Unmarshal(data, &config)
+	if config["username"] != "ci" || config["password"] != "hunter2" || config["serveraddress"] != "localhost:5000" {
+		t.Fatalf("auth config %v", config)
+	}
+
+	if auth, err := RegistryAuth("shop", "ghcr.io/shop/spiders:v1"); auth != "" || err != nil {
+		t.Fatalf("anonymous pull got %q %v", auth, err)
+	}
+}
+
+func TestRegistryAuthDatabaseError(t *testing.T) {
+	testutil.Setup(t)
+	if err := models.DB.Migrator().DropTable(&models.RegistryCredential{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RegistryAuth("shop", "localhost:5000/shop/spiders:v1"); err == nil {
+		t.Fatal("database error swallowed")
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"github.com/rs/zerolog/log"
+	"scrapyd/api/types"
+	"scrapyd/models"
+	"time"
+)
+
+// RetentionPlan lists the versions the project retention policy would delete. The newest
+// RetainLast ready or failed versions are always kept, whatever the other rules say. Versions
+// that are aliased, have active jobs or are still being ingested are never candidates.
+func RetentionPlan(project *models.Project) (*types.RetentionReport, error) {
+	report := &types.RetentionReport{
+		ProjectID:        project.ID,
+		RetainLast:       project.RetainLast,
+		RetainUnusedDays: project.RetainUnusedDays,
+		Candidates:       []types.RetentionCandidate{},
+	}
+	if project.RetainLast <= 0 && project.RetainUnusedDays <= 0 {
+		return report, nil
+	}
+
+	var versions []models.Version
+	if err := models.DB.Order("created_at DESC").Find(&versions, "project_id = ?", project.ID).Error; err != nil {
+		return nil, err
+	}
+
+	candidates := make(map[string]bool)
+	kept := 0
+	for _, version := range versions {
+		if version.Status != "ready" && version.Status != "failed" {
+			continue
+		}
+		kept++
+		if kept <= project.RetainLast {
+			continue
+		}
+
+		var protected int64
+		models.DB.Model(&models.Alias{}).Where("project_id = ? AND version_id = ?", project.ID, version.ID).Count(&protected)
+		if protected == 0 {
+			models.DB.Model(&models.Job{}).Where("version_id = ? AND status IN ?", version.ID, []string{"pending", "running", "queued"}).Count(&protected)
+		}
+		if protected > 0 {
+			continue
+		}
+
+		lastUsed := version.CreatedAt
+		var lastJob models.Job
+		if err := models.DB.Order("created_at DESC").Limit(1).Find(&lastJob, "version_id = ?", version.ID).Error; err == nil && lastJob.CreatedAt.After(lastUsed) {
+			lastUsed = lastJob.CreatedAt
+		}
+
+		reason := ""
+		if project.RetainLast > 0 {
+			reason = "beyond the last versions to keep"
+		} else if project.RetainUnusedDays > 0 && lastUsed.Before(time.Now().AddDate(0, 0, -project.RetainUnusedDays)) {
+			reason = "unused for too long"
+		}
+		if reason == "" {
+			continue
+		}
+
+		candidates[version.ID] = true
+		report.Candidates = append(report.Candidates, types.RetentionCandidate{
+			VersionID:  version.ID,
+			Image:      version.Image,
+			Reason:     reason,
+			LastUsedAt: lastUsed,
+		})
+	}
+
+	if len(report.Candidates) == 0 {
+		return report, nil
+	}
+
+	d, err := NewDaemon()
+	if err != nil {
+		return nil, err
+	}
+	defer d.Client.Close()
+
+	// an image only frees disk when no remaining version uses it, and only once
+	counted := make(map[string]bool)
+	for i := range report.Candidates {
+		candidate := &report.Candidates[i]
+		imageID, size, err := d.ImageSize(candidate.Image)
+		if err != nil {
+			continue
+		}
+		candidate.Size = size
+
+		var shared int64
+		models.DB.Model(&models.Version{}).
+			Where("id NOT IN ?", keys(candidates)).
+			Where(models.DB.Where("image = ?", candidate.Image).Or("image_id = ?", imageID)).
+			Count(&shared)
+		if shared == 0 && !counted[imageID] {
+			counted[imageID] = true
+			candidate.Freed = size
+			report.FreedBytes += size
+		}
+	}
+
+	return report, nil
+}
+
+// RetentionApply deletes the versions planned by the retention policy, one failure
+// doesn't stop the others.
+func RetentionApply(project *models.Project) (*types.RetentionReport, error) {
+	report, err := RetentionPlan(project)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, candidate := range report.Candidates {
+		var version models.Version
+		if err := models.DB.First(&version, "id = ?", candidate.VersionID).Error; err != nil {
+			continue
+		}
+		if err := VersionRemove(&version, false); err != nil {
+			log.Error().
+				Err(err).
+				Str("project", project.ID).
+				Str("version", version.ID).
+				Msg("failed to apply retention")
+			continue
+		}
+		log.Info().
+			Str("project", project.ID).
+			Str("version", version.ID).
+			Str("reason", candidate.Reason).
+			Msg("version deleted by retention")
+	}
+
+	return report, nil
+}
+
+func keys(set map[string]bool) []string {
+	result := make([]string, 0, len(set))
+	for key := range set {
+		result = append(result, key)
+	}
+	return result
+}
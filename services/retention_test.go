@@ -0,0 +1,140 @@
+package services
+
+import (
+	"fmt"
+	"scrapyd/models"
+	"scrapyd/testutil"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRetentionPlan(t *testing.T) {
+	days := func(n int) time.Time { return time.Now().AddDate(0, 0, -n) }
+	type version struct {
+		id      string
+		age     int
+		status  string
+		lastJob int    // days since the last job, -1 for none
+		job     string // status of the last job
+	}
+	tests := []struct {
+		name       string
+		retainLast int
+		unusedDays int
+		versions   []version
+		aliased    []string
+		want       []string
+	}{
+		{
+			name:       "keep last",
+			retainLast: 2,
+			versions:   []version{{id: "v1", age: 4}, {id: "v2", age: 3}, {id: "v3", age: 2}, {id: "v4", age: 1}},
+			want:       []string{"v2", "v1"},
+		},
+		{
+			name:       "keep last counts only ingested versions",
+			retainLast: 2,
+			versions:   []version{{id: "v1", age: 4}, {id: "v2", age: 3, status: "failed"}, {id: "v3", age: 2}, {id: "v4", age: 1, status: "building"}, {id: "v5", age: 0, status: "uploading"}},
+			want:       []string{"v1"},
+		},
+		{
+			name:       "unused",
+			unusedDays: 30,
+			versions:   []version{{id: "v1", age: 60, lastJob: -1}, {id: "v2", age: 60, lastJob: 5, job: "finished"}, {id: "v3", age: 1, lastJob: -1}, {id: "v4", age: 60, lastJob: 40, job: "finished"}},
+			want:       []string{"v4", "v1"},
+		},
+		{
+			name:       "aliased",
+			retainLast: 1,
+			versions:   []version{{id: "v1", age: 3}, {id: "v2", age: 2}, {id: "v3", age: 1}},
+			aliased:    []string{"v1"},
+			want:       []string{"v2"},
+		},
+		{
+			name:       "active jobs",
+			unusedDays: 30,
+			versions:   []version{{id: "v1", age: 60, lastJob: 40, job: "running"}, {id: "v2", age: 60, lastJob: 40, job: "queued"}, {id: "v3", age: 60, lastJob: 40, job: "cancelled"}},
+			want:       []string{"v3"},
+		},
+		{
+			name:       "combined keeps the only version",
+			retainLast: 1,
+			unusedDays: 30,
+			versions:   []version{{id: "v1", age: 60, lastJob: -1}},
+			want:       []string{},
+		},
+		{
+			name:       "combined keeps the newest",
+			retainLast: 2,
+			unusedDays: 30,
+			versions:   []version{{id: "v1", age: 90, lastJob: -1}, {id: "v2", age: 60, lastJob: -1}, {id: "v3", age: 50, lastJob: -1}},
+			want:       []string{"v1"},
+		},
+		{
+			name:     "disabled",
+			versions: []version{{id: "v1", age: 90, lastJob: -1}},
+			want:     []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.Setup(t)
+			project := &models.Project{ID: "shop", RetainLast: tt.retainLast, RetainUnusedDays: tt.unusedDays}
+			testutil.Create(t, project)
+			for _, v := range tt.versions {
+				status := v.status
+				if status == "" {
+					status = "ready"
+				}
+				testutil.Create(t, &models.Version{ID: v.id, ProjectID: "shop", Image: "shop:" + v.id, Status: status, CreatedAt: days(v.age)})
+				if v.job != "" {
+					testutil.Create(t, &models.Job{ID: "job-" + v.id, ProjectID: "shop", VersionID: v.id, Spider: "items", Status: v.job, CreatedAt: days(v.lastJob)})
+				}
+			}
+			for _, id := range tt.aliased {
+				testutil.Create(t, &models.Alias{ProjectID: "shop", Name: "prod-" + id, VersionID: id})
+			}
+
+			report, err := RetentionPlan(project)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, candidate := range report.Candidates {
+				got = append(got, candidate.VersionID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("candidates %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetentionPlanReasons(t *testing.T) {
+	testutil.Setup(t)
+	project := &models.Project{ID: "shop", RetainUnusedDays: 30}
+	testutil.Create(t, project)
+	for i := range 3 {
+		testutil.Create(t, &models.Version{ID: fmt.Sprint("v", i), ProjectID: "shop", Image: "shop:v", Status: "ready", CreatedAt: time.Now().AddDate(0, 0, -60+i)})
+	}
+
+	report, err := RetentionPlan(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, candidate := range report.Candidates {
+		if candidate.Reason != "unused for too long" {
+			t.Errorf("%s: reason %q", candidate.VersionID, candidate.Reason)
+		}
+	}
+
+	project.RetainLast = 1
+	report, err = RetentionPlan(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Candidates) != 2 || report.Candidates[0].Reason != "beyond the last versions to keep" {
+		t.Fatalf("candidates %+v", report.Candidates)
+	}
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"maps"
+	"regexp"
+	"scrapyd/api/errs"
+	"scrapyd/config"
+	"scrapyd/models"
+	"slices"
+)
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func EnvNameValid(name string) bool {
+	return envNamePattern.MatchString(name)
+}
+
+func secretCipher() (cipher.AEAD, error) {
+	if config.MasterKey == "" {
+		return nil, errs.ErrSecretsDisabled
+	}
+
+	key := sha256.Sum256([]byte(config.MasterKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// SecretSeal encrypts the value with the master key, the nonce is prepended to the result.
+func SecretSeal(value string) ([]byte, error) {
+	aead, err := secretCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, []byte(value), nil), nil
+}
+
+func SecretOpen(sealed []byte) (string, error) {
+	aead, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return "", errs.ErrSecretUnreadable
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	value, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errs.ErrSecretUnreadable
+	}
+
+	return string(value), nil
+}
+
+// JobEnv builds the container env: project env vars, overridden by the job env,
+// overridden by the referenced secrets.
+func JobEnv(job *models.Job) ([]string, error) {
+	env := make(map[string]string)
+	var order []string
+	set := func(name, value string) {
+		if _, ok := env[name]; !ok {
+			order = append(order, name)
+		}
+		env[name] = value
+	}
+
+	var envVars []models.EnvVar
+	models.DB.Find(&envVars, "project_id = ?", job.ProjectID)
+	for _, envVar := range envVars {
+		set(envVar.Name, envVar.Value)
+	}
+	for _, name := range slices.Sorted(maps.Keys(job.Env)) {
+		set(name, job.Env[name])
+	}
+
+	for _, name := range job.Secrets {
+		var secret models.Secret
+		if err := models.DB.First(&secret, "project_id = ? AND name = ?", job.ProjectID, name).Error; err != nil {
+			log.Error().
+				Str("job", job.ID).
+				Str("secret", name).
+				Msg("referenced secret not found")
+			return nil, errs.ErrSecretNotFound
+		}
+		value, err := SecretOpen(secret.Value)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("job", job.ID).
+				Str("secret", name).
+				Msg("failed to open secret")
+			return nil, err
+		}
+		set(name, value)
+	}
+
+	result := make([]string, 0, len(order))
+	for _, name := range order {
+		result = append(result, fmt.Sprintf("%s=%s", name, env[name]))
+	}
+
+	return result, nil
+}
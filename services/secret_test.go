@@ -0,0 +1,105 @@
+package services
+
+import (
+	"errors"
+	"scrapyd/api/errs"
+	"scrapyd/models"
+	"scrapyd/testutil"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSecretSealOpen(t *testing.T) {
+	testutil.MasterKey(t, "master")
+	sealed, err := SecretSeal("token-123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(sealed), "token-123") {
+		t.Fatal("value stored in the clear")
+	}
+
+	value, err := SecretOpen(sealed)
+	if err != nil || value != "token-123" {
+		t.Fatalf("opened %q, %v", value, err)
+	}
+
+	again, _ := SecretSeal("token-123")
+	if string(again) == string(sealed) {
+		t.Fatal("sealing twice gave the same ciphertext")
+	}
+}
+
+func TestSecretOpenFailures(t *testing.T) {
+	testutil.MasterKey(t, "master")
+	sealed, err := SecretSeal("token-123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := slices.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name   string
+		key    string
+		sealed []byte
+		err    error
+	}{
+		{name: "wrong key", key: "other", sealed: sealed, err: errs.ErrSecretUnreadable},
+		{name: "tampered", key: "master", sealed: tampered, err: errs.ErrSecretUnreadable},
+		{name: "truncated", key: "master", sealed: sealed[:4], err: errs.ErrSecretUnreadable},
+		{name: "no key", key: "", sealed: sealed, err: errs.ErrSecretsDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.MasterKey(t, tt.key)
+			if value, err := SecretOpen(tt.sealed); !errors.Is(err, tt.err) {
+				t.Fatalf("opened %q, err %v, want %v", value, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestJobEnvPrecedence(t *testing.T) {
+	testutil.Setup(t)
+	testutil.MasterKey(t, "master")
+	sealed, err := SecretSeal("from-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.Create(t,
+		&models.Project{ID: "shop"},
+		&models.Project{ID: "other"},
+		&models.EnvVar{ProjectID: "shop", Name: "REGION", Value: "eu"},
+		&models.EnvVar{ProjectID: "shop", Name: "PROXY", Value: "from-project"},
+		&models.EnvVar{ProjectID: "shop", Name: "API_KEY", Value: "from-project"},
+		&models.EnvVar{ProjectID: "other", Name: "LEAK", Value: "other-project"},
+		&models.Secret{ProjectID: "shop", Name: "API_KEY", Value: sealed},
+	)
+
+	env, err := JobEnv(&models.Job{
+		ID:        "j1",
+		ProjectID: "shop",
+		Env:       map[string]string{"PROXY": "from-job", "API_KEY": "from-job", "DEPTH": "2"},
+		Secrets:   []string{"API_KEY"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(env)
+	want := []string{"API_KEY=from-secret", "DEPTH=2", "PROXY=from-job", "REGION=eu"}
+	if !slices.Equal(env, want) {
+		t.Fatalf("env %v, want %v", env, want)
+	}
+}
+
+func TestJobEnvMissingSecret(t *testing.T) {
+	testutil.Setup(t)
+	testutil.MasterKey(t, "master")
+	testutil.Create(t, &models.Project{ID: "shop"})
+
+	if _, err := JobEnv(&models.Job{ID: "j1", ProjectID: "shop", Secrets: []string{"API_KEY"}}); !errors.Is(err, errs.ErrSecretNotFound) {
+		t.Fatalf("err %v", err)
+	}
+}
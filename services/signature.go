@@ -0,0 +1,122 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"github.com/rs/zerolog/log"
+	"os"
+	"scrapyd/api/errs"
+	"scrapyd/models"
+	"strings"
+)
+
+// ParsePublicKey accepts PEM encoded PKIX RSA, ECDSA and Ed25519 public keys.
+func ParsePublicKey(text string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(text))
+	if block == nil {
+		return nil, errs.ErrKeyInvalid
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errs.ErrKeyInvalid
+	}
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	}
+	return nil, errs.ErrKeyInvalid
+}
+
+// verifySignature checks a signature over the sha256 digest of the image tar, which is what
+// `openssl dgst -sha256 -sign` produces for RSA and ECDSA keys. Ed25519 signs the raw digest.
+func verifySignature(key crypto.PublicKey, digest []byte, signature []byte) bool {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest, signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, digest, signature)
+	}
+	return false
+}
+
+// VersionUploadVerify checks the stored image tar against the expected digest and, when the
+// project has trusted keys, against the signature. Rejected uploads are removed before they
+// get anywhere near the daemon.
+func VersionUploadVerify(version *models.Version, digest []byte, expected string, signature []byte) error {
+	err := versionUploadVerify(version, digest, expected, signature)
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("project", version.ProjectID).
+			Str("version", version.ID).
+			Str("digest", hex.EncodeToString(digest)).
+			Msg("image tar rejected")
+		os.Remove(VersionUploadPath(version.ID))
+		return err
+	}
+
+	version.UploadDigest = "sha256:" + hex.EncodeToString(digest)
+	return nil
+}
+
+func versionUploadVerify(version *models.Version, digest []byte, expected string, signature []byte) error {
+	if expected != "" {
+		expected = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(expected), "sha256:"))
+		if expected != hex.EncodeToString(digest) {
+			return errs.ErrVersionDigestMismatch
+		}
+	}
+	return versionSignatureVerify(version, digest, signature)
+}
+
+// VersionSignatureVerify checks the signature over the sha256 digest of the source zip or egg
+// stored at path when the project has trusted keys, rejected files are removed. Pulls pass no
+// path and no signature, projects with trusted keys only take signed uploads.
+func VersionSignatureVerify(version *models.Version, path string, digest []byte, signature []byte) error {
+	if err := versionSignatureVerify(version, digest, signature); err != nil {
+		log.Warn().
+			Err(err).
+			Str("project", version.ProjectID).
+			Str("version", version.ID).
+			Str("source", version.Source).
+			Msg("version rejected")
+		if path != "" {
+			os.Remove(path)
+		}
+		return err
+	}
+	return nil
+}
+
+func versionSignatureVerify(version *models.Version, digest []byte, signature []byte) error {
+	var keys []models.TrustedKey
+	if err := models.DB.Order("name").Find(&keys, "project_id = ?", version.ProjectID).Error; err != nil {
+		return err
+	}
+	if len(signature) == 0 {
+		if len(keys) > 0 {
+			return errs.ErrVersionUnsigned
+		}
+		return nil
+	}
+
+	for _, trusted := range keys {
+		key, err := ParsePublicKey(trusted.PublicKey)
+		if err != nil {
+			continue
+		}
+		if verifySignature(key, digest, signature) {
+			version.SignedBy = trusted.Name
+			return nil
+		}
+	}
+	return errs.ErrVersionSignatureInvalid
+}
@@ -1,35 +1,231 @@
 package services
 
 import (
-	"mime/multipart"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"io"
+	"os"
+	"path/filepath"
+	"scrapyd/api/errs"
+	"scrapyd/api/types"
+	"scrapyd/config"
 	"scrapyd/models"
 )
 
+// VersionRemove deletes the version unless it's still in use. Active jobs only stop it without
+// force, in which case they get cancelled. The version row is soft deleted to keep its job history.
+func VersionRemove(version *models.Version, force bool) error {
+	var aliases int64
+	models.DB.Model(&models.Alias{}).Where("project_id = ? AND version_id = ?", version.ProjectID, version.ID).Count(&aliases)
+	if aliases > 0 {
+		return errs.ErrVersionAliased
+	}
+
+	var jobs []models.Job
+	models.DB.Find(&jobs, "version_id = ? AND status IN ?", version.ID, []string{"pending", "running", "queued"})
+	if len(jobs) > 0 && !force {
+		return errs.ErrVersionInUse
+	}
+	for _, job := range jobs {
+		if err := jobStop(&job); err != nil {
+			return err
+		}
+	}
+
+	// cleanup the related stuff like image
+	if err := VersionCleanup(version); err != nil {
+		return err
+	}
+
+	return models.DB.Delete(version).Error
+}
+
+// VersionCleanup removes what the version leaves on the daemon. The image goes only once
+// no other version references it.
 func VersionCleanup(version *models.Version) error {
+	return versionCleanup(version, models.DB)
+}
+
+// versionCleanup counts image references among the versions matched by scope.
+func versionCleanup(version *models.Version, scope *gorm.DB) error {
 	d, err := NewDaemon()
 	if err != nil {
 		return err
 	}
 	defer d.Client.Close()
 
-	if err = d.ImageRemove(version.Image); err != nil {
+	refs, err := imageRefs(version, scope)
+	if err != nil {
 		return err
 	}
+	if refs == 0 && version.Image != "" {
+		err = d.ImageRemove(version.Image)
+		// containers kept for job logs hold on to the image, retention removes it once they're gone
+		if errors.Is(err, errs.ErrImageInUse) {
+			err = models.DB.Save(&models.PendingImage{Image: version.Image, ImageID: version.ImageID, VersionID: version.ID}).Error
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// builds leave their source and log behind
+	os.Remove(BuildSourcePath(version.ID))
+	os.Remove(BuildLogPath(version.ID))
+	os.Remove(VersionUploadPath(version.ID))
 
 	return nil
 }
 
-func VersionInit(file multipart.File) string {
+// ImagesRemovePending removes the images deleted versions left behind while job containers
+// still used them. Images another version took up since are left to that version.
+func ImagesRemovePending() error {
+	var images []models.PendingImage
+	if err := models.DB.Find(&images).Error; err != nil {
+		return err
+	}
+	if len(images) == 0 {
+		return nil
+	}
+
 	d, err := NewDaemon()
 	if err != nil {
-		return ""
+		return err
 	}
 	defer d.Client.Close()
 
-	imageName, err := d.ImageLoad(file)
+	for _, image := range images {
+		refs, err := imageRefs(&models.Version{Image: image.Image, ImageID: image.ImageID}, models.DB)
+		if err != nil {
+			return err
+		}
+		if refs == 0 {
+			err = d.ImageRemove(image.Image)
+		}
+		if errors.Is(err, errs.ErrImageInUse) {
+			continue
+		}
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("version", image.VersionID).
+				Str("image", image.Image).
+				Msg("failed to remove pending image")
+			continue
+		}
+		models.DB.Delete(&image)
+	}
+
+	return nil
+}
+
+// imageRefs counts the other versions matched by scope that use the image of the version.
+// Every call starts a new session of scope, the conditions added here stay out of it.
+func imageRefs(version *models.Version, scope *gorm.DB) (int64, error) {
+	var refs int64
+	refQuery := models.DB.Where("image = ?", version.Image)
+	if version.ImageID != "" {
+		refQuery = refQuery.Or("image_id = ?", version.ImageID)
+	}
+	err := scope.Session(&gorm.Session{}).Model(&models.Version{}).Where("id <> ?", version.ID).Where(refQuery).Count(&refs).Error
+	return refs, err
+}
+
+// progressReader reports how much of the underlying reader was consumed, in 5% steps.
+type progressReader struct {
+	reader io.Reader
+	total  int64
+	read   int64
+	last   int
+	report func(int)
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.reader.Read(p)
+	pr.read += int64(n)
+	if pr.total > 0 && pr.report != nil {
+		if percent := int(pr.read * 100 / pr.total); percent >= pr.last+5 {
+			pr.last = percent
+			pr.report(percent)
+		}
+	}
+	return n, err
+}
+
+func VersionUploadPath(versionID string) string {
+	return filepath.Join(config.DataDir, "uploads", versionID+".tar")
+}
+
+// VersionUploadStore keeps the uploaded image tar on disk until the load task picks it up
+// and returns its sha256 digest.
+func VersionUploadStore(versionID string, reader io.Reader) ([]byte, error) {
+	if !types.ValidID(versionID) {
+		return nil, errs.ErrVersionIDInvalid
+	}
+	dest := VersionUploadPath(versionID)
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Create(dest)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, hasher), reader); err != nil {
+		log.Error().
+			Err(err).
+			Str("version", versionID).
+			Msg("failed to store image tar")
+		os.Remove(dest)
+		return nil, err
+	}
+
+	return hasher.Sum(nil), nil
+}
+
+// VersionLoad loads the stored image tar into the daemon and sets the loaded image on the version.
+func VersionLoad(version *models.Version, progress func(int)) error {
+	d, err := NewDaemon()
+	if err != nil {
+		return err
+	}
+	defer d.Client.Close()
+
+	file, err := os.Open(VersionUploadPath(version.ID))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ImageLoadTimeout)
+	defer cancel()
+
+	imageName, err := d.ImageLoad(ctx, &progressReader{reader: file, total: info.Size(), report: progress})
 	if err != nil {
-		return ""
+		return err
 	}
+	version.Image = imageName
 
-	return imageName
+	os.Remove(VersionUploadPath(version.ID))
+	return nil
+}
+
+// TailLog keeps the end of a container log, where the traceback usually is.
+func TailLog(output string) string {
+	const limit = 64 * 1024
+	if len(output) > limit {
+		return output[len(output)-limit:]
+	}
+	return output
 }
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"scrapyd/api/errs"
+	"scrapyd/config"
+	"scrapyd/models"
+	"scrapyd/testutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVersionUploadStoreRejectsPathIDs(t *testing.T) {
+	testutil.Setup(t)
+
+	for _, id := range []string{"../escape", "a/b", ".."} {
+		if _, err := VersionUploadStore(id, strings.NewReader("tar")); !errors.Is(err, errs.ErrVersionIDInvalid) {
+			t.Errorf("%q: err %v", id, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Dir(config.DataDir)); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(config.DataDir))
+	for _, entry := range entries {
+		if entry.Name() != "test.db" {
+			t.Errorf("%s written next to the data dir", entry.Name())
+		}
+	}
+
+	digest, err := VersionUploadStore("v1", strings.NewReader("tar"))
+	if err != nil || len(digest) == 0 {
+		t.Fatalf("digest %x err %v", digest, err)
+	}
+}
+
+func TestVersionImportKeepsOnlyProvenance(t *testing.T) {
+	testutil.Setup(t)
+	if err := os.MkdirAll(filepath.Dir(VersionUploadPath("v2")), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(VersionUploadPath("v2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	meta, _ := json.Marshal(exportMeta{
+		Version: models.Version{
+			ID:            "v1",
+			Source:        "registry",
+			Reference:     "registry.example.com/shop:v1",
+			Digest:        "sha256:aaaa",
+			UploadDigest:  "sha256:bbbb",
+			SignedBy:      "ci",
+			Spiders:       []string{"forged"},
+			ScrapyVersion: "2.11",
+			Settings:      map[string]any{"BOT_NAME": "forged"},
+			CreatedAt:     created,
+		},
+		ExportedBy: "staging-1",
+	})
+	tw := tar.NewWriter(file)
+	tw.WriteHeader(&tar.Header{Name: ExportMetaName, Mode: 0o644, Size: int64(len(meta))})
+	tw.Write(meta)
+	tw.Close()
+	file.Close()
+
+	version := models.Version{ID: "v2", ProjectID: "shop", Source: "tar", UploadDigest: "sha256:cccc"}
+	if err := VersionImport(&version); err != nil {
+		t.Fatal(err)
+	}
+	want := models.Version{
+		ID:             "v2",
+		ProjectID:      "shop",
+		Source:         "registry",
+		Reference:      "registry.example.com/shop:v1",
+		Digest:         "sha256:aaaa",
+		UploadDigest:   "sha256:cccc",
+		ImportedFrom:   "staging-1",
+		ImportedID:     "v1",
+		ImportedSigner: "ci",
+		CreatedAt:      created,
+	}
+	got, _ := json.Marshal(version)
+	wanted, _ := json.Marshal(want)
+	if string(got) != string(wanted) {
+		t.Fatalf("imported %s\nwant %s", got, wanted)
+	}
+}
+
+func TestImagesRemovePendingTakenUp(t *testing.T) {
+	testutil.Setup(t)
+	testutil.Create(t,
+		&models.Project{ID: "shop"},
+		&models.Project{ID: "blog"},
+		&models.Version{ID: "v1", ProjectID: "shop", Image: "shop:v1", Status: "ready"},
+		&models.Version{ID: "v2", ProjectID: "blog", Image: "shop:v1", Status: "ready"},
+		&models.PendingImage{Image: "shop:v1", VersionID: "v1"},
+	)
+	// the pending image outlives the project of its version
+	models.DB.Delete(&models.Project{ID: "shop"})
+	if n := testutil.Count[models.PendingImage](t, "image = ?", "shop:v1"); n != 1 {
+		t.Fatal("the pending image went with the project")
+	}
+
+	// v2 uses the image now, it goes along with v2
+	if err := ImagesRemovePending(); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.Count[models.PendingImage](t, "image = ?", "shop:v1"); n != 0 {
+		t.Fatal("image still pending removal")
+	}
+}
@@ -0,0 +1,63 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hibiken/asynq"
+	"github.com/rs/zerolog/log"
+	"scrapyd/models"
+	"time"
+)
+
+// StartOutboxRelay publishes pending outbox entries to the queue until ctx is done.
+func StartOutboxRelay(ctx context.Context) {
+	relayTicker := time.NewTicker(500 * time.Millisecond)
+	defer relayTicker.Stop()
+	purgeTicker := time.NewTicker(time.Hour)
+	defer purgeTicker.Stop()
+
+	for {
+		select {
+		case <-relayTicker.C:
+			RelayOutbox()
+
+		case <-purgeTicker.C:
+			models.DB.Where("sent = ? AND sent_at < ?", true, time.Now().Add(-24*time.Hour)).Delete(&models.Outbox{})
+
+		case <-ctx.Done():
+			log.Info().Msg("Context Done signal received. Stopping outbox relay.")
+			return
+		}
+	}
+}
+
+// RelayOutbox publishes the unsent entries in order. Handlers skip work that is already done,
+// so an entry published twice after a crash is harmless.
+func RelayOutbox() {
+	var entries []models.Outbox
+
+	models.DB.Where("sent = ?", false).Order("id").Limit(100).Find(&entries)
+	for _, entry := range entries {
+		// every entry is a task of its own, a conflict means it got published
+		// before a crash kept it from being marked as sent
+		err := newTask(entry.Type, entry.TaskID, outboxTaskID(&entry))
+		if err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+			entry.Attempts++
+			entry.LastError = err.Error()
+			models.DB.Save(&entry)
+			// queue is most likely down, retry on the next tick
+			return
+		}
+
+		now := time.Now()
+		entry.Sent = true
+		entry.SentAt = &now
+		models.DB.Save(&entry)
+	}
+}
+
+// outboxTaskID is the queue task ID of the entry, every entry is a task of its own.
+func outboxTaskID(entry *models.Outbox) string {
+	return fmt.Sprintf("%s:%s:%d", entry.Type, entry.TaskID, entry.ID)
+}
@@ -0,0 +1,106 @@
+package tasks
+
+import (
+	"errors"
+	"github.com/hibiken/asynq"
+	"scrapyd/models"
+	"scrapyd/services"
+	"scrapyd/testutil"
+	"slices"
+	"testing"
+)
+
+// fakeQueue records the task IDs enqueued, refusing the same ID twice as asynq does.
+type fakeQueue struct {
+	ids  []string
+	down bool
+}
+
+func (q *fakeQueue) install(t *testing.T) {
+	original, originalDelete := enqueue, deleteTask
+	t.Cleanup(func() { enqueue, deleteTask = original, originalDelete })
+	deleteTask = func(taskID string) error {
+		q.ids = slices.DeleteFunc(q.ids, func(id string) bool { return id == taskID })
+		return nil
+	}
+	enqueue = func(task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+		if q.down {
+			return nil, errors.New("connection refused")
+		}
+		for _, opt := range opts {
+			if opt.Type() == asynq.TaskIDOpt {
+				id := opt.Value().(string)
+				if slices.Contains(q.ids, id) {
+					return nil, asynq.ErrTaskIDConflict
+				}
+				q.ids = append(q.ids, id)
+			}
+		}
+		return &asynq.TaskInfo{}, nil
+	}
+}
+
+func TestRelayOutboxRepeatedTasks(t *testing.T) {
+	// a job executed then restarted, a version inspected then inspected again after it failed
+	for _, typeName := range []string{"execute:job", "inspect:version"} {
+		t.Run(typeName, func(t *testing.T) {
+			testutil.Setup(t)
+			queue := &fakeQueue{}
+			queue.install(t)
+
+			for range 2 {
+				if err := services.OutboxAdd(models.DB, typeName, "id1"); err != nil {
+					t.Fatal(err)
+				}
+				RelayOutbox()
+			}
+
+			if len(queue.ids) != 2 || queue.ids[0] == queue.ids[1] {
+				t.Fatalf("enqueued %v, want two distinct tasks", queue.ids)
+			}
+			var unsent int64
+			models.DB.Model(&models.Outbox{}).Where("sent = ?", false).Count(&unsent)
+			if unsent != 0 {
+				t.Fatalf("%d entries unsent", unsent)
+			}
+		})
+	}
+}
+
+func TestRelayOutboxQueueDown(t *testing.T) {
+	testutil.Setup(t)
+	queue := &fakeQueue{down: true}
+	queue.install(t)
+
+	if err := services.OutboxAdd(models.DB, "execute:job", "j1"); err != nil {
+		t.Fatal(err)
+	}
+	RelayOutbox()
+
+	var entry models.Outbox
+	models.DB.First(&entry)
+	if entry.Sent || entry.Attempts != 1 || entry.LastError == "" {
+		t.Fatalf("entry %+v", entry)
+	}
+
+	queue.down = false
+	RelayOutbox()
+	models.DB.First(&entry)
+	if !entry.Sent {
+		t.Fatal("entry not sent once the queue is back")
+	}
+}
+
+func TestNewTaskRepeated(t *testing.T) {
+	queue := &fakeQueue{}
+	queue.install(t)
+
+	for range 3 {
+		if err := NewTask("cancel:job", "j1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(queue.ids) != 3 || queue.ids[0] == queue.ids[1] || queue.ids[1] == queue.ids[2] {
+		t.Fatalf("task IDs %v", queue.ids)
+	}
+}
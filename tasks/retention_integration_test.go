@@ -0,0 +1,51 @@
+//go:build integration
+
+package tasks
+
+import (
+	"context"
+	"github.com/hibiken/asynq"
+	"testing"
+	"time"
+)
+
+// TestRetentionScheduledOnce runs the schedulers of two workers against the redis
+// on 127.0.0.1:6379, only one retention run may get enqueued.
+func TestRetentionScheduledOnce(t *testing.T) {
+	redis := asynq.RedisClientOpt{Addr: "127.0.0.1:6379"}
+	inspector := asynq.NewInspector(redis)
+	defer inspector.Close()
+	if _, err := inspector.Queues(); err != nil {
+		t.Skip("redis is not available:", err)
+	}
+	inspector.DeleteAllPendingTasks("default")
+	defer inspector.DeleteAllPendingTasks("default")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	for range 2 {
+		scheduler := asynq.NewScheduler(redis, nil)
+		if _, err := scheduler.Register("@every 1s", RetentionTask()); err != nil {
+			t.Fatal(err)
+		}
+		if err := scheduler.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer scheduler.Shutdown()
+	}
+	<-ctx.Done()
+
+	pending, err := inspector.ListPendingTasks("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := 0
+	for _, task := range pending {
+		if task.Type == "retention:versions" {
+			runs++
+		}
+	}
+	if runs != 1 {
+		t.Fatalf("%d retention runs enqueued, want 1", runs)
+	}
+}
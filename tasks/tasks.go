@@ -3,22 +3,66 @@ package tasks
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/docker/docker/api/types/container"
+	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
 	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"maps"
+	"scrapyd/api/errs"
+	"scrapyd/config"
 	"scrapyd/models"
 	"scrapyd/services"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 )
 
 type Task struct {
 	ID string
 }
 
+var (
+	client     *asynq.Client
+	clientOnce sync.Once
+)
+
+// queueClient is shared by every enqueue, opening a client per task gets expensive for bulk operations.
+func queueClient() *asynq.Client {
+	clientOnce.Do(func() {
+		client = asynq.NewClient(asynq.RedisClientOpt{Addr: "127.0.0.1:6379"})
+	})
+	return client
+}
+
+// enqueue is replaced in tests
+var enqueue = func(task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	return queueClient().Enqueue(task, opts...)
+}
+
+// deleteTask removes a task still waiting in the queue, tasks already gone are fine. Replaced in tests.
+var deleteTask = func(taskID string) error {
+	inspector := asynq.NewInspector(asynq.RedisClientOpt{Addr: "127.0.0.1:6379"})
+	defer inspector.Close()
+	err := inspector.DeleteTask("default", taskID)
+	if errors.Is(err, asynq.ErrTaskNotFound) || errors.Is(err, asynq.ErrQueueNotFound) {
+		return nil
+	}
+	return err
+}
+
+// NewTask enqueues a task acting on ID. Every call is a task of its own, so that the same action
+// can be requested again once an earlier task for it is done or archived.
 func NewTask(typeName string, ID string) error {
-	client := asynq.NewClient(asynq.RedisClientOpt{Addr: "127.0.0.1:6379"})
-	defer client.Close()
+	reqID, _ := uuid.NewUUID()
+	return newTask(typeName, ID, typeName+":"+ID+":"+strings.ReplaceAll(reqID.String(), "-", ""))
+}
 
+// newTask enqueues the task acting on ID, the queue refuses a second task with the same taskID.
+func newTask(typeName string, ID string, taskID string) error {
 	payload, err := json.Marshal(Task{ID: ID})
 	if err != nil {
 		log.Error().
@@ -30,12 +74,12 @@ func NewTask(typeName string, ID string) error {
 	}
 	task := asynq.NewTask(typeName, payload)
 
-	_, err = client.Enqueue(task, asynq.TaskID(ID), asynq.MaxRetry(1))
+	_, err = enqueue(task, asynq.TaskID(taskID), asynq.MaxRetry(1))
 	if err != nil {
 		log.Error().
 			Err(err).
 			Str("type", typeName).
-			Str("task", ID).
+			Str("task", taskID).
 			Msg("failed to enqueue task")
 		return err
 	}
@@ -56,21 +100,151 @@ func HandleJobTask(ctx context.Context, t *asynq.Task) error {
 		return err
 	}
 
+	claimed, err := claimJob(&job)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		log.Debug().
+			Str("job", job.ID).
+			Str("status", job.Status).
+			Msg("job not claimed, skipping dispatch")
+		return nil
+	}
+
+	if err := dispatchJob(&job); err != nil {
+		return failJob(ctx, &job, err)
+	}
+	return nil
+}
+
+// claimJob moves the pending job to running before its container starts. The uniqueness policy
+// is enforced once more on the way: with an identical job already running it is queued or
+// rejected instead. The check and the status change are atomic since transactions hold the
+// database write lock from the start, so two workers can't both start identical jobs.
+func claimJob(job *models.Job) (bool, error) {
+	claimed := false
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		var current models.Job
+		if err := tx.Select("status").First(&current, "id = ?", job.ID).Error; err != nil {
+			return err
+		}
+		// cancelled or dispatched by another worker meanwhile
+		if current.Status != "pending" {
+			job.Status = current.Status
+			return nil
+		}
+
+		status := "running"
+		if job.Uniqueness != "allow" {
+			var running int64
+			if err := tx.Model(&models.Job{}).
+				Where("fingerprint = ? AND status = ? AND id <> ?", job.Fingerprint, "running", job.ID).
+				Count(&running).Error; err != nil {
+				return err
+			}
+			if running > 0 {
+				status = "queued"
+				if job.Uniqueness == "reject" {
+					status = "rejected"
+				}
+				log.Info().
+					Str("job", job.ID).
+					Str("status", status).
+					Msg("identical job is already running")
+			}
+		}
+
+		if err := tx.Model(&models.Job{}).Where("id = ?", job.ID).Update("status", status).Error; err != nil {
+			return err
+		}
+		job.Status = status
+		claimed = status == "running"
+		return nil
+	})
+	return claimed, err
+}
+
+// failJob gives up on a job that couldn't be started once asynq won't retry it anymore,
+// instead of leaving it pending forever. Identical jobs waiting behind it get their turn.
+func failJob(ctx context.Context, job *models.Job, err error) error {
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	if retried < maxRetry {
+		// the retry has to find the job pending to claim it again
+		if err := models.DB.Model(job).Where("status = ?", "running").Update("status", "pending").Error; err != nil {
+			log.Error().
+				Err(err).
+				Str("job", job.ID).
+				Msg("failed to release job claim")
+		}
+		return err
+	}
+
+	job.Status = "failed"
+	job.Error = err.Error()
+	if err := models.DB.Save(job).Error; err != nil {
+		log.Error().
+			Err(err).
+			Str("job", job.ID).
+			Msg("failed to mark job failed")
+	}
+	if err := ReleaseQueuedJob(job.Fingerprint); err != nil {
+		log.Error().
+			Err(err).
+			Str("job", job.ID).
+			Msg("failed to release queued job")
+	}
+	return err
+}
+
+// dispatchJob starts the crawl container of the job.
+func dispatchJob(job *models.Job) error {
+	// aliases follow promotions made while the job was waiting
+	if job.Alias != "" {
+		version, err := services.AliasResolve(job.ProjectID, job.Alias)
+		if err != nil {
+			return err
+		}
+		if version.Status != "ready" || !slices.Contains(version.Spiders, job.Spider) {
+			log.Error().
+				Str("job", job.ID).
+				Str("alias", job.Alias).
+				Str("version", version.ID).
+				Msg("alias target can't run the job")
+			return errs.ErrSpiderNotFound
+		}
+		job.VersionID = version.ID
+		job.Version = *version
+		models.DB.Save(job)
+	}
+
 	d, err := services.NewDaemon()
 	if err != nil {
 		return err
 	}
 	defer d.Client.Close()
 
+	mounts, err := services.InputMounts(job)
+	if err != nil {
+		return err
+	}
+	env, err := services.JobEnv(job)
+	if err != nil {
+		return err
+	}
+	env = append(env, fmt.Sprintf("SCRAPYD_INPUT_DIR=%s", services.InputMountDir))
+
 	contName := fmt.Sprintf("%s_%s_%s_%s", job.ID, job.ProjectID, job.VersionID, job.Spider)
 	contID, err := d.ContainerCreate(contName, &container.Config{
 		Image:      job.Version.Image,
 		Entrypoint: []string{"scrapy"},
-		Cmd:        []string{"crawl", job.Spider},
+		Cmd:        crawlCommand(job),
+		Env:        env,
 		Labels: map[string]string{
 			"label": "scrapyd",
 		},
-	})
+	}, mounts)
 	if err != nil {
 		return err
 	}
@@ -80,10 +254,48 @@ func HandleJobTask(ctx context.Context, t *asynq.Task) error {
 	}
 	job.Status = "running"
 
-	models.DB.Save(&job)
+	models.DB.Save(job)
 	return nil
 }
 
+func crawlCommand(job *models.Job) []string {
+	cmd := []string{"crawl", job.Spider}
+	for _, key := range slices.Sorted(maps.Keys(job.Args)) {
+		cmd = append(cmd, "-a", fmt.Sprintf("%s=%s", key, job.Args[key]))
+	}
+	// one KEY=VALUE scrapy setting per line
+	for _, setting := range strings.Split(job.Setting, "\n") {
+		if setting = strings.TrimSpace(setting); setting != "" {
+			cmd = append(cmd, "-s", setting)
+		}
+	}
+	return cmd
+}
+
+// ReleaseQueuedJob dispatches the oldest job waiting behind the given fingerprint,
+// unless an identical job is still running.
+func ReleaseQueuedJob(fingerprint string) error {
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		var running int64
+		if err := tx.Model(&models.Job{}).Where("fingerprint = ? AND status IN ?", fingerprint, []string{"pending", "running"}).Count(&running).Error; err != nil {
+			return err
+		}
+		if running > 0 {
+			return nil
+		}
+
+		var job models.Job
+		if err := tx.Order("created_at").First(&job, "fingerprint = ? AND status = ?", fingerprint, "queued").Error; err != nil {
+			return nil
+		}
+		job.Status = "pending"
+		if err := tx.Save(&job).Error; err != nil {
+			return err
+		}
+		return services.OutboxAdd(tx, "execute:job", job.ID)
+	})
+}
+
 func HandleInspectTask(ctx context.Context, t *asynq.Task) error {
 	var task Task
 	var version models.Version
@@ -103,16 +315,154 @@ func HandleInspectTask(ctx context.Context, t *asynq.Task) error {
 	}
 	defer d.Client.Close()
 
-	spiders, err := d.SpiderList(version.Image)
+	// versions sharing an image are told apart by its ID
+	imageID, err := d.ImageID(version.Image)
 	if err != nil {
+		version.Status = "failed"
+		version.Error = err.Error()
+		models.DB.Save(&version)
+		return fmt.Errorf("%w: %v", asynq.SkipRetry, err)
+	}
+	version.ImageID = imageID
+
+	spiders, result, err := d.SpiderList(version.Image, config.InspectTimeout)
+	if result != nil {
+		version.InspectExitCode = result.ExitCode
+		version.InspectLog = services.TailLog(result.Stderr)
+	}
+	if errors.Is(err, errs.ErrVersionInspectFailed) {
+		version.Status = "failed"
+		version.Error = fmt.Sprintf("%s with exit code %d", err, result.ExitCode)
+		models.DB.Save(&version)
+		return fmt.Errorf("%w: %v", asynq.SkipRetry, err)
+	}
+	if err != nil {
+		version.Status = "failed"
+		version.Error = err.Error()
+		models.DB.Save(&version)
 		return err
 	}
 	version.Spiders = spiders
 
+	// the metadata is informative, a project the script can't handle is still usable
+	introspection, _, err := d.Introspect(version.Image, config.InspectTimeout)
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("version", version.ID).
+			Msg("failed to introspect version")
+		introspection = &services.Introspection{}
+	}
+	version.ScrapyVersion = introspection.ScrapyVersion
+	version.PythonVersion = introspection.PythonVersion
+	version.Settings = introspection.Settings
+	version.SpiderMeta = introspection.Spiders
+	version.Dependencies = introspection.Dependencies
+
+	version.Status = "ready"
+	version.Progress = 100
+	version.Error = ""
+
 	models.DB.Save(&version)
 	return nil
 }
 
+func HandleLoadTask(ctx context.Context, t *asynq.Task) error {
+	var task Task
+	var version models.Version
+
+	err := json.Unmarshal(t.Payload(), &task)
+	if err != nil {
+		return err
+	}
+
+	if err := models.DB.First(&version, "id = ?", task.ID).Error; err != nil {
+		return err
+	}
+
+	err = services.VersionLoad(&version, func(percent int) {
+		models.DB.Model(&version).Update("progress", percent)
+	})
+	if err != nil {
+		version.Status = "failed"
+		version.Error = err.Error()
+		models.DB.Save(&version)
+		return fmt.Errorf("%w: %v", asynq.SkipRetry, err)
+	}
+
+	version.Status = "inspecting"
+	version.Progress = 0
+	version.Error = ""
+
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&version).Error; err != nil {
+			return err
+		}
+		return services.OutboxAdd(tx, "inspect:version", version.ID)
+	})
+}
+
+func HandlePullTask(ctx context.Context, t *asynq.Task) error {
+	var task Task
+	var version models.Version
+
+	err := json.Unmarshal(t.Payload(), &task)
+	if err != nil {
+		return err
+	}
+
+	if err := models.DB.First(&version, "id = ?", task.ID).Error; err != nil {
+		return err
+	}
+
+	if err := services.VersionPull(&version); err != nil {
+		version.Status = "failed"
+		version.Error = err.Error()
+		models.DB.Save(&version)
+		return err
+	}
+	version.Status = "inspecting"
+	version.Error = ""
+
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&version).Error; err != nil {
+			return err
+		}
+		return services.OutboxAdd(tx, "inspect:version", version.ID)
+	})
+}
+
+func HandleBuildTask(ctx context.Context, t *asynq.Task) error {
+	var task Task
+	var version models.Version
+
+	err := json.Unmarshal(t.Payload(), &task)
+	if err != nil {
+		return err
+	}
+
+	if err := models.DB.First(&version, "id = ?", task.ID).Error; err != nil {
+		return err
+	}
+
+	// a broken build won't fix itself on retry
+	if err := services.VersionBuild(&version); err != nil {
+		version.Status = "failed"
+		version.Error = err.Error()
+		models.DB.Save(&version)
+		return fmt.Errorf("%w: %v", asynq.SkipRetry, err)
+	}
+	version.Status = "inspecting"
+	version.Error = ""
+
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&version).Error; err != nil {
+			return err
+		}
+		return services.OutboxAdd(tx, "inspect:version", version.ID)
+	})
+}
+
 func HandleCancelTask(ctx context.Context, t *asynq.Task) error {
 	var task Task
 	var job models.Job
@@ -131,6 +481,18 @@ func HandleCancelTask(ctx context.Context, t *asynq.Task) error {
 		return err
 	}
 
+	// jobs that haven't started don't have a container yet, their execute task must not start one
+	result := models.DB.Model(&job).Where("status IN ?", []string{"pending", "queued"}).Update("status", "cancelled")
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		if err := DropExecuteTasks(job.ID); err != nil {
+			return err
+		}
+		return ReleaseQueuedJob(job.Fingerprint)
+	}
+
 	d, err := services.NewDaemon()
 	if err != nil {
 		return err
@@ -138,7 +500,10 @@ func HandleCancelTask(ctx context.Context, t *asynq.Task) error {
 	defer d.Client.Close()
 
 	contName := fmt.Sprintf("%s_%s_%s_%s", job.ID, job.ProjectID, job.VersionID, job.Spider)
-	cont, _ := d.FindContainerByName(contName)
+	cont, err := d.FindContainerByName(contName)
+	if err != nil {
+		return err
+	}
 	if err := d.ContainerStop(cont.ID); err != nil {
 		return err
 	}
@@ -148,6 +513,23 @@ func HandleCancelTask(ctx context.Context, t *asynq.Task) error {
 	return nil
 }
 
+// DropExecuteTasks removes the execute tasks relayed for the job from the queue.
+func DropExecuteTasks(jobID string) error {
+	var entries []models.Outbox
+	if err := models.DB.Find(&entries, "type = ? AND task_id = ? AND sent = ?", "execute:job", jobID, true).Error; err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := deleteTask(outboxTaskID(&entry)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleRestartTask reruns a job that is done. The old container goes, and the job is admitted
+// once more, so that the uniqueness policy applies as to new jobs and the rerun is dispatched
+// with the current env, inputs and alias target.
 func HandleRestartTask(ctx context.Context, t *asynq.Task) error {
 	var task Task
 	var job models.Job
@@ -157,7 +539,7 @@ func HandleRestartTask(ctx context.Context, t *asynq.Task) error {
 		return err
 	}
 
-	if err := models.DB.Preload("Project").First(&job, "id = ?", task.ID).Error; err != nil {
+	if err := models.DB.First(&job, "id = ?", task.ID).Error; err != nil {
 		log.Error().
 			Err(err).
 			Str("type", t.Type()).
@@ -165,20 +547,52 @@ func HandleRestartTask(ctx context.Context, t *asynq.Task) error {
 			Msg("job not found")
 		return err
 	}
+	if job.Status == "pending" || job.Status == "queued" {
+		log.Debug().
+			Str("job", job.ID).
+			Str("status", job.Status).
+			Msg("job has yet to run, skipping restart")
+		return nil
+	}
 
-	d, err := services.NewDaemon()
-	if err != nil {
+	// jobs that never started or got cleaned up have no container left
+	if err := services.JobCleanup(&job); err != nil {
 		return err
 	}
-	defer d.Client.Close()
+	err = services.JobReadmit(&job)
+	if errors.Is(err, errs.ErrJobDuplicate) {
+		log.Info().
+			Str("job", job.ID).
+			Msg("identical job is active, restart rejected")
+		return fmt.Errorf("%w: %v", asynq.SkipRetry, err)
+	}
+	return err
+}
 
-	contName := fmt.Sprintf("%s_%s_%s_%s", job.ID, job.ProjectID, job.VersionID, job.Spider)
-	cont, _ := d.FindContainerByName(contName)
-	if err := d.ContainerStart(cont.ID); err != nil {
-		return err
+// RetentionTask is the periodic retention run. Every worker schedules it, the uniqueness lock
+// lets a single one of them enqueue it until the run is done.
+func RetentionTask() *asynq.Task {
+	return asynq.NewTask("retention:versions", nil, asynq.Unique(time.Hour))
+}
+
+func HandleRetentionTask(ctx context.Context, t *asynq.Task) error {
+	var projects []models.Project
+
+	models.DB.Find(&projects, "retain_last > 0 OR retain_unused_days > 0")
+	for _, project := range projects {
+		if _, err := services.RetentionApply(&project); err != nil {
+			log.Error().
+				Err(err).
+				Str("project", project.ID).
+				Msg("failed to apply retention")
+		}
+	}
+
+	if err := services.ImagesRemovePending(); err != nil {
+		log.Error().
+			Err(err).
+			Msg("failed to remove pending images")
 	}
-	job.Status = "running"
 
-	models.DB.Save(&job)
 	return nil
 }
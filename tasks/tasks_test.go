@@ -0,0 +1,184 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hibiken/asynq"
+	"scrapyd/models"
+	"scrapyd/services"
+	"scrapyd/testutil"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func jobTask(t *testing.T, typeName string, id string) *asynq.Task {
+	t.Helper()
+	payload, err := json.Marshal(Task{ID: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return asynq.NewTask(typeName, payload)
+}
+
+func TestHandleJobTaskFailure(t *testing.T) {
+	testutil.Setup(t)
+	testutil.Create(t,
+		&models.Project{ID: "shop"},
+		&models.Version{ID: "v1", ProjectID: "shop", Image: "shop:v1", Status: "ready", Spiders: []string{"items"}},
+		// the alias got deleted while the job was waiting
+		&models.Job{ID: "j1", ProjectID: "shop", VersionID: "v1", Alias: "prod", Spider: "items", Status: "pending", Uniqueness: "queue", Fingerprint: "fp"},
+		&models.Job{ID: "j2", ProjectID: "shop", VersionID: "v1", Spider: "items", Status: "queued", Uniqueness: "queue", Fingerprint: "fp"},
+	)
+
+	if err := HandleJobTask(context.Background(), jobTask(t, "execute:job", "j1")); err == nil {
+		t.Fatal("dispatch succeeded")
+	}
+
+	var job models.Job
+	models.DB.First(&job, "id = ?", "j1")
+	if job.Status != "failed" || job.Error == "" {
+		t.Fatalf("job %s %q", job.Status, job.Error)
+	}
+	var queued models.Job
+	models.DB.First(&queued, "id = ?", "j2")
+	if queued.Status != "pending" {
+		t.Fatalf("queued job %s", queued.Status)
+	}
+	var outbox models.Outbox
+	if err := models.DB.First(&outbox, "type = ? AND task_id = ?", "execute:job", "j2").Error; err != nil {
+		t.Fatal("queued job not dispatched:", err)
+	}
+}
+
+func TestHandleInspectTaskMissingImage(t *testing.T) {
+	testutil.Setup(t)
+	testutil.Create(t,
+		&models.Project{ID: "shop"},
+		&models.Version{ID: "v1", ProjectID: "shop", Image: "scrapyd-test/missing:v1", Status: "inspecting"},
+	)
+
+	err := HandleInspectTask(context.Background(), jobTask(t, "inspect:version", "v1"))
+	if !errors.Is(err, asynq.SkipRetry) {
+		t.Fatalf("err %v, want it not retried", err)
+	}
+	var version models.Version
+	models.DB.First(&version, "id = ?", "v1")
+	if version.Status != "failed" || version.Error == "" {
+		t.Fatalf("version %s %q", version.Status, version.Error)
+	}
+}
+
+func TestHandleCancelTaskPending(t *testing.T) {
+	testutil.Setup(t)
+	queue := &fakeQueue{}
+	queue.install(t)
+	testutil.Create(t,
+		&models.Project{ID: "shop"},
+		&models.Version{ID: "v1", ProjectID: "shop", Image: "shop:v1", Status: "ready", Spiders: []string{"items"}},
+		&models.Job{ID: "j1", ProjectID: "shop", VersionID: "v1", Spider: "items", Status: "pending", Uniqueness: "queue", Fingerprint: "fp"},
+		&models.Job{ID: "j2", ProjectID: "shop", VersionID: "v1", Spider: "items", Status: "queued", Uniqueness: "queue", Fingerprint: "fp"},
+	)
+	if err := services.OutboxAdd(models.DB, "execute:job", "j1"); err != nil {
+		t.Fatal(err)
+	}
+	RelayOutbox()
+
+	if err := HandleCancelTask(context.Background(), jobTask(t, "cancel:job", "j1")); err != nil {
+		t.Fatal(err)
+	}
+
+	var job models.Job
+	models.DB.First(&job, "id = ?", "j1")
+	if job.Status != "cancelled" {
+		t.Fatalf("job %s", job.Status)
+	}
+	if len(queue.ids) != 0 {
+		t.Fatalf("tasks left in the queue %v", queue.ids)
+	}
+	// the identical job waiting behind it gets its turn
+	var queued models.Job
+	models.DB.First(&queued, "id = ?", "j2")
+	if queued.Status != "pending" {
+		t.Fatalf("queued job %s", queued.Status)
+	}
+}
+
+func TestCrawlCommandSettings(t *testing.T) {
+	job := &models.Job{
+		Spider:  "items",
+		Args:    map[string]string{"page": "2"},
+		Setting: "DOWNLOAD_DELAY=2\n\n  LOG_LEVEL=INFO \n",
+	}
+	want := []string{"crawl", "items", "-a", "page=2", "-s", "DOWNLOAD_DELAY=2", "-s", "LOG_LEVEL=INFO"}
+	if cmd := crawlCommand(job); !slices.Equal(cmd, want) {
+		t.Fatalf("command %q, want %q", cmd, want)
+	}
+}
+
+func TestClaimJobConcurrent(t *testing.T) {
+	tests := []struct {
+		uniqueness string
+		statuses   map[string]int
+	}{
+		{uniqueness: "reject", statuses: map[string]int{"running": 1, "rejected": 7}},
+		{uniqueness: "queue", statuses: map[string]int{"running": 1, "queued": 7}},
+		{uniqueness: "allow", statuses: map[string]int{"running": 8}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uniqueness, func(t *testing.T) {
+			testutil.Setup(t)
+			testutil.Create(t,
+				&models.Project{ID: "shop"},
+				&models.Version{ID: "v1", ProjectID: "shop", Image: "shop:v1", Status: "ready", Spiders: []string{"items"}},
+			)
+			jobs := make([]*models.Job, 8)
+			for i := range jobs {
+				jobs[i] = &models.Job{ID: fmt.Sprint("job", i), ProjectID: "shop", VersionID: "v1", Spider: "items", Status: "pending", Uniqueness: tt.uniqueness, Fingerprint: "fp"}
+				testutil.Create(t, jobs[i])
+			}
+
+			var wg sync.WaitGroup
+			claimed := make([]bool, len(jobs))
+			for i, job := range jobs {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					var err error
+					if claimed[i], err = claimJob(job); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			statuses := map[string]int{}
+			for i, job := range jobs {
+				var stored models.Job
+				models.DB.First(&stored, "id = ?", job.ID)
+				if stored.Status != job.Status || claimed[i] != (job.Status == "running") {
+					t.Fatalf("job %s stored %s, claimed %v as %s", job.ID, stored.Status, claimed[i], job.Status)
+				}
+				statuses[stored.Status]++
+			}
+			if fmt.Sprint(statuses) != fmt.Sprint(tt.statuses) {
+				t.Fatalf("statuses %v, want %v", statuses, tt.statuses)
+			}
+		})
+	}
+}
+
+func TestClaimJobNotPending(t *testing.T) {
+	testutil.Setup(t)
+	testutil.Create(t,
+		&models.Project{ID: "shop"},
+		&models.Version{ID: "v1", ProjectID: "shop", Image: "shop:v1", Status: "ready", Spiders: []string{"items"}},
+		&models.Job{ID: "j1", ProjectID: "shop", VersionID: "v1", Spider: "items", Status: "cancelled", Uniqueness: "allow", Fingerprint: "fp"},
+	)
+	job := &models.Job{ID: "j1", Status: "pending", Uniqueness: "allow", Fingerprint: "fp"}
+	if claimed, err := claimJob(job); claimed || err != nil || job.Status != "cancelled" {
+		t.Fatalf("claimed %v, %v, status %s", claimed, err, job.Status)
+	}
+}
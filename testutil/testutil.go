@@ -0,0 +1,56 @@
+// Package testutil holds the fixtures the tests of the other packages share.
+package testutil
+
+import (
+	"path/filepath"
+	"scrapyd/config"
+	"scrapyd/models"
+	"testing"
+)
+
+// Setup points the models and the data dir at a fresh temporary database and directory.
+func Setup(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := models.Open(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	models.DB = db
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	dataDir := config.DataDir
+	config.DataDir = filepath.Join(dir, "data")
+	t.Cleanup(func() { config.DataDir = dataDir })
+}
+
+// Create inserts the rows or fails the test.
+func Create(t *testing.T, rows ...any) {
+	t.Helper()
+	for _, row := range rows {
+		if err := models.DB.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Count counts the rows of T matching the query or fails the test.
+func Count[T any](t *testing.T, query string, args ...any) int64 {
+	t.Helper()
+	var n int64
+	if err := models.DB.Model(new(T)).Where(query, args...).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// MasterKey seals secrets with the key for the rest of the test, an empty key disables them.
+func MasterKey(t *testing.T, key string) {
+	t.Helper()
+	masterKey := config.MasterKey
+	config.MasterKey = key
+	t.Cleanup(func() { config.MasterKey = masterKey })
+}
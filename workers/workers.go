@@ -3,6 +3,7 @@ package main
 import (
 	"github.com/hibiken/asynq"
 	"github.com/rs/zerolog/log"
+	"scrapyd/config"
 	"scrapyd/models"
 	"scrapyd/tasks"
 )
@@ -21,6 +22,19 @@ func main() {
 	mux.HandleFunc("cancel:job", tasks.HandleCancelTask)
 	mux.HandleFunc("restart:job", tasks.HandleRestartTask)
 	mux.HandleFunc("inspect:version", tasks.HandleInspectTask)
+	mux.HandleFunc("pull:version", tasks.HandlePullTask)
+	mux.HandleFunc("build:version", tasks.HandleBuildTask)
+	mux.HandleFunc("load:version", tasks.HandleLoadTask)
+	mux.HandleFunc("retention:versions", tasks.HandleRetentionTask)
+
+	scheduler := asynq.NewScheduler(asynq.RedisClientOpt{Addr: "127.0.0.1:6379"}, nil)
+	if _, err := scheduler.Register(config.RetentionSchedule, tasks.RetentionTask()); err != nil {
+		log.Fatal().Err(err).Msg("failed to register retention task")
+	}
+	if err := scheduler.Start(); err != nil {
+		log.Fatal().Err(err).Msg("failed to start scheduler")
+	}
+	defer scheduler.Shutdown()
 
 	if err := srv.Run(mux); err != nil {
 		log.Fatal().Err(err).Msg("failed to start workers")